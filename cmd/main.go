@@ -11,21 +11,46 @@ import (
 func main() {
 	args := os.Args[1:]
 	if len(args) == 0 {
-		fmt.Println("you need to provide the query")
+		fmt.Println("you need to provide the query, or -f and the path to a .sql file")
 	} else {
-		tokens := lexer.AnalyzeString(args[0])
+		query := args[0]
+		if query == "-f" && len(args) > 1 {
+			contents, err := os.ReadFile(args[1])
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+			query = string(contents)
+		}
+
+		tokens, err := lexer.AnalyzeString(query)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
 
 		fmt.Println("=== TOKENS ===")
-		for _, val := range tokens {
-			fmt.Println(val)
+		for _, token := range tokens {
+			fmt.Println(token)
 		}
 
-		fmt.Println("=== PARSE TREE ===")
-		cstTree := parser.ParseTokensToCST(tokens)
-		cstTree.PrintTree()
+		statements, err := parser.ParseScript(tokens)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		for _, cstTree := range statements {
+			fmt.Println("=== PARSE TREE ===")
+			cstTree.PrintTree()
 
-		fmt.Println("=== AST ===")
-		astTree := parser.ConvertToAST(cstTree)
-		astTree.PrintTree()
+			fmt.Println("=== AST ===")
+			astTree, err := parser.ConvertToAST(cstTree)
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+			astTree.PrintTree()
+		}
 	}
-}
\ No newline at end of file
+}
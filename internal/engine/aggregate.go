@@ -0,0 +1,574 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jasutiin/deebeejeebees/internal/parser"
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// aggregateFunction is a function like COUNT or SUM that computes a single value from all the rows of a
+// group. Its argument is evaluated for every row and NULLs are skipped, so COUNT(x) counts the rows where
+// x isn't NULL while COUNT(*) counts every row.
+type aggregateFunction struct {
+	name string
+
+	// acceptsStar is set for COUNT, the only aggregate that can be called as COUNT(*).
+	acceptsStar bool
+
+	// resultType checks the type of the argument and returns the type of the result.
+	resultType func(argType Type) (Type, error)
+
+	newAccumulator func() accumulator
+}
+
+// accumulator is handed the values of a group one at a time and computes the aggregate from them.
+type accumulator interface {
+	add(value any) error
+	result() any
+}
+
+// aggregateFunctions are the aggregates the engine knows about, by upper-case name.
+var aggregateFunctions = map[string]*aggregateFunction{
+	"COUNT": {
+		name:           "COUNT",
+		acceptsStar:    true,
+		resultType:     func(argType Type) (Type, error) { return TypeInt, nil },
+		newAccumulator: func() accumulator { return &countAccumulator{} },
+	},
+	"SUM": {
+		name: "SUM",
+		resultType: func(argType Type) (Type, error) {
+			if !assignable(argType, TypeNumber) {
+				return "", fmt.Errorf("SUM expects a number but got %s", argType)
+			}
+			if argType == TypeNull {
+				return TypeInt, nil
+			}
+			return argType, nil
+		},
+		newAccumulator: func() accumulator { return &sumAccumulator{} },
+	},
+	"AVG": {
+		name: "AVG",
+		resultType: func(argType Type) (Type, error) {
+			return expectType(argType, TypeNumber, "AVG")
+		},
+		newAccumulator: func() accumulator { return &avgAccumulator{} },
+	},
+	"MIN": {
+		name:           "MIN",
+		resultType:     func(argType Type) (Type, error) { return argType, nil },
+		newAccumulator: func() accumulator { return &extremeAccumulator{ keep: -1 } },
+	},
+	"MAX": {
+		name:           "MAX",
+		resultType:     func(argType Type) (Type, error) { return argType, nil },
+		newAccumulator: func() accumulator { return &extremeAccumulator{ keep: 1 } },
+	},
+}
+
+// lookupAggregate finds an aggregate function by name.
+func lookupAggregate(name string) (*aggregateFunction, bool) {
+	function, ok := aggregateFunctions[strings.ToUpper(name)]
+	return function, ok
+}
+
+// isAggregateCall reports whether node is a call to an aggregate function.
+func isAggregateCall(node narytree.Node) bool {
+	if node.Type != parser.FunctionCallNode {
+		return false
+	}
+	_, ok := lookupAggregate(node.Data)
+	return ok
+}
+
+// containsAggregate reports whether there is a call to an aggregate function anywhere in node. Calls in
+// subqueries don't count, they aggregate the rows of the subquery.
+func containsAggregate(node narytree.Node) bool {
+	if isAggregateCall(node) {
+		return true
+	}
+	if node.Type == parser.SubqueryNode {
+		return false
+	}
+	for _, child := range node.Children {
+		if containsAggregate(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// noAggregates fails if an expression of a clause that is computed for single rows, like WHERE, calls an
+// aggregate function.
+func noAggregates(clause string, node narytree.Node) error {
+	if containsAggregate(node) {
+		return fmt.Errorf("aggregate functions are not allowed in %s", clause)
+	}
+	return nil
+}
+
+type countAccumulator struct {
+	count int64
+}
+
+func (a *countAccumulator) add(value any) error {
+	a.count++
+	return nil
+}
+
+func (a *countAccumulator) result() any {
+	return a.count
+}
+
+// sumAccumulator adds up integers as integers until the first float comes along. The sum of no values is
+// NULL, not 0.
+type sumAccumulator struct {
+	intSum   int64
+	floatSum float64
+	isFloat  bool
+	started  bool
+}
+
+func (a *sumAccumulator) add(value any) error {
+	a.started = true
+
+	if i, ok := value.(int64); ok && !a.isFloat {
+		sum := a.intSum + i
+		if (i > 0 && sum < a.intSum) || (i < 0 && sum > a.intSum) {
+			return fmt.Errorf("SUM is out of range for INT")
+		}
+		a.intSum = sum
+		return nil
+	}
+
+	f, ok := toFloat(value)
+	if !ok {
+		return fmt.Errorf("SUM expects a number but got %s", typeName(value))
+	}
+	if !a.isFloat {
+		a.isFloat = true
+		a.floatSum = float64(a.intSum)
+	}
+	a.floatSum += f
+	return nil
+}
+
+func (a *sumAccumulator) result() any {
+	switch {
+		case !a.started:
+			return nil
+		case a.isFloat:
+			return a.floatSum
+		default:
+			return a.intSum
+	}
+}
+
+type avgAccumulator struct {
+	sum   float64
+	count int64
+}
+
+func (a *avgAccumulator) add(value any) error {
+	f, ok := toFloat(value)
+	if !ok {
+		return fmt.Errorf("AVG expects a number but got %s", typeName(value))
+	}
+	a.sum += f
+	a.count++
+	return nil
+}
+
+func (a *avgAccumulator) result() any {
+	if a.count == 0 {
+		return nil
+	}
+	return a.sum / float64(a.count)
+}
+
+// extremeAccumulator keeps the smallest value for MIN (keep is -1) or the largest for MAX (keep is 1).
+type extremeAccumulator struct {
+	keep  int
+	value any
+}
+
+func (a *extremeAccumulator) add(value any) error {
+	if a.value == nil {
+		a.value = value
+		return nil
+	}
+
+	cmp, err := compareValues(value, a.value)
+	if err != nil {
+		return err
+	}
+	if cmp == a.keep {
+		a.value = value
+	}
+	return nil
+}
+
+func (a *extremeAccumulator) result() any {
+	return a.value
+}
+
+// distinctAccumulator passes on each distinct value only once, for calls like COUNT(DISTINCT x).
+type distinctAccumulator struct {
+	accumulator
+	seen map[any]bool
+}
+
+func (a *distinctAccumulator) add(value any) error {
+	key := valueKey(value)
+	if a.seen[key] {
+		return nil
+	}
+	a.seen[key] = true
+	return a.accumulator.add(value)
+}
+
+// aggregateCall is a call to an aggregate function found in a query.
+type aggregateCall struct {
+	node     narytree.Node
+	function *aggregateFunction
+	distinct bool
+	argument narytree.Node // empty for COUNT(*)
+}
+
+func (c aggregateCall) newAccumulator() accumulator {
+	acc := c.function.newAccumulator()
+	if c.distinct {
+		return &distinctAccumulator{ accumulator: acc, seen: map[any]bool{} }
+	}
+	return acc
+}
+
+// grouping describes how the rows of a query with GROUP BY or aggregate functions are grouped. Each
+// group becomes a single row that holds the value of every GROUP BY expression followed by the result
+// of every aggregate call; rel describes those rows. Everything computed after grouping, the select
+// list and HAVING, is rewritten to refer to the columns of these rows instead. A GROUP BY expression
+// that is a column keeps the column's name in rel so that subqueries can still refer to it; the other
+// columns are hidden.
+type grouping struct {
+	keys       []narytree.Node
+	aggregates []aggregateCall
+	input      *relation
+	rel        *relation
+}
+
+// slotNode stands in for a GROUP BY expression or an aggregate call once an expression has been rewritten
+// for grouping. Data is the position of the column of the grouped rows that holds its value.
+const slotNode = "SlotNode"
+
+// newGrouping works out the grouping of a query, or returns nil if the query isn't grouped. A query is
+// grouped when it has GROUP BY or HAVING or calls an aggregate function in its select list. Without
+// GROUP BY all rows make up a single group. scope is the scope of the rows that are grouped.
+// GroupByNode -> expression, ...
+// HavingNode -> condition
+func (db *Database) newGrouping(groupBy narytree.Node, having narytree.Node, outputs []outputColumn, scope *analysisScope) (*grouping, error) {
+	grouped := len(groupBy.Children) > 0 || len(having.Children) > 0
+	for _, output := range outputs {
+		grouped = grouped || containsAggregate(output.expression)
+	}
+	if !grouped {
+		return nil, nil
+	}
+
+	g := &grouping{ input: scope.relation, rel: &relation{} }
+
+	for _, key := range groupBy.Children {
+		if err := noAggregates("GROUP BY", key); err != nil {
+			return nil, err
+		}
+		if err := noWindowFunctions("GROUP BY", key); err != nil {
+			return nil, err
+		}
+		keyType, err := db.typeOf(key, scope)
+		if err != nil {
+			return nil, err
+		}
+
+		column := relationColumn{ name: outputName(key), typ: keyType, hidden: true }
+		if (key.Type == parser.IdentifierNode || key.Type == parser.QualifiedNameNode) && g.input.binds(key) {
+			index, _ := g.input.resolveColumn(key) // typeOf has already resolved it
+			column = g.input.columns[index]
+		}
+		g.keys = append(g.keys, key)
+		g.rel.columns = append(g.rel.columns, column)
+	}
+
+	var expressions []narytree.Node
+	for _, output := range outputs {
+		expressions = append(expressions, output.expression)
+	}
+	expressions = append(expressions, having.Children...)
+
+	for _, expression := range expressions {
+		if err := db.collectAggregates(g, expression, scope); err != nil {
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+// collectAggregates adds every aggregate call in node to the grouping. The same call written twice, like
+// the COUNT(*) in 'SELECT COUNT(*) ... HAVING COUNT(*) > 1', is only computed once.
+func (db *Database) collectAggregates(g *grouping, node narytree.Node, scope *analysisScope) error {
+	if node.Type == parser.SubqueryNode {
+		return nil
+	}
+	if !isAggregateCall(node) {
+		for _, child := range node.Children {
+			if err := db.collectAggregates(g, child, scope); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, aggregate := range g.aggregates {
+		if sameExpression(aggregate.node, node, g.input) {
+			return nil
+		}
+	}
+
+	function, _ := lookupAggregate(node.Data)
+	call := aggregateCall{ node: node, function: function }
+	arguments := node.Children
+	if len(arguments) > 0 && arguments[0].Type == parser.DistinctNode {
+		call.distinct = true
+		arguments = arguments[1:]
+	}
+
+	if len(arguments) != 1 {
+		return fmt.Errorf("function %s takes 1 arguments but got %d", function.name, len(arguments))
+	}
+
+	argType := TypeAny
+	if arguments[0].Type == parser.StarNode {
+		if !function.acceptsStar || call.distinct {
+			return fmt.Errorf("function %s does not accept '*'", function.name)
+		}
+	} else {
+		if containsAggregate(arguments[0]) {
+			return fmt.Errorf("aggregate function calls cannot be nested")
+		}
+		var err error
+		argType, err = db.typeOf(arguments[0], scope)
+		if err != nil {
+			return err
+		}
+		call.argument = arguments[0]
+	}
+
+	resultType, err := function.resultType(argType)
+	if err != nil {
+		return err
+	}
+
+	g.aggregates = append(g.aggregates, call)
+	g.rel.columns = append(g.rel.columns, relationColumn{ name: strings.ToLower(function.name), typ: resultType, hidden: true })
+	return nil
+}
+
+// rewrite replaces the GROUP BY expressions and aggregate calls in node by slots that refer to the
+// columns of the grouped rows. Any column of the grouped rows left over afterwards can't be computed from
+// a group, so it is an error. Columns of an outer query are the same for every group and stay as they
+// are, and so do subqueries, whose references to grouped columns are looked up by name in rel.
+func (g *grouping) rewrite(node narytree.Node) (narytree.Node, error) {
+	for i, key := range g.keys {
+		if sameExpression(key, node, g.input) {
+			return slot(i), nil
+		}
+	}
+
+	for i, aggregate := range g.aggregates {
+		if sameExpression(aggregate.node, node, g.input) {
+			return slot(len(g.keys) + i), nil
+		}
+	}
+
+	if node.Type == parser.SubqueryNode {
+		return node, nil
+	}
+	if (node.Type == parser.IdentifierNode || node.Type == parser.QualifiedNameNode) && !g.input.binds(node) {
+		return node, nil
+	}
+	if node.Type == parser.IdentifierNode || node.Type == parser.QualifiedNameNode {
+		return narytree.Node{}, fmt.Errorf("column '%s' must appear in the GROUP BY clause or be used in an aggregate function", columnName(node))
+	}
+
+	rewritten := node
+	rewritten.Children = nil
+	for _, child := range node.Children {
+		rewrittenChild, err := g.rewrite(child)
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		rewritten.AddChild(rewrittenChild)
+	}
+	return rewritten, nil
+}
+
+// rewriteClauses rewrites the select list and the HAVING clause, which are both computed from groups.
+func (g *grouping) rewriteClauses(outputs []outputColumn, having narytree.Node) ([]outputColumn, narytree.Node, error) {
+	var rewrittenOutputs []outputColumn
+	for _, output := range outputs {
+		expression, err := g.rewrite(output.expression)
+		if err != nil {
+			return nil, narytree.Node{}, err
+		}
+		rewrittenOutputs = append(rewrittenOutputs, outputColumn{ name: output.name, expression: expression })
+	}
+
+	if len(having.Children) == 0 {
+		return rewrittenOutputs, having, nil
+	}
+	condition, err := g.rewrite(having.Children[0])
+	if err != nil {
+		return nil, narytree.Node{}, err
+	}
+	return rewrittenOutputs, narytree.Node{ Type: parser.HavingNode, Children: []narytree.Node{ condition } }, nil
+}
+
+// sameExpression reports whether two expressions are written the same way. Column references are
+// compared by the column they resolve to in rel, so name and users.name are the same.
+func sameExpression(a narytree.Node, b narytree.Node, rel *relation) bool {
+	isColumn := func(node narytree.Node) bool {
+		return node.Type == parser.IdentifierNode || node.Type == parser.QualifiedNameNode
+	}
+
+	if isColumn(a) && isColumn(b) {
+		aIndex, aErr := rel.resolveColumn(a)
+		bIndex, bErr := rel.resolveColumn(b)
+		return aErr == nil && bErr == nil && aIndex == bIndex
+	}
+
+	if a.Type != b.Type || a.Data != b.Data || len(a.Children) != len(b.Children) {
+		return false
+	}
+	for i := range a.Children {
+		if !sameExpression(a.Children[i], b.Children[i], rel) {
+			return false
+		}
+	}
+	return true
+}
+
+// hashAggregate groups its input with a hash table keyed by the values of the GROUP BY expressions,
+// feeding each row to the accumulators of its group. It has to read all of its input before it can
+// produce the first group. Groups come out in the order they were first seen.
+type hashAggregate struct {
+	input    operator
+	group    *grouping
+	rows     [][]any
+	position int
+}
+
+func (o *hashAggregate) columns() *relation {
+	return o.group.rel
+}
+
+func (o *hashAggregate) open(parent *scope) error {
+	if err := o.input.open(parent); err != nil {
+		return err
+	}
+
+	type groupState struct {
+		keys         []any
+		accumulators []accumulator
+	}
+	groups := map[string]*groupState{}
+	var order []*groupState
+
+	newGroup := func(keys []any) *groupState {
+		state := &groupState{ keys: keys }
+		for _, aggregate := range o.group.aggregates {
+			state.accumulators = append(state.accumulators, aggregate.newAccumulator())
+		}
+		order = append(order, state)
+		return state
+	}
+
+	for {
+		row, err := o.input.next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+		s := parent.rowScope(o.input.columns(), row)
+
+		keys := make([]any, len(o.group.keys))
+		for i, key := range o.group.keys {
+			keys[i], err = evalExpression(key, s)
+			if err != nil {
+				return err
+			}
+		}
+
+		state, ok := groups[rowKey(keys)]
+		if !ok {
+			state = newGroup(keys)
+			groups[rowKey(keys)] = state
+		}
+
+		for i, aggregate := range o.group.aggregates {
+			var value any = true // COUNT(*) counts every row
+			if aggregate.argument.Type != "" {
+				value, err = evalExpression(aggregate.argument, s)
+				if err != nil {
+					return err
+				}
+			}
+			if value == nil {
+				continue
+			}
+			if err := state.accumulators[i].add(value); err != nil {
+				return err
+			}
+		}
+	}
+
+	// without GROUP BY there is always exactly one group, even when there are no rows
+	if len(order) == 0 && len(o.group.keys) == 0 {
+		newGroup(nil)
+	}
+
+	o.rows = nil
+	for _, state := range order {
+		row := append([]any{}, state.keys...)
+		for _, acc := range state.accumulators {
+			row = append(row, acc.result())
+		}
+		o.rows = append(o.rows, row)
+	}
+	o.position = 0
+	return nil
+}
+
+func (o *hashAggregate) next() ([]any, error) {
+	if o.position >= len(o.rows) {
+		return nil, nil
+	}
+	row := o.rows[o.position]
+	o.position++
+	return row, nil
+}
+
+// slot makes a slotNode that refers to the column at index.
+func slot(index int) narytree.Node {
+	return narytree.Node{ Type: slotNode, Data: strconv.Itoa(index) }
+}
+
+// slotIndex returns the position a slotNode refers to.
+func slotIndex(node narytree.Node) int {
+	index, _ := strconv.Atoi(node.Data) // slots are only made by slot, Data is always a number
+	return index
+}
@@ -0,0 +1,24 @@
+package engine
+
+import "testing"
+
+func TestAggregates(t *testing.T) {
+	runQueryTests(t, []queryTest{
+		{ "SELECT COUNT(*), COUNT(score), SUM(score), AVG(score), MIN(score), MAX(score) FROM users", "[[4 3 9.5 3.1666666666666665 -3 10]]" },
+		{ "SELECT COUNT(DISTINCT user_id), SUM(DISTINCT user_id) FROM orders", "[[3 12]]" },
+		{ "SELECT user_id, COUNT(*), SUM(amount) FROM orders GROUP BY user_id", "[[1 2 29.5] [2 1 5] [9 1 7]]" },
+		{ "SELECT user_id, SUM(amount) FROM orders GROUP BY user_id HAVING SUM(amount) > 6", "[[1 29.5] [9 7]]" },
+		{ "SELECT user_id > 1, COUNT(*) FROM orders GROUP BY user_id > 1", "[[false 2] [true 2]]" },
+		{ "SELECT COUNT(*), SUM(score), MAX(name) FROM users WHERE id > 10", "[[0 <nil> <nil>]]" },
+		{ "SELECT active, COUNT(*) FROM users GROUP BY active", "[[true 1] [false 1] [<nil> 2]]" },
+		{ "SELECT MIN(name), MAX(joined) FROM users", "[[alice 2024-03-01]]" },
+		{ "SELECT id, COUNT(*) FROM users", "error: column 'id' must appear in the GROUP BY clause or be used in an aggregate function" },
+		{ "SELECT user_id, amount FROM orders GROUP BY user_id", "error: column 'amount' must appear in the GROUP BY clause or be used in an aggregate function" },
+		{ "SELECT id FROM users WHERE COUNT(*) > 1", "error: aggregate functions are not allowed in WHERE" },
+		{ "SELECT COUNT(*) FROM users GROUP BY COUNT(*)", "error: aggregate functions are not allowed in GROUP BY" },
+		{ "SELECT SUM(name) FROM users", "error: SUM expects a number but got TEXT" },
+		{ "SELECT SUM(COUNT(*)) FROM users", "error: aggregate function calls cannot be nested" },
+		{ "SELECT id FROM users HAVING id > 1", "error: column 'id' must appear in the GROUP BY clause or be used in an aggregate function" },
+		{ "SELECT COUNT(*) FROM users HAVING COUNT(*) > 1", "[[4]]" },
+	})
+}
@@ -0,0 +1,774 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jasutiin/deebeejeebees/internal/parser"
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// Semantic analysis runs on the AST before a statement is executed. It makes sure that every table,
+// column and function the statement mentions exists (name resolution) and that the types of expressions
+// fit together (type checking), so that mistakes are reported before any row is touched.
+
+// analysisScope is what the names in an expression can refer to. Inside a subquery, outer is the scope of
+// the query around it. commonTables are the queries named by a WITH clause, which can be read like tables
+// by the queries inside the scope.
+type analysisScope struct {
+	relation     *relation
+	outer        *analysisScope
+	commonTables map[string]*commonTable
+}
+
+// columnType resolves a column reference and returns the type of the column. Names that don't belong to
+// the scope's own relation are looked up in the scopes around it.
+func (scope *analysisScope) columnType(node narytree.Node) (Type, error) {
+	for current := scope; current != nil; current = current.outer {
+		if current.relation == nil || !current.relation.binds(node) {
+			continue
+		}
+		index, err := current.relation.resolveColumn(node)
+		if err != nil {
+			return "", err
+		}
+		return current.relation.columns[index].typ, nil
+	}
+
+	if scope.relation == nil {
+		return "", fmt.Errorf("column '%s' does not exist", columnName(node))
+	}
+	_, err := scope.relation.resolveColumn(node) // says why the name isn't a column of the innermost query
+	return "", err
+}
+
+func (db *Database) analyze(ast narytree.Node) error {
+	switch ast.Type {
+		case parser.CreateTableNode:
+			return db.analyzeCreateTable(ast)
+		case parser.InsertNode:
+			return db.analyzeInsert(ast)
+		case parser.UpdateNode:
+			return db.analyzeUpdate(ast)
+		case parser.SelectNode:
+			_, err := db.analyzeSelect(ast, nil)
+			return err
+	}
+	return nil
+}
+
+func (db *Database) analyzeCreateTable(ast narytree.Node) error {
+	tableName := childOfType(ast, parser.TableNameNode).Data
+	if _, exists := db.tables[tableName]; exists {
+		return fmt.Errorf("table '%s' already exists", tableName)
+	}
+
+	seen := map[string]bool{}
+	for _, columnDef := range childOfType(ast, parser.ColumnListNode).Children {
+		columnName := childOfType(columnDef, parser.IdentifierNode).Data
+		dataType := childOfType(columnDef, parser.DataTypeNode).Data
+
+		if !dataTypes[dataType] {
+			return fmt.Errorf("unknown data type '%s' for column '%s'", dataType, columnName)
+		}
+		if seen[columnName] {
+			return fmt.Errorf("column '%s' is defined more than once", columnName)
+		}
+		seen[columnName] = true
+	}
+	return nil
+}
+
+// analyzeInsert checks that the rows an INSERT adds, from VALUES or from a query, fit the columns they go
+// into.
+// InsertNode -> [WithNode], TableNameNode, [ColumnListNode], ValuesListNode, ... or SelectNode
+func (db *Database) analyzeInsert(ast narytree.Node) error {
+	table, err := db.table(childOfType(ast, parser.TableNameNode).Data)
+	if err != nil {
+		return err
+	}
+
+	targets, err := insertTargets(ast, table)
+	if err != nil {
+		return err
+	}
+
+	scope := &analysisScope{}
+	if with := childOfType(ast, parser.WithNode); with.Type != "" {
+		if scope, err = db.analyzeWith(with, nil); err != nil {
+			return err
+		}
+	}
+
+	if query := childOfType(ast, parser.SelectNode); query.Type != "" {
+		rel, err := db.analyzeSelect(query, scope)
+		if err != nil {
+			return err
+		}
+		if targets, err = insertWidth(ast, targets, len(rel.columns)); err != nil {
+			return err
+		}
+		for i, index := range targets {
+			if err := checkStorable(rel.columns[i].typ, table.Columns[index]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	width := -1
+	for _, row := range ast.Children {
+		if row.Type != parser.ValuesListNode {
+			continue
+		}
+		if width != -1 && len(row.Children) != width {
+			return fmt.Errorf("VALUES lists must all be the same length")
+		}
+		width = len(row.Children)
+
+		if err := noAggregates("VALUES", row); err != nil {
+			return err
+		}
+		if err := noWindowFunctions("VALUES", row); err != nil {
+			return err
+		}
+		columns, err := insertWidth(ast, targets, width)
+		if err != nil {
+			return err
+		}
+
+		for i, value := range row.Children {
+			if value.Type == parser.DefaultNode {
+				continue
+			}
+			valueType, err := db.typeOf(value, scope)
+			if err != nil {
+				return err
+			}
+			if err := checkStorable(valueType, table.Columns[columns[i]]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// analyzeUpdate checks the columns an UPDATE changes and that their new values, which are computed from
+// the old row, can be stored in them.
+// UpdateNode -> [WithNode], TableNameNode, SetListNode -> AssignmentNode -> value, ..., [WhereNode]
+func (db *Database) analyzeUpdate(ast narytree.Node) error {
+	table, err := db.table(childOfType(ast, parser.TableNameNode).Data)
+	if err != nil {
+		return err
+	}
+
+	outer := &analysisScope{}
+	if with := childOfType(ast, parser.WithNode); with.Type != "" {
+		if outer, err = db.analyzeWith(with, nil); err != nil {
+			return err
+		}
+	}
+	scope := &analysisScope{ relation: tableRelation(table, table.Name), outer: outer }
+
+	seen := map[string]bool{}
+	for _, assignment := range childOfType(ast, parser.SetListNode).Children {
+		index := table.columnIndex(assignment.Data)
+		if index == -1 {
+			return fmt.Errorf("column '%s' does not exist in table '%s'", assignment.Data, table.Name)
+		}
+		if seen[assignment.Data] {
+			return fmt.Errorf("column '%s' is assigned more than once", assignment.Data)
+		}
+		seen[assignment.Data] = true
+
+		value := assignment.Children[0]
+		if value.Type == parser.DefaultNode {
+			continue
+		}
+		if err := noAggregates("UPDATE", value); err != nil {
+			return err
+		}
+		if err := noWindowFunctions("UPDATE", value); err != nil {
+			return err
+		}
+		valueType, err := db.typeOf(value, scope)
+		if err != nil {
+			return err
+		}
+		if err := checkStorable(valueType, table.Columns[index]); err != nil {
+			return err
+		}
+	}
+
+	where := childOfType(ast, parser.WhereNode)
+	if err := noAggregates("WHERE", where); err != nil {
+		return err
+	}
+	if err := noWindowFunctions("WHERE", where); err != nil {
+		return err
+	}
+	return db.analyzeCondition("WHERE", where, scope)
+}
+
+// insertTargets returns the positions of the columns an INSERT stores its values in: the listed columns,
+// or every column of the table in order when there is no column list.
+// InsertNode -> TableNameNode, [ColumnListNode -> IdentifierNode, ...], ...
+func insertTargets(ast narytree.Node, table *Table) ([]int, error) {
+	columnList := childOfType(ast, parser.ColumnListNode)
+	if columnList.Type == "" {
+		targets := make([]int, len(table.Columns))
+		for i := range targets {
+			targets[i] = i
+		}
+		return targets, nil
+	}
+
+	var targets []int
+	seen := map[int]bool{}
+	for _, columnNode := range columnList.Children {
+		index := table.columnIndex(columnNode.Data)
+		if index == -1 {
+			return nil, fmt.Errorf("column '%s' does not exist in table '%s'", columnNode.Data, table.Name)
+		}
+		if seen[index] {
+			return nil, fmt.Errorf("column '%s' is specified more than once", columnNode.Data)
+		}
+		seen[index] = true
+		targets = append(targets, index)
+	}
+	return targets, nil
+}
+
+// insertWidth checks that the rows of an INSERT have a value for every target column and returns the
+// target columns that get one. Without a column list the values can stop short of the end of the table,
+// and the columns after them are left to their default.
+func insertWidth(ast narytree.Node, targets []int, width int) ([]int, error) {
+	listed := childOfType(ast, parser.ColumnListNode).Type != ""
+	if width > len(targets) || (listed && width < len(targets)) {
+		return nil, fmt.Errorf("INSERT has %d columns but %d values", len(targets), width)
+	}
+	return targets[:width], nil
+}
+
+// checkStorable reports an error if values of the given type can't be stored in column.
+func checkStorable(valueType Type, column Column) error {
+	if !storable(valueType, columnType(column)) {
+		return fmt.Errorf("cannot store %s value in column '%s' of type %s", valueType, column.Name, column.Type)
+	}
+	return nil
+}
+
+// analyzeSelect checks a query and returns the columns of its result. outer is the scope of the query it
+// is a subquery of, or nil.
+func (db *Database) analyzeSelect(ast narytree.Node, outer *analysisScope) (*relation, error) {
+	if with := childOfType(ast, parser.WithNode); with.Type != "" {
+		var err error
+		if outer, err = db.analyzeWith(with, outer); err != nil {
+			return nil, err
+		}
+	}
+	if childOfType(ast, parser.SetOperationNode).Type != "" {
+		return db.analyzeCompound(ast, outer)
+	}
+
+	rel, err := db.analyzeFrom(childOfType(ast, parser.FromNode), outer)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := &analysisScope{ relation: rel, outer: outer }
+
+	where := childOfType(ast, parser.WhereNode)
+	if err := noAggregates("WHERE", where); err != nil {
+		return nil, err
+	}
+	if err := noWindowFunctions("WHERE", where); err != nil {
+		return nil, err
+	}
+	if err := db.analyzeCondition("WHERE", where, scope); err != nil {
+		return nil, err
+	}
+
+	columns, err := expandSelectList(childOfType(ast, parser.ColumnListNode), scope.relation)
+	if err != nil {
+		return nil, err
+	}
+
+	// expressions of ORDER BY and DISTINCT ON become extra columns, so they are checked along with the
+	// select list
+	visible := len(columns)
+	columns, keys, err := sortOutputs(childOfType(ast, parser.OrderByNode), columns, visible, rel)
+	if err != nil {
+		return nil, err
+	}
+	if distinct := childOfType(ast, parser.DistinctNode); distinct.Type != "" {
+		var compared []int
+		if columns, compared, err = distinctOutputs(distinct, columns, visible, rel); err != nil {
+			return nil, err
+		}
+		if _, err := distinctSortKeys(distinct, compared, keys, visible); err != nil {
+			return nil, err
+		}
+	}
+
+	having := childOfType(ast, parser.HavingNode)
+	if err := noWindowFunctions("HAVING", having); err != nil {
+		return nil, err
+	}
+	group, err := db.newGrouping(childOfType(ast, parser.GroupByNode), having, columns, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if group != nil {
+		// the select list and HAVING are computed from the groups, not from the rows of the tables
+		scope = &analysisScope{ relation: group.rel, outer: outer }
+		if columns, having, err = group.rewriteClauses(columns, having); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &relation{}
+	for i, column := range columns {
+		columnType, err := db.typeOf(column.expression, scope)
+		if err != nil {
+			return nil, err
+		}
+		if i < visible {
+			result.columns = append(result.columns, relationColumn{ name: column.name, typ: columnType })
+		}
+	}
+	if err := db.analyzeCondition("HAVING", having, scope); err != nil {
+		return nil, err
+	}
+
+	if err := db.analyzeRowCount("LIMIT", childOfType(ast, parser.LimitNode), outer); err != nil {
+		return nil, err
+	}
+	if err := db.analyzeRowCount("OFFSET", childOfType(ast, parser.OffsetNode), outer); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// analyzeRowCount checks the number of rows given to LIMIT or OFFSET. It is computed once before the query
+// runs, so it can't refer to the query's own columns, only to those of the queries around it.
+// LimitNode -> expression
+// OffsetNode -> expression
+func (db *Database) analyzeRowCount(clause string, clauseNode narytree.Node, outer *analysisScope) error {
+	if len(clauseNode.Children) == 0 {
+		return nil
+	}
+
+	if err := noAggregates(clause, clauseNode); err != nil {
+		return err
+	}
+	if err := noWindowFunctions(clause, clauseNode); err != nil {
+		return err
+	}
+	countType, err := db.typeOf(clauseNode.Children[0], &analysisScope{ outer: outer })
+	if err != nil {
+		return err
+	}
+	if !assignable(countType, TypeInt) {
+		return fmt.Errorf("%s must be INT but got %s", clause, countType)
+	}
+	return nil
+}
+
+// analyzeFrom checks the tables of a FROM clause and returns the columns they make up together. No two
+// tables may go by the same name, so 'FROM users, users' needs an alias for one of them. Subqueries in
+// FROM can only refer to the queries around this one, whose scope is outer.
+// FromNode -> TableNameNode, SubqueryNode or JoinNode, ...
+func (db *Database) analyzeFrom(from narytree.Node, outer *analysisScope) (*relation, error) {
+	rel := &relation{}
+	seen := map[string]bool{}
+
+	for _, tableExpression := range from.Children {
+		tableRel, err := db.analyzeTableExpression(tableExpression, seen, outer)
+		if err != nil {
+			return nil, err
+		}
+		rel = rel.join(tableRel)
+	}
+	return rel, nil
+}
+
+// analyzeTableExpression checks a table of the FROM clause, a subquery or a join. The condition of a join
+// can use the columns of both sides.
+// TableNameNode -> [AliasNode]
+// SubqueryNode -> SelectNode, AliasNode
+// JoinNode -> left, right, [OnNode -> condition | UsingNode -> IdentifierNode, ...]
+func (db *Database) analyzeTableExpression(node narytree.Node, seen map[string]bool, outer *analysisScope) (*relation, error) {
+	if node.Type == parser.TableNameNode || node.Type == parser.SubqueryNode {
+		name := referenceName(node)
+		if seen[name] {
+			return nil, fmt.Errorf("table name '%s' is used more than once in the FROM clause", name)
+		}
+		seen[name] = true
+
+		if node.Type == parser.SubqueryNode {
+			rel, err := db.analyzeSelect(node.Children[0], outer)
+			if err != nil {
+				return nil, err
+			}
+			return rel.renamed(name), nil
+		}
+
+		if table := outer.commonTable(node.Data); table != nil {
+			return table.rel.renamed(name), nil
+		}
+		table, err := db.table(node.Data)
+		if err != nil {
+			return nil, err
+		}
+		return tableRelation(table, name), nil
+	}
+
+	left, err := db.analyzeTableExpression(node.Children[0], seen, outer)
+	if err != nil {
+		return nil, err
+	}
+	right, err := db.analyzeTableExpression(node.Children[1], seen, outer)
+	if err != nil {
+		return nil, err
+	}
+
+	if using := childOfType(node, parser.UsingNode); using.Type != "" {
+		joined, _, err := left.usingJoin(right, usingNames(using))
+		return joined, err
+	}
+
+	joined := left.join(right)
+	if on := childOfType(node, parser.OnNode); on.Type != "" {
+		if err := noAggregates("ON", on); err != nil {
+			return nil, err
+		}
+		if err := noWindowFunctions("ON", on); err != nil {
+			return nil, err
+		}
+		if err := db.analyzeCondition("ON", on, &analysisScope{ relation: joined, outer: outer }); err != nil {
+			return nil, err
+		}
+	}
+	return joined, nil
+}
+
+// analyzeCondition checks the expression of a clause like WHERE, which has to be a boolean.
+func (db *Database) analyzeCondition(clause string, clauseNode narytree.Node, scope *analysisScope) error {
+	if len(clauseNode.Children) == 0 {
+		return nil
+	}
+
+	conditionType, err := db.typeOf(clauseNode.Children[0], scope)
+	if err != nil {
+		return err
+	}
+	if !assignable(conditionType, TypeBoolean) {
+		return fmt.Errorf("%s condition must be BOOLEAN but got %s", clause, conditionType)
+	}
+	return nil
+}
+
+// typeOf works out the type of an expression, failing if it refers to something that doesn't exist or
+// combines values that don't fit together.
+func (db *Database) typeOf(node narytree.Node, scope *analysisScope) (Type, error) {
+	switch node.Type {
+		case parser.StringLiteralNode:
+			return TypeText, nil
+
+		case parser.NumberLiteralNode:
+			if _, isInt := node.Value.(int64); isInt {
+				return TypeInt, nil
+			}
+			return TypeDouble, nil
+
+		case parser.NullLiteralNode:
+			return TypeNull, nil
+
+		case parser.BooleanLiteralNode:
+			return TypeBoolean, nil
+
+		case parser.ParameterNode:
+			return TypeAny, nil // only known once the statement runs
+
+		case parser.IdentifierNode, parser.QualifiedNameNode:
+			return scope.columnType(node)
+
+		case slotNode:
+			return scope.relation.columns[slotIndex(node)].typ, nil
+
+		case parser.StarNode:
+			return "", fmt.Errorf("'*' can only be used on its own in a select list")
+
+		case parser.UnaryOperationNode:
+			operator := node.Children[0].Data
+			operandType, err := db.typeOf(node.Children[1], scope)
+			if err != nil {
+				return "", err
+			}
+			if operator == "NOT" {
+				return expectType(operandType, TypeBoolean, "NOT")
+			}
+			if !assignable(operandType, TypeNumber) {
+				return "", fmt.Errorf("unary '%s' expects a number but got %s", operator, operandType)
+			}
+			return operandType, nil
+
+		case parser.BinaryOperationNode:
+			return db.typeOfBinaryOperation(node, scope)
+
+		case parser.InListNode, parser.BetweenNode:
+			tested, err := db.typeOf(node.Children[0], scope)
+			if err != nil {
+				return "", err
+			}
+			for _, child := range node.Children[1:] {
+				childType, err := db.typeOf(child, scope)
+				if err != nil {
+					return "", err
+				}
+				if !comparable(tested, childType) {
+					return "", fmt.Errorf("%s cannot compare %s with %s", node.Data, tested, childType)
+				}
+			}
+			return TypeBoolean, nil
+
+		case parser.SubqueryNode:
+			return db.typeOfScalarSubquery(node, scope)
+
+		case parser.ExistsNode:
+			// EXISTS only cares whether there are rows, so the subquery can return any number of columns
+			if _, err := db.analyzeSelect(node.Children[0].Children[0], scope); err != nil {
+				return "", err
+			}
+			return TypeBoolean, nil
+
+		case parser.InSubqueryNode, parser.QuantifiedNode:
+			tested, err := db.typeOf(node.Children[0], scope)
+			if err != nil {
+				return "", err
+			}
+			rowType, err := db.typeOfScalarSubquery(node.Children[1], scope)
+			if err != nil {
+				return "", err
+			}
+			if !comparable(tested, rowType) {
+				return "", fmt.Errorf("%s cannot compare %s with %s", node.Data, tested, rowType)
+			}
+			return TypeBoolean, nil
+
+		case parser.LikeNode:
+			for _, child := range node.Children {
+				childType, err := db.typeOf(child, scope)
+				if err != nil {
+					return "", err
+				}
+				if _, err := expectType(childType, TypeText, node.Data); err != nil {
+					return "", err
+				}
+			}
+			return TypeBoolean, nil
+
+		case parser.IsNullNode:
+			if _, err := db.typeOf(node.Children[0], scope); err != nil {
+				return "", err
+			}
+			return TypeBoolean, nil
+
+		case parser.CaseNode:
+			return db.typeOfCase(node, scope)
+
+		case parser.WindowFunctionNode:
+			return db.typeOfWindowFunction(node, scope)
+
+		case parser.FunctionCallNode:
+			if isAggregateCall(node) {
+				return "", fmt.Errorf("aggregate function %s is not allowed here", node.Data)
+			}
+			function, ok := db.functions.Lookup(node.Data)
+			if !ok {
+				if windowFunction, isWindowFunction := windowFunctions[strings.ToUpper(node.Data)]; isWindowFunction {
+					return "", fmt.Errorf("window function %s requires an OVER clause", windowFunction.Name)
+				}
+				return "", fmt.Errorf("function '%s' does not exist", node.Data)
+			}
+
+			var argTypes []Type
+			for _, argument := range node.Children {
+				if argument.Type == parser.StarNode {
+					return "", fmt.Errorf("function %s does not accept '*'", function.Name)
+				}
+				if argument.Type == parser.DistinctNode {
+					return "", fmt.Errorf("DISTINCT is only allowed in aggregate functions, not in %s", function.Name)
+				}
+				argType, err := db.typeOf(argument, scope)
+				if err != nil {
+					return "", err
+				}
+				argTypes = append(argTypes, argType)
+			}
+			return function.checkArgs(argTypes)
+
+		default:
+			return "", fmt.Errorf("unexpected %s in expression", node.Type)
+	}
+}
+
+// BinaryOperationNode -> Left, Operator, Right
+func (db *Database) typeOfBinaryOperation(node narytree.Node, scope *analysisScope) (Type, error) {
+	operator := node.Children[1].Data
+
+	left, err := db.typeOf(node.Children[0].Children[0], scope)
+	if err != nil {
+		return "", err
+	}
+	right, err := db.typeOf(node.Children[2].Children[0], scope)
+	if err != nil {
+		return "", err
+	}
+
+	switch operator {
+		case "AND", "OR":
+			if _, err := expectType(left, TypeBoolean, operator); err != nil {
+				return "", err
+			}
+			return expectType(right, TypeBoolean, operator)
+
+		case "+", "-", "*", "/":
+			if !assignable(left, TypeNumber) || !assignable(right, TypeNumber) {
+				return "", fmt.Errorf("cannot apply '%s' to %s and %s", operator, left, right)
+			}
+			switch {
+				case left == TypeInt && right == TypeInt:
+					return TypeInt, nil
+				case left == TypeDouble || right == TypeDouble:
+					return TypeDouble, nil
+				default:
+					return TypeAny, nil
+			}
+
+		default:
+			if !comparable(left, right) {
+				return "", fmt.Errorf("cannot compare %s with %s", left, right)
+			}
+			return TypeBoolean, nil
+	}
+}
+
+// typeOfCase checks the branches of a CASE and returns the type they all share.
+// CaseNode -> [operand], WhenNode -> value or condition, result, ..., [ElseNode -> result]
+func (db *Database) typeOfCase(node narytree.Node, scope *analysisScope) (Type, error) {
+	branches := node.Children
+	var operandType Type
+	simple := len(branches) > 0 && branches[0].Type != parser.WhenNode
+
+	if simple {
+		var err error
+		operandType, err = db.typeOf(branches[0], scope)
+		if err != nil {
+			return "", err
+		}
+		branches = branches[1:]
+	}
+
+	resultType := TypeNull
+	for _, branch := range branches {
+		resultNode := branch.Children[len(branch.Children) - 1]
+
+		if branch.Type == parser.WhenNode {
+			whenType, err := db.typeOf(branch.Children[0], scope)
+			if err != nil {
+				return "", err
+			}
+			if simple && !comparable(operandType, whenType) {
+				return "", fmt.Errorf("CASE cannot compare %s with %s", operandType, whenType)
+			}
+			if !simple && !assignable(whenType, TypeBoolean) {
+				return "", fmt.Errorf("WHEN condition must be BOOLEAN but got %s", whenType)
+			}
+		}
+
+		branchType, err := db.typeOf(resultNode, scope)
+		if err != nil {
+			return "", err
+		}
+		resultType, err = commonType(resultType, branchType)
+		if err != nil {
+			return "", fmt.Errorf("CASE branches have different types: %w", err)
+		}
+	}
+
+	return resultType, nil
+}
+
+// columnType is the type of the values stored in a column.
+func columnType(column Column) Type {
+	switch column.Type {
+		case "INT":
+			return TypeInt
+		case "FLOAT", "DOUBLE":
+			return TypeDouble
+		case "VARCHAR", "TEXT":
+			return TypeText
+		case "BOOLEAN":
+			return TypeBoolean
+		case "DATE":
+			return TypeDate
+	}
+	return TypeAny
+}
+
+// assignable reports whether a value of type actual can be used where expected is wanted. NULL and
+// parameters, whose type isn't known yet, fit everywhere.
+func assignable(actual Type, expected Type) bool {
+	switch {
+		case actual == expected, expected == TypeAny, actual == TypeAny, actual == TypeNull:
+			return true
+		case expected == TypeNumber:
+			return actual == TypeInt || actual == TypeDouble
+		case expected == TypeDouble:
+			return actual == TypeInt
+		case expected == TypeText:
+			return actual == TypeDate // dates are stored as text
+		case expected == TypeDate:
+			return actual == TypeText // a date is written as a string, '2024-01-31'
+	}
+	return false
+}
+
+// storable is like assignable but for storing a value into a column. Whole DOUBLEs can go into INT
+// columns, which is checked against the actual value when the row is written.
+func storable(actual Type, column Type) bool {
+	return assignable(actual, column) || (column == TypeInt && actual == TypeDouble)
+}
+
+// comparable reports whether values of the two types can be compared with each other.
+func comparable(a Type, b Type) bool {
+	return assignable(a, b) || assignable(b, a) || (assignable(a, TypeNumber) && assignable(b, TypeNumber))
+}
+
+// commonType is the type that values of both types can be converted to, used for the result of CASE.
+func commonType(a Type, b Type) (Type, error) {
+	switch {
+		case a == TypeNull || a == b:
+			return b, nil
+		case b == TypeNull:
+			return a, nil
+		case a == TypeAny || b == TypeAny:
+			return TypeAny, nil
+		case assignable(a, TypeNumber) && assignable(b, TypeNumber):
+			return TypeDouble, nil
+		case comparable(a, b):
+			return TypeText, nil // TEXT and DATE
+	}
+	return "", fmt.Errorf("%s and %s", a, b)
+}
+
+// expectType fails unless actual can be used where expected is wanted, and returns expected.
+func expectType(actual Type, expected Type, operator string) (Type, error) {
+	if !assignable(actual, expected) {
+		return "", fmt.Errorf("%s expects %s but got %s", operator, expected, actual)
+	}
+	return expected, nil
+}
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const dateLayout = "2006-01-02"
+
+// Column describes a single column of a table. Size is the length given to types like VARCHAR(20), or 0
+// when there is none.
+type Column struct {
+	Name string
+	Type string
+	Size int
+}
+
+// Table is a table in the catalog along with all of its rows. Every row holds one value per column, in
+// the same order as Columns.
+type Table struct {
+	Name    string
+	Columns []Column
+	Rows    [][]any
+}
+
+// Names are compared exactly: the lexer has already case folded unquoted identifiers and left quoted
+// ones alone, so "Users" and users are different tables on purpose.
+
+func (db *Database) table(name string) (*Table, error) {
+	table, ok := db.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("table '%s' does not exist", name)
+	}
+	return table, nil
+}
+
+// Table returns the definition of a table, or nil if there is no table with that name.
+func (db *Database) Table(name string) *Table {
+	return db.tables[name]
+}
+
+// columnIndex returns the position of the column with the given name, or -1 if there is none.
+func (t *Table) columnIndex(name string) int {
+	for i, column := range t.Columns {
+		if column.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// coerce converts value into the type of the column, or fails if it can't be stored there.
+func (c Column) coerce(value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch c.Type {
+		case "INT":
+			switch v := value.(type) {
+				case int64:
+					return v, nil
+				case float64:
+					if v != math.Trunc(v) || v > math.MaxInt64 || v < math.MinInt64 {
+						return nil, fmt.Errorf("value %v for column '%s' is not an integer", v, c.Name)
+					}
+					return int64(v), nil
+			}
+
+		case "FLOAT", "DOUBLE":
+			if f, ok := toFloat(value); ok {
+				return f, nil
+			}
+
+		case "VARCHAR", "TEXT":
+			if s, ok := value.(string); ok {
+				if c.Size > 0 && utf8.RuneCountInString(s) > c.Size {
+					return nil, fmt.Errorf("value '%s' is too long for column '%s' of type VARCHAR(%d)", s, c.Name, c.Size)
+				}
+				return s, nil
+			}
+
+		case "BOOLEAN":
+			if b, ok := value.(bool); ok {
+				return b, nil
+			}
+
+		case "DATE":
+			if s, ok := value.(string); ok {
+				if _, err := time.Parse(dateLayout, s); err != nil {
+					return nil, fmt.Errorf("value '%s' for column '%s' is not a date in the form YYYY-MM-DD", s, c.Name)
+				}
+				return s, nil
+			}
+	}
+
+	return nil, fmt.Errorf("cannot store %s value %s in column '%s' of type %s", typeName(value), formatValue(value), c.Name, c.Type)
+}
+
+// formatValue renders a value the way it would be written in a query.
+func formatValue(value any) string {
+	switch v := value.(type) {
+		case nil:
+			return "NULL"
+		case string:
+			return "'" + v + "'"
+		case int64:
+			return strconv.FormatInt(v, 10)
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		case bool:
+			if v {
+				return "TRUE"
+			}
+			return "FALSE"
+		default:
+			return fmt.Sprint(v)
+	}
+}
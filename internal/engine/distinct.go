@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// SELECT DISTINCT removes rows of the result that are equal to an earlier row. With DISTINCT ON only the
+// listed expressions are compared, and the first row of each set of rows that are equal on them is kept,
+// which is the first one in the order of ORDER BY.
+//
+// There are two ways to find the duplicates. Hashing remembers every distinct row seen so far and works
+// on rows in any order. Sorting puts equal rows next to each other, after which a row only has to be
+// compared with the one before it. The planner sorts when the query has ORDER BY, since its rows are
+// sorted anyway, and hashes otherwise.
+
+// distinctOutputs works out which outputs DISTINCT compares: all the columns of the result, or for
+// DISTINCT ON the listed expressions, which are added to outputs like the items of ORDER BY if they aren't
+// columns of the result.
+// DistinctNode -> expression, ...
+func distinctOutputs(distinct narytree.Node, outputs []outputColumn, visible int, rel *relation) ([]outputColumn, []int, error) {
+	var columns []int
+
+	if len(distinct.Children) == 0 {
+		for i := 0; i < visible; i++ {
+			columns = append(columns, i)
+		}
+		return outputs, columns, nil
+	}
+
+	for _, expression := range distinct.Children {
+		var column int
+		var err error
+		if outputs, column, err = resultColumn("DISTINCT ON", expression, outputs, visible, rel); err != nil {
+			return nil, nil, err
+		}
+		columns = append(columns, column)
+	}
+	return outputs, columns, nil
+}
+
+// distinctSortKeys returns the sort keys that put the rows in the order of ORDER BY and also put rows
+// that DISTINCT sees as equal next to each other. That only works if ORDER BY sorts on the compared
+// columns first, so ORDER BY has to start with the expressions of DISTINCT ON, and with plain DISTINCT it
+// can only sort on columns of the result. The compared columns it leaves out are sorted on last. Without
+// ORDER BY there is nothing to sort on.
+func distinctSortKeys(distinct narytree.Node, columns []int, keys []sortKey, visible int) ([]sortKey, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	compared := map[int]bool{}
+	for _, column := range columns {
+		compared[column] = true
+	}
+
+	covered := map[int]bool{}
+	for _, key := range keys {
+		switch {
+			case len(distinct.Children) == 0 && key.column >= visible:
+				return nil, fmt.Errorf("for SELECT DISTINCT, ORDER BY expressions must appear in select list")
+			case len(distinct.Children) > 0 && len(covered) < len(compared) && !compared[key.column]:
+				return nil, fmt.Errorf("SELECT DISTINCT ON expressions must match initial ORDER BY expressions")
+		}
+		covered[key.column] = true
+	}
+
+	sortKeys := append([]sortKey{}, keys...)
+	for _, column := range columns {
+		if !covered[column] {
+			sortKeys = append(sortKeys, sortKey{ column: column })
+			covered[column] = true
+		}
+	}
+	return sortKeys, nil
+}
+
+// distinctKey is the part of row that DISTINCT compares, as a single string.
+func distinctKey(row []any, columns []int) string {
+	values := make([]any, len(columns))
+	for i, column := range columns {
+		values[i] = row[column]
+	}
+	return rowKey(values)
+}
+
+// hashDistinct passes on the first row of every set of rows that are equal on the compared columns.
+type hashDistinct struct {
+	input    operator
+	compared []int
+	seen     map[string]bool
+}
+
+func (o *hashDistinct) columns() *relation {
+	return o.input.columns()
+}
+
+func (o *hashDistinct) open(parent *scope) error {
+	o.seen = map[string]bool{}
+	return o.input.open(parent)
+}
+
+func (o *hashDistinct) next() ([]any, error) {
+	for {
+		row, err := o.input.next()
+		if err != nil || row == nil {
+			return nil, err
+		}
+
+		key := distinctKey(row, o.compared)
+		if !o.seen[key] {
+			o.seen[key] = true
+			return row, nil
+		}
+	}
+}
+
+// sortedDistinct is like hashDistinct for input that is sorted so that rows that are equal on the
+// compared columns come one after the other.
+type sortedDistinct struct {
+	input    operator
+	compared []int
+	previous string
+	started  bool
+}
+
+func (o *sortedDistinct) columns() *relation {
+	return o.input.columns()
+}
+
+func (o *sortedDistinct) open(parent *scope) error {
+	o.started = false
+	return o.input.open(parent)
+}
+
+func (o *sortedDistinct) next() ([]any, error) {
+	for {
+		row, err := o.input.next()
+		if err != nil || row == nil {
+			return nil, err
+		}
+
+		key := distinctKey(row, o.compared)
+		if !o.started || key != o.previous {
+			o.started = true
+			o.previous = key
+			return row, nil
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package engine
+
+import "testing"
+
+func TestDistinct(t *testing.T) {
+	runQueryTests(t, []queryTest{
+		{ "SELECT DISTINCT user_id FROM orders", "[[1] [2] [9]]" },
+		{ "SELECT DISTINCT active FROM users", "[[true] [false] [<nil>]]" },
+		{ "SELECT DISTINCT user_id FROM orders ORDER BY user_id DESC", "[[9] [2] [1]]" },
+		{ "SELECT DISTINCT ON (user_id) user_id, item FROM orders ORDER BY user_id, amount DESC", "[[1 lamp] [2 pen] [9 cup]]" },
+		{ "SELECT DISTINCT ON (user_id) item FROM orders ORDER BY amount", "error: SELECT DISTINCT ON expressions must match initial ORDER BY expressions" },
+		{ "SELECT DISTINCT user_id FROM orders ORDER BY amount", "error: for SELECT DISTINCT, ORDER BY expressions must appear in select list" },
+		{ "SELECT COUNT(*) FROM (SELECT DISTINCT user_id FROM orders) d", "[[3]]" },
+	})
+}
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/jasutiin/deebeejeebees/internal/lexer"
+	"github.com/jasutiin/deebeejeebees/internal/parser"
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// Database is an in-memory database. It keeps the catalog of tables along with their rows.
+type Database struct {
+	tables    map[string]*Table
+	functions *FunctionRegistry
+}
+
+// Result is what running a statement produces. Queries fill in Columns and Rows, statements that change
+// data report how many rows they touched in RowsAffected.
+type Result struct {
+	Columns      []string
+	Rows         [][]any
+	RowsAffected int
+}
+
+func NewDatabase() *Database {
+	return &Database{ tables: map[string]*Table{}, functions: newBuiltinFunctions() }
+}
+
+// RegisterFunction makes a Go function callable from SQL. It replaces a built-in function of the same
+// name.
+func (db *Database) RegisterFunction(function Function) error {
+	return db.functions.Register(function)
+}
+
+// Exec runs a single SQL statement. Parameters in the query ($1, ? or :name) are bound to args: positional
+// parameters take the arguments in order and named ones take the argument passed as Named(name, value).
+// Values are never spliced into the query text, so they can't change the meaning of the statement.
+func (db *Database) Exec(query string, args ...any) (*Result, error) {
+	tokens, err := lexer.AnalyzeString(query)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := bindParameters(tokens, args)
+	if err != nil {
+		return nil, err
+	}
+
+	cst, err := parser.ParseTokensToCST(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	ast, err := parser.ConvertToAST(cst)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.execute(ast, params)
+}
+
+// ExecScript runs every statement of a script, such as a .sql file with a schema and its seed data, in
+// order and returns one result per statement. Nothing is run if the script has syntax errors, and it stops
+// at the first statement that fails. Parameters are numbered across the whole script and all statements
+// share args.
+func (db *Database) ExecScript(script string, args ...any) ([]*Result, error) {
+	tokens, err := lexer.AnalyzeString(script)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := bindParameters(tokens, args)
+	if err != nil {
+		return nil, err
+	}
+
+	statements, err := parser.ParseScript(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*Result
+	for _, cst := range statements {
+		ast, err := parser.ConvertToAST(cst)
+		if err != nil {
+			return results, err
+		}
+
+		result, err := db.execute(ast, params)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// execution holds what the expressions of a running statement can refer to besides the current row.
+type execution struct {
+	db     *Database
+	params *parameters
+
+	// subqueries holds the plans of the subqueries that have run so far, by the SelectNode they were
+	// planned from, so that a subquery that runs once per row is only planned once.
+	subqueries map[*narytree.Node]operator
+}
+
+func (db *Database) execute(ast narytree.Node, params *parameters) (*Result, error) {
+	if err := db.analyze(ast); err != nil {
+		return nil, err
+	}
+
+	exec := &execution{ db: db, params: params, subqueries: map[*narytree.Node]operator{} }
+
+	switch ast.Type {
+		case parser.CreateTableNode:
+			return db.executeCreateTable(ast)
+		case parser.InsertNode:
+			return db.executeInsert(ast, exec)
+		case parser.UpdateNode:
+			return db.executeUpdate(ast, exec)
+		case parser.SelectNode:
+			return db.executeSelect(ast, exec)
+		default:
+			return nil, fmt.Errorf("unsupported statement")
+	}
+}
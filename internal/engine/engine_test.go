@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testSchema is the database the engine tests run their queries against, one statement at a time.
+var testSchema = []string{
+	"CREATE TABLE users (id INT, name VARCHAR(10), score DOUBLE, active BOOLEAN, joined DATE)",
+	"INSERT INTO users (id, name, score, active, joined) VALUES (1, 'bob', 2.5, TRUE, '2024-01-05')",
+	"INSERT INTO users (id, name, score, active, joined) VALUES (2, 'alice', -3, FALSE, '2023-11-20')",
+	"INSERT INTO users (id, name) VALUES (3, 'carol')",
+	"INSERT INTO users (id, name, score, joined) VALUES (4, 'dave', 10, '2024-03-01')",
+	"CREATE TABLE orders (id INT, user_id INT, amount DOUBLE, item TEXT)",
+	"INSERT INTO orders (id, user_id, amount, item) VALUES (10, 1, 9.5, 'book')",
+	"INSERT INTO orders (id, user_id, amount, item) VALUES (11, 1, 20, 'lamp')",
+	"INSERT INTO orders (id, user_id, amount, item) VALUES (12, 2, 5, 'pen')",
+	"INSERT INTO orders (id, user_id, amount, item) VALUES (13, 9, 7, 'cup')",
+}
+
+// queryTest is a statement along with what running it should give, as rendered by runQuery.
+type queryTest struct {
+	query string
+	want  string
+}
+
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	db := NewDatabase()
+	for _, statement := range testSchema {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("loading the test schema failed at %q: %v", statement, err)
+		}
+	}
+	return db
+}
+
+// runQuery renders the outcome of a statement as a string: the rows of a query, "affected N" for a
+// statement that doesn't return rows or "error: ..." when it fails.
+func runQuery(db *Database, query string, args ...any) string {
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	if result.Columns == nil {
+		return fmt.Sprintf("affected %d", result.RowsAffected)
+	}
+	return fmt.Sprint(result.Rows)
+}
+
+// runQueryTests runs the statements in order against one fresh test database, so later statements see
+// what earlier ones changed.
+func runQueryTests(t *testing.T, tests []queryTest) {
+	t.Helper()
+	db := newTestDatabase(t)
+	for _, test := range tests {
+		if got := runQuery(db, test.query); got != test.want {
+			t.Errorf("%s\n  got  %s\n  want %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestExecScript(t *testing.T) {
+	db := NewDatabase()
+	script := strings.Join(testSchema, ";\n") + ";\nSELECT id FROM orders WHERE user_id = 2; SELECT nope FROM users; SELECT id FROM users"
+	results, err := db.ExecScript(script)
+	if err == nil || err.Error() != "column 'nope' does not exist in table 'users'" {
+		t.Fatalf("ExecScript should stop at the failing statement, got %v", err)
+	}
+	if len(results) != len(testSchema) + 1 || fmt.Sprint(results[len(testSchema)].Rows) != "[[12]]" {
+		t.Errorf("ExecScript should return the results of the statements before the failing one, got %d", len(results))
+	}
+
+	if _, err := db.ExecScript("CREATE TABLE x (a INT); SELEC 1"); err == nil {
+		t.Errorf("ExecScript should refuse a script with syntax errors")
+	}
+	if db.Table("x") != nil {
+		t.Errorf("nothing should run when a script has syntax errors")
+	}
+}
@@ -0,0 +1,407 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jasutiin/deebeejeebees/internal/parser"
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// scope is what an expression is evaluated against: the current row, what its columns are, and the
+// running statement. Inside a subquery, outer is the scope of the query around it. A scope added by WITH
+// has no row, only the queries WITH named.
+type scope struct {
+	relation     *relation
+	row          []any
+	exec         *execution
+	outer        *scope
+	commonTables map[string]*commonTable
+}
+
+// rowScope is the scope for evaluating expressions against row, whose columns are described by r. Names
+// that aren't columns of row are looked up in s.
+func (s *scope) rowScope(r *relation, row []any) *scope {
+	return &scope{ relation: r, row: row, exec: s.exec, outer: s }
+}
+
+// column returns the value of the column a name refers to, looking in the scopes around s for names that
+// don't belong to its own row.
+func (s *scope) column(node narytree.Node) (any, error) {
+	for current := s; current != nil; current = current.outer {
+		if current.relation == nil || !current.relation.binds(node) {
+			continue
+		}
+		index, err := current.relation.resolveColumn(node)
+		if err != nil {
+			return nil, err
+		}
+		return current.row[index], nil
+	}
+	return nil, fmt.Errorf("column '%s' does not exist", columnName(node))
+}
+
+// analysisScope describes s the way semantic analysis sees it, for planning a subquery while the
+// statement runs.
+func (s *scope) analysisScope() *analysisScope {
+	if s == nil {
+		return nil
+	}
+	return &analysisScope{ relation: s.relation, outer: s.outer.analysisScope(), commonTables: s.commonTables }
+}
+
+// evalExpression computes the value of an expression node of the AST. NULL is nil, and since SQL uses
+// three-valued logic a boolean expression can be true, false or nil for unknown.
+func evalExpression(node narytree.Node, s *scope) (any, error) {
+	switch node.Type {
+		case parser.StringLiteralNode:
+			return node.Data, nil
+
+		case parser.NumberLiteralNode:
+			return node.Value, nil
+
+		case parser.NullLiteralNode:
+			return nil, nil
+
+		case parser.BooleanLiteralNode:
+			return node.Data == "TRUE", nil
+
+		case parser.ParameterNode:
+			return s.exec.params.lookup(node.Data)
+
+		case parser.IdentifierNode, parser.QualifiedNameNode:
+			return s.column(node)
+
+		case slotNode:
+			return s.row[slotIndex(node)], nil
+
+		case parser.UnaryOperationNode:
+			return evalUnaryOperation(node, s)
+
+		case parser.BinaryOperationNode:
+			return evalBinaryOperation(node, s)
+
+		case parser.InListNode:
+			return evalInList(node, s)
+
+		case parser.BetweenNode:
+			return evalBetween(node, s)
+
+		case parser.LikeNode:
+			return evalLike(node, s)
+
+		case parser.CaseNode:
+			return evalCase(node, s)
+
+		case parser.SubqueryNode:
+			return evalScalarSubquery(node, s)
+
+		case parser.ExistsNode:
+			return evalExists(node, s)
+
+		case parser.InSubqueryNode, parser.QuantifiedNode:
+			return evalQuantified(node, s)
+
+		case parser.WindowFunctionNode:
+			return nil, fmt.Errorf("window function %s is not allowed here", node.Data)
+
+		case parser.FunctionCallNode:
+			if isAggregateCall(node) {
+				return nil, fmt.Errorf("aggregate function %s is not allowed here", node.Data)
+			}
+			function, ok := s.exec.db.functions.Lookup(node.Data)
+			if !ok {
+				return nil, fmt.Errorf("function '%s' does not exist", node.Data)
+			}
+
+			args := make([]any, len(node.Children))
+			for i, argument := range node.Children {
+				value, err := evalExpression(argument, s)
+				if err != nil {
+					return nil, err
+				}
+				args[i] = value
+			}
+			return function.call(args)
+
+		case parser.IsNullNode:
+			value, err := evalExpression(node.Children[0], s)
+			if err != nil {
+				return nil, err
+			}
+			return (value == nil) == (node.Data == "IS NULL"), nil
+
+		default:
+			return nil, fmt.Errorf("cannot evaluate %s '%s'", node.Type, node.Data)
+	}
+}
+
+// UnaryOperationNode -> Operator, operand
+func evalUnaryOperation(node narytree.Node, s *scope) (any, error) {
+	operator := node.Children[0].Data
+	operand, err := evalExpression(node.Children[1], s)
+	if err != nil || operand == nil {
+		return nil, err
+	}
+
+	switch operator {
+		case "NOT":
+			b, ok := operand.(bool)
+			if !ok {
+				return nil, fmt.Errorf("NOT expects a BOOLEAN but got %s", typeName(operand))
+			}
+			return !b, nil
+		case "-":
+			switch v := operand.(type) {
+				case int64:
+					if v == math.MinInt64 {
+						return nil, fmt.Errorf("integer out of range")
+					}
+					return -v, nil
+				case float64:
+					return -v, nil
+			}
+			return nil, fmt.Errorf("cannot negate %s", typeName(operand))
+		case "+":
+			if _, ok := toFloat(operand); !ok {
+				return nil, fmt.Errorf("unary '+' expects a number but got %s", typeName(operand))
+			}
+			return operand, nil
+		default:
+			return nil, fmt.Errorf("unknown operator '%s'", operator)
+	}
+}
+
+// BinaryOperationNode -> Left, Operator, Right
+func evalBinaryOperation(node narytree.Node, s *scope) (any, error) {
+	operator := node.Children[1].Data
+
+	left, err := evalExpression(node.Children[0].Children[0], s)
+	if err != nil {
+		return nil, err
+	}
+
+	if operator == "AND" || operator == "OR" {
+		return evalLogical(operator, left, node.Children[2].Children[0], s)
+	}
+
+	right, err := evalExpression(node.Children[2].Children[0], s)
+	if err != nil {
+		return nil, err
+	}
+
+	// anything compared or calculated with NULL is NULL
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	switch operator {
+		case "+", "-", "*", "/":
+			return evalArithmetic(operator, left, right)
+		default:
+			return compareWith(operator, left, right)
+	}
+}
+
+// evalLogical implements AND and OR with three-valued logic. The right side is only evaluated when the
+// left side doesn't already decide the result, so 'FALSE AND x' never looks at x.
+func evalLogical(operator string, left any, rightNode narytree.Node, s *scope) (any, error) {
+	if left != nil {
+		if _, ok := left.(bool); !ok {
+			return nil, fmt.Errorf("%s expects BOOLEAN operands but got %s", operator, typeName(left))
+		}
+	}
+
+	if operator == "AND" && left == false {
+		return false, nil
+	}
+	if operator == "OR" && left == true {
+		return true, nil
+	}
+
+	right, err := evalExpression(rightNode, s)
+	if err != nil {
+		return nil, err
+	}
+	if right != nil {
+		if _, ok := right.(bool); !ok {
+			return nil, fmt.Errorf("%s expects BOOLEAN operands but got %s", operator, typeName(right))
+		}
+	}
+
+	// left is now either nil or the value that doesn't decide the result on its own
+	if right == nil || left == nil {
+		if operator == "AND" && right == false {
+			return false, nil
+		}
+		if operator == "OR" && right == true {
+			return true, nil
+		}
+		return nil, nil
+	}
+	return right, nil
+}
+
+// evalArithmetic applies '+', '-', '*' or '/' to two numbers. Integers stay integers, so 7 / 2 is 3, and as
+// soon as one side is a float the result is a float.
+func evalArithmetic(operator string, left any, right any) (any, error) {
+	li, leftIsInt := left.(int64)
+	ri, rightIsInt := right.(int64)
+
+	if leftIsInt && rightIsInt {
+		switch operator {
+			case "+":
+				sum := li + ri
+				if (ri > 0 && sum < li) || (ri < 0 && sum > li) {
+					return nil, fmt.Errorf("integer out of range")
+				}
+				return sum, nil
+			case "-":
+				difference := li - ri
+				if (ri > 0 && difference > li) || (ri < 0 && difference < li) {
+					return nil, fmt.Errorf("integer out of range")
+				}
+				return difference, nil
+			case "*":
+				product := li * ri
+				if li != 0 && (product / li != ri || (li == -1 && ri == math.MinInt64)) {
+					return nil, fmt.Errorf("integer out of range")
+				}
+				return product, nil
+			default:
+				if ri == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				if li == math.MinInt64 && ri == -1 {
+					return nil, fmt.Errorf("integer out of range")
+				}
+				return li / ri, nil
+		}
+	}
+
+	lf, leftIsNumber := toFloat(left)
+	rf, rightIsNumber := toFloat(right)
+	if !leftIsNumber || !rightIsNumber {
+		return nil, fmt.Errorf("cannot apply '%s' to %s and %s", operator, typeName(left), typeName(right))
+	}
+
+	var result float64
+	switch operator {
+		case "+":
+			result = lf + rf
+		case "-":
+			result = lf - rf
+		case "*":
+			result = lf * rf
+		default:
+			if rf == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			result = lf / rf
+	}
+
+	// like integers, floats report overflow instead of carrying on with infinity or NaN
+	if math.IsNaN(result) || (math.IsInf(result, 0) && !math.IsInf(lf, 0) && !math.IsInf(rf, 0)) {
+		return nil, fmt.Errorf("floating-point value out of range")
+	}
+	return result, nil
+}
+
+// evalCase picks the first WHEN branch that matches and evaluates only its result, so the other branches
+// are never computed; 'CASE WHEN x = 0 THEN 0 ELSE 1 / x END' can't divide by zero. Without a match the
+// result is the ELSE branch, or NULL if there is none.
+// CaseNode -> [operand], WhenNode -> value or condition, result, ..., [ElseNode -> result]
+func evalCase(node narytree.Node, s *scope) (any, error) {
+	branches := node.Children
+	var operand any
+	simple := len(branches) > 0 && branches[0].Type != parser.WhenNode
+
+	if simple {
+		value, err := evalExpression(branches[0], s)
+		if err != nil {
+			return nil, err
+		}
+		operand = value
+		branches = branches[1:]
+	}
+
+	for _, branch := range branches {
+		if branch.Type == parser.ElseNode {
+			return evalExpression(branch.Children[0], s)
+		}
+
+		var matches bool
+		if simple {
+			value, err := evalExpression(branch.Children[0], s)
+			if err != nil {
+				return nil, err
+			}
+			equal, err := compareNullable("=", operand, value)
+			if err != nil {
+				return nil, err
+			}
+			matches = equal == true
+		} else {
+			condition, err := evalCondition(branch.Children[0], s)
+			if err != nil {
+				return nil, err
+			}
+			matches = condition
+		}
+
+		if matches {
+			return evalExpression(branch.Children[1], s)
+		}
+	}
+
+	return nil, nil
+}
+
+// evalWhere decides whether the current row passes the WHERE clause. Only rows for which the condition is
+// true are kept; false and unknown (NULL) both leave the row out.
+func evalWhere(where narytree.Node, s *scope) (bool, error) {
+	if len(where.Children) == 0 {
+		return true, nil
+	}
+
+	return evalCondition(where.Children[0], s)
+}
+
+// evalCondition evaluates a boolean expression and treats unknown as false.
+func evalCondition(condition narytree.Node, s *scope) (bool, error) {
+	value, err := evalExpression(condition, s)
+	if err != nil || value == nil {
+		return false, err
+	}
+
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition must be a BOOLEAN but got %s", typeName(value))
+	}
+	return b, nil
+}
+
+// compareWith applies a comparison operator like '=' or '<>' to two non-NULL values.
+func compareWith(operator string, left any, right any) (bool, error) {
+	cmp, err := compareValues(left, right)
+	if err != nil {
+		return false, err
+	}
+
+	switch operator {
+		case "=":
+			return cmp == 0, nil
+		case "!=", "<>":
+			return cmp != 0, nil
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		case ">=":
+			return cmp >= 0, nil
+		default:
+			return false, fmt.Errorf("unknown operator '%s'", operator)
+	}
+}
@@ -0,0 +1,58 @@
+package engine
+
+import "testing"
+
+func TestExpressions(t *testing.T) {
+	runQueryTests(t, []queryTest{
+		{ "SELECT id FROM users WHERE id = 1 + 2 * 3 - 4", "[[3]]" },
+		{ "SELECT id FROM users WHERE (1 + 2) * 3 = 9 AND 7 / 2 = 3 AND 7.0 / 2 = 3.5 AND id = 1", "[[1]]" },
+		{ "SELECT id FROM users WHERE -id = -2 AND 10 - 2 - 3 = 5", "[[2]]" },
+		{ "SELECT id FROM users WHERE id / 0 = 1", "error: division by zero" },
+		{ "SELECT id FROM users WHERE NULL = NULL OR NULL + 1 > 0", "[]" },
+		{ "SELECT id FROM users WHERE NOT (NULL AND FALSE) AND id = 1", "[[1]]" },
+		{ "SELECT id FROM users WHERE CASE WHEN score > 5 THEN TRUE ELSE FALSE END", "[[4]]" },
+		{ "SELECT id FROM users WHERE CASE id WHEN 2 THEN TRUE END", "[[2]]" },
+		{ "SELECT 1 + 2 * 3, (1 + 2) * 3, 7 / 2, 7.0 / 2, -id, 10 - 2 - 3 FROM users WHERE id = 1", "[[7 9 3 3.5 -1 5]]" },
+		{ "SELECT 0x10, -0x10, 1.5e1, -2.5E-1, .5, 9223372036854775808 FROM users WHERE id = 1", "[[16 -16 15 -0.25 0.5 9.223372036854776e+18]]" },
+		{ "SELECT 1 / 0 FROM users", "error: division by zero" },
+		{ "SELECT 1.5 / 0 FROM users", "error: division by zero" },
+		{ "SELECT 9223372036854775807 + 1 FROM users", "error: integer out of range" },
+		{ "SELECT -9223372036854775807 - 2 FROM users", "error: integer out of range" },
+		{ "SELECT 0 - 9223372036854775807 - 1 FROM users WHERE id = 1", "[[-9223372036854775808]]" },
+		{ "SELECT -9223372036854775808, -9223372036854775808 + 1 FROM users WHERE id = 1", "[[-9223372036854775808 -9223372036854775807]]" },
+		{ "SELECT -9223372036854775808 - 1 FROM users", "error: integer out of range" },
+		{ "SELECT -(0 - 9223372036854775807 - 1) FROM users", "error: integer out of range" },
+		{ "SELECT 4611686018427387904 * 2 FROM users", "error: integer out of range" },
+		{ "SELECT (0 - 9223372036854775807 - 1) * -1 FROM users", "error: integer out of range" },
+		{ "SELECT -1 * (0 - 9223372036854775807 - 1) FROM users", "error: integer out of range" },
+		{ "SELECT 4611686018427387903 * 2, -4611686018427387904 * 2, 9223372036854775807 - 1 + 1 FROM users WHERE id = 1", "[[9223372036854775806 -9223372036854775808 9223372036854775807]]" },
+		{ "SELECT 9223372036854775807 + 1.0 FROM users WHERE id = 1", "[[9.223372036854776e+18]]" },
+		{ "SELECT 1e308 * 10 FROM users", "error: floating-point value out of range" },
+		{ "SELECT -1e308 * 10 FROM users", "error: floating-point value out of range" },
+		{ "SELECT 1e308 + 1e308 FROM users", "error: floating-point value out of range" },
+		{ "SELECT 1e308 / 0.1 FROM users", "error: floating-point value out of range" },
+		{ "SELECT 1e308 / 2 * 1.5, 1e-300 / 1e300 FROM users WHERE id = 1", "[[7.5e+307 0]]" },
+		{ "SELECT 'a' = 'a', 1 < 2, 2 <= 1, 1 <> 2, 1 != 1, 1 = 1.0 FROM users WHERE id = 1", "[[true true false true false true]]" },
+		{ "SELECT NULL = NULL, NULL AND FALSE, NULL OR TRUE, NOT NULL, NULL + 1 FROM users WHERE id = 1", "[[<nil> false true <nil> <nil>]]" },
+		{ "SELECT id FROM users WHERE active", "[[1]]" },
+		{ "SELECT id FROM users WHERE NOT active", "[[2]]" },
+		{ "SELECT id FROM users WHERE score > 0 AND active OR id = 4", "[[1] [4]]" },
+		{ "SELECT id FROM users WHERE id IN (1, 3, 5)", "[[1] [3]]" },
+		{ "SELECT id FROM users WHERE id NOT IN (1, NULL)", "[]" },
+		{ "SELECT id FROM users WHERE score BETWEEN -5 AND 3", "[[1] [2]]" },
+		{ "SELECT id FROM users WHERE id NOT BETWEEN 2 AND 3", "[[1] [4]]" },
+		{ "SELECT name FROM users WHERE name LIKE '%a%'", "[[alice] [carol] [dave]]" },
+		{ "SELECT name FROM users WHERE name LIKE '_o_'", "[[bob]]" },
+		{ "SELECT name FROM users WHERE name NOT LIKE 'a%'", "[[bob] [carol] [dave]]" },
+		{ "SELECT id FROM users WHERE score IS NULL", "[[3]]" },
+		{ "SELECT id FROM users WHERE active IS NOT NULL", "[[1] [2]]" },
+		{ "SELECT id, CASE WHEN score > 5 THEN 'high' WHEN score > 0 THEN 'low' ELSE 'none' END FROM users", "[[1 low] [2 none] [3 none] [4 high]]" },
+		{ "SELECT id, CASE id WHEN 1 THEN 'one' WHEN 2 THEN 'two' END FROM users", "[[1 one] [2 two] [3 <nil>] [4 <nil>]]" },
+		{ "SELECT CASE WHEN id = 1 THEN 1 ELSE 1 / 0 END FROM users WHERE id = 1", "[[1]]" },
+		{ "SELECT joined FROM users WHERE joined > '2024-01-01'", "[[2024-01-05] [2024-03-01]]" },
+		{ "SELECT id FROM users WHERE name = 1", "error: cannot compare TEXT with INT" },
+		{ "SELECT id FROM users WHERE id + 'a' > 1", "error: cannot apply '+' to INT and TEXT" },
+		{ "SELECT id FROM users WHERE score", "error: WHERE condition must be BOOLEAN but got DOUBLE" },
+		{ "SELECT CASE WHEN id = 1 THEN 1 ELSE 'x' END FROM users", "error: CASE branches have different types: INT and TEXT" },
+	})
+}
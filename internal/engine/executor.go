@@ -0,0 +1,226 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/jasutiin/deebeejeebees/internal/parser"
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// dataTypes are the column types CREATE TABLE accepts.
+var dataTypes = map[string]bool{
+	"INT":     true,
+	"VARCHAR": true,
+	"TEXT":    true,
+	"DATE":    true,
+	"BOOLEAN": true,
+	"FLOAT":   true,
+	"DOUBLE":  true,
+}
+
+// executeCreateTable adds a new table to the catalog.
+// CreateTableNode -> TableNameNode, ColumnListNode -> ColumnDefNode -> IdentifierNode, DataTypeNode, ValueNode
+func (db *Database) executeCreateTable(ast narytree.Node) (*Result, error) {
+	tableName := childOfType(ast, parser.TableNameNode).Data
+
+	table := &Table{ Name: tableName }
+	for _, columnDef := range childOfType(ast, parser.ColumnListNode).Children {
+		column := Column{}
+
+		for _, part := range columnDef.Children {
+			switch part.Type {
+				case parser.IdentifierNode:
+					column.Name = part.Data
+				case parser.DataTypeNode:
+					column.Type = part.Data
+				case parser.ValueNode:
+					size, err := strconv.Atoi(part.Data)
+					if err != nil || size <= 0 {
+						return nil, fmt.Errorf("invalid size '%s' for column '%s'", part.Data, column.Name)
+					}
+					column.Size = size
+			}
+		}
+
+		table.Columns = append(table.Columns, column)
+	}
+
+	db.tables[tableName] = table
+	return &Result{}, nil
+}
+
+// executeInsert adds rows to a table, either the rows of VALUES or those of a query. Columns that get no
+// value, or DEFAULT, are set to NULL. The rows are only added once every one of them has been converted to
+// the types of the table, so an INSERT that fails part way through adds nothing.
+// InsertNode -> [WithNode], TableNameNode, [ColumnListNode], ValuesListNode, ... or SelectNode
+func (db *Database) executeInsert(ast narytree.Node, exec *execution) (*Result, error) {
+	table, err := db.table(childOfType(ast, parser.TableNameNode).Data)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := insertTargets(ast, table)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := db.planInsert(ast, table, targets)
+	if err != nil {
+		return nil, err
+	}
+
+	// the rows are all read before any is added, so INSERT INTO t SELECT ... FROM t doesn't see its own rows
+	rows, err := drain(plan, &scope{ exec: exec })
+	if err != nil {
+		return nil, err
+	}
+
+	var added [][]any
+	for _, values := range rows {
+		row := make([]any, len(table.Columns))
+		for i, value := range values {
+			index := targets[i]
+			if row[index], err = table.Columns[index].coerce(value); err != nil {
+				return nil, err
+			}
+		}
+		added = append(added, row)
+	}
+
+	table.Rows = append(table.Rows, added...)
+	return &Result{ RowsAffected: len(added) }, nil
+}
+
+// planInsert builds the plan that produces the rows an INSERT adds, with one value for each of the
+// target columns in order. The queries of a WITH clause run first.
+// InsertNode -> [WithNode], TableNameNode, [ColumnListNode], ValuesListNode, ... or SelectNode
+func (db *Database) planInsert(ast narytree.Node, table *Table, targets []int) (operator, error) {
+	var scope *analysisScope
+	var with *withOperator
+	if node := childOfType(ast, parser.WithNode); node.Type != "" {
+		var err error
+		if with, scope, err = db.planCommonTables(node, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	var source operator
+	if query := childOfType(ast, parser.SelectNode); query.Type != "" {
+		var err error
+		if source, err = db.planSelect(query, scope); err != nil {
+			return nil, err
+		}
+	} else {
+		values := &valuesScan{ rel: &relation{} }
+		for _, row := range ast.Children {
+			if row.Type == parser.ValuesListNode {
+				values.rows = append(values.rows, row)
+			}
+		}
+		for _, index := range targets[:len(values.rows[0].Children)] {
+			column := table.Columns[index]
+			values.rel.columns = append(values.rel.columns, relationColumn{ name: column.Name, typ: columnType(column) })
+		}
+		source = values
+	}
+
+	if with == nil {
+		return source, nil
+	}
+	with.input = source
+	return with, nil
+}
+
+// executeUpdate changes the rows of a table that pass the WHERE clause, or all of them without one. The new
+// values are computed from the row as it was before the UPDATE, so 'SET a = b, b = a' swaps the two
+// columns. Like INSERT, the rows are only changed once every new value has been converted to the type of
+// its column.
+// UpdateNode -> [WithNode], TableNameNode, SetListNode -> AssignmentNode -> value, ..., [WhereNode]
+func (db *Database) executeUpdate(ast narytree.Node, exec *execution) (*Result, error) {
+	table, err := db.table(childOfType(ast, parser.TableNameNode).Data)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &scope{ exec: exec }
+	if with := childOfType(ast, parser.WithNode); with.Type != "" {
+		plan, _, err := db.planCommonTables(with, nil)
+		if err != nil {
+			return nil, err
+		}
+		if s, err = plan.run(s); err != nil {
+			return nil, err
+		}
+	}
+
+	rel := tableRelation(table, table.Name)
+	where := childOfType(ast, parser.WhereNode)
+	assignments := childOfType(ast, parser.SetListNode).Children
+
+	changed := map[int][]any{}
+	for i, row := range table.Rows {
+		rowScope := s.rowScope(rel, row)
+		if len(where.Children) > 0 {
+			matches, err := evalCondition(where.Children[0], rowScope)
+			if err != nil {
+				return nil, err
+			}
+			if !matches {
+				continue
+			}
+		}
+
+		updated := append([]any{}, row...)
+		for _, assignment := range assignments {
+			index := table.columnIndex(assignment.Data)
+
+			var value any
+			if assignment.Children[0].Type != parser.DefaultNode {
+				if value, err = evalExpression(assignment.Children[0], rowScope); err != nil {
+					return nil, err
+				}
+			}
+			if updated[index], err = table.Columns[index].coerce(value); err != nil {
+				return nil, err
+			}
+		}
+		changed[i] = updated
+	}
+
+	// nothing is changed until every row has its new values
+	for i, row := range changed {
+		table.Rows[i] = row
+	}
+	return &Result{ RowsAffected: len(changed) }, nil
+}
+
+// executeSelect plans a query and runs the plan to get its rows.
+// SelectNode -> ColumnListNode, FromNode, WhereNode
+func (db *Database) executeSelect(ast narytree.Node, exec *execution) (*Result, error) {
+	plan, err := db.planSelect(ast, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := drain(plan, &scope{ exec: exec })
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{ Rows: rows }
+	for _, column := range plan.columns().columns {
+		result.Columns = append(result.Columns, column.name)
+	}
+	return result, nil
+}
+
+// childOfType returns the first child of node with the given AST type, or an empty node if there is none.
+func childOfType(node narytree.Node, nodeType string) narytree.Node {
+	for _, child := range node.Children {
+		if child.Type == nodeType {
+			return child
+		}
+	}
+	return narytree.Node{}
+}
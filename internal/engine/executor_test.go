@@ -0,0 +1,71 @@
+package engine
+
+import "testing"
+
+func TestCreateTableAndInsert(t *testing.T) {
+	runQueryTests(t, []queryTest{
+		{ "CREATE TABLE t (a INT, b VARCHAR(3), c DOUBLE)", "affected 0" },
+		{ "CREATE TABLE t (a INT)", "error: table 't' already exists" },
+		{ "CREATE TABLE x (a BLOB)", "error: unknown data type 'blob' for column 'a'" },
+		{ "CREATE TABLE x (a INT, a INT)", "error: column 'a' is defined more than once" },
+		{ "INSERT INTO t (a, b, c) VALUES (1, 'x', 1.5)", "affected 1" },
+		{ "INSERT INTO t (a) VALUES (7)", "affected 1" },
+		{ "INSERT INTO t (c, a) VALUES (9.5, 8)", "affected 1" },
+		{ "SELECT a, b, c FROM t", "[[1 x 1.5] [7 <nil> <nil>] [8 <nil> 9.5]]" },
+		{ "INSERT INTO t (a, b) VALUES (1)", "error: INSERT has 2 columns but 1 values" },
+		{ "INSERT INTO t (a, a) VALUES (1, 2)", "error: column 'a' is specified more than once" },
+		{ "INSERT INTO t (zz) VALUES (1)", "error: column 'zz' does not exist in table 't'" },
+		{ "INSERT INTO t (a) VALUES ('no')", "error: cannot store TEXT value in column 'a' of type INT" },
+		{ "INSERT INTO t (a) VALUES (1.5)", "error: value 1.5 for column 'a' is not an integer" },
+		{ "INSERT INTO t (a, b) VALUES (100, 'toolong')", "error: value 'toolong' is too long for column 'b' of type VARCHAR(3)" },
+		{ "SELECT a FROM t", "[[1] [7] [8]]" },
+	})
+}
+
+func TestInsertRows(t *testing.T) {
+	runQueryTests(t, []queryTest{
+		{ "CREATE TABLE t (a INT, b VARCHAR(3), c DOUBLE)", "affected 0" },
+		{ "INSERT INTO t VALUES (1, 'x', 1.5), (2, 'y', DEFAULT), (3 * 2, UPPER('z'), -2)", "affected 3" },
+		{ "INSERT INTO t VALUES (7)", "affected 1" },
+		{ "SELECT * FROM t", "[[1 x 1.5] [2 y <nil>] [6 Z -2] [7 <nil> <nil>]]" },
+		{ "INSERT INTO t VALUES (1, 'a', 1, 1)", "error: INSERT has 3 columns but 4 values" },
+		{ "INSERT INTO t VALUES (1), (1, 'b')", "error: VALUES lists must all be the same length" },
+		{ "INSERT INTO t VALUES (COUNT(*))", "error: aggregate functions are not allowed in VALUES" },
+		{ "INSERT INTO t VALUES (100, 'ok'), (101, 'toolong')", "error: value 'toolong' is too long for column 'b' of type VARCHAR(3)" },
+		{ "SELECT COUNT(*) FROM t", "[[4]]" },
+		{ "INSERT INTO t (a, b) SELECT id, name FROM users WHERE id = 1", "affected 1" },
+		{ "INSERT INTO t (a) SELECT a + 100 FROM t WHERE a < 3", "affected 3" },
+		{ "INSERT INTO t SELECT id, name, score, active FROM users", "error: INSERT has 3 columns but 4 values" },
+		{ "INSERT INTO t (a) SELECT name FROM users", "error: cannot store TEXT value in column 'a' of type INT" },
+		{ "WITH big AS (SELECT id FROM users WHERE id > 2) INSERT INTO t (a) SELECT id * 1000 FROM big", "affected 2" },
+		{ "INSERT INTO t (a) WITH q AS (SELECT 5000 AS v FROM users WHERE id = 1) SELECT v FROM q", "affected 1" },
+		{ "SELECT a, b FROM t WHERE a > 10 ORDER BY a", "[[101 <nil>] [101 <nil>] [102 <nil>] [3000 <nil>] [4000 <nil>] [5000 <nil>]]" },
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	runQueryTests(t, []queryTest{
+		{ "CREATE TABLE t (a INT, b VARCHAR(3), c DOUBLE)", "affected 0" },
+		{ "INSERT INTO t VALUES (1, 'x', 1.5), (2, 'y', 2.5), (3, 'z', NULL)", "affected 3" },
+		{ "UPDATE t SET a = a + 1, b = 'u' WHERE a < 3", "affected 2" },
+		{ "UPDATE t SET c = DEFAULT", "affected 3" },
+		{ "SELECT a, b, c FROM t ORDER BY a, b", "[[2 u <nil>] [3 u <nil>] [3 z <nil>]]" },
+		{ "CREATE TABLE p (a INT, b INT)", "affected 0" },
+		{ "INSERT INTO p VALUES (1, 2), (3, 4)", "affected 2" },
+		{ "UPDATE p SET a = b, b = a", "affected 2" },
+		{ "SELECT * FROM p", "[[2 1] [4 3]]" },
+		{ "UPDATE p SET a = 1.5", "error: value 1.5 for column 'a' is not an integer" },
+		{ "UPDATE p SET a = 'x'", "error: cannot store TEXT value in column 'a' of type INT" },
+		{ "UPDATE p SET zz = 1", "error: column 'zz' does not exist in table 'p'" },
+		{ "UPDATE p SET a = 1, a = 2", "error: column 'a' is assigned more than once" },
+		{ "UPDATE nope SET a = 1", "error: table 'nope' does not exist" },
+		{ "UPDATE p SET a = COUNT(*)", "error: aggregate functions are not allowed in UPDATE" },
+		{ "UPDATE p SET a = 1 WHERE a", "error: WHERE condition must be BOOLEAN but got INT" },
+		{ "UPDATE users SET name = 'waytoolongname' WHERE id = 4", "error: value 'waytoolongname' is too long for column 'name' of type VARCHAR(10)" },
+		{ "SELECT name FROM users WHERE id = 4", "[[dave]]" },
+		{ "UPDATE users SET score = (SELECT SUM(amount) FROM orders WHERE orders.user_id = users.id)", "affected 4" },
+		{ "SELECT id, score FROM users", "[[1 29.5] [2 5] [3 <nil>] [4 <nil>]]" },
+		{ "WITH m AS (SELECT MAX(id) AS v FROM users) UPDATE p SET a = (SELECT v FROM m) WHERE b = 1", "affected 1" },
+		{ "SELECT * FROM p", "[[4 1] [4 3]]" },
+	})
+}
@@ -0,0 +1,317 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Type is the type of a value as far as semantic analysis is concerned.
+type Type string
+
+const (
+	TypeInt     Type = "INT"
+	TypeDouble  Type = "DOUBLE"
+	TypeText    Type = "TEXT"
+	TypeBoolean Type = "BOOLEAN"
+	TypeDate    Type = "DATE"
+
+	// TypeNumber accepts both INT and DOUBLE arguments.
+	TypeNumber Type = "NUMBER"
+
+	// TypeAny accepts anything. As a return type it means the function returns the type its ANY
+	// arguments have in common, like COALESCE, or the type of its first argument that isn't NULL if it
+	// has no ANY parameters, like ABS.
+	TypeAny Type = "ANY"
+
+	// TypeNull is the type of the NULL literal, which fits everywhere.
+	TypeNull Type = "NULL"
+)
+
+// Function is a scalar function that can be called from SQL, like UPPER(name). Functions are checked
+// against their signature during semantic analysis, so Call only ever gets as many arguments as the
+// signature allows, of the types it asks for or NULL.
+type Function struct {
+	Name string
+
+	// Params are the types of the parameters. The last Optional of them can be left out, and if Variadic
+	// is set the last one can be repeated any number of times.
+	Params   []Type
+	Optional int
+	Variadic bool
+
+	Returns Type
+
+	// CalledOnNull makes the function see NULL arguments. Otherwise the result is NULL as soon as one
+	// argument is NULL and Call isn't run at all, which is what most functions want.
+	CalledOnNull bool
+
+	Call func(args []any) (any, error)
+}
+
+// FunctionRegistry holds the scalar functions a database knows about. Names are case insensitive.
+type FunctionRegistry struct {
+	functions map[string]Function
+}
+
+func NewFunctionRegistry() *FunctionRegistry {
+	return &FunctionRegistry{ functions: map[string]Function{} }
+}
+
+// Register adds a function, replacing any function of the same name.
+func (r *FunctionRegistry) Register(function Function) error {
+	if function.Name == "" || function.Call == nil {
+		return fmt.Errorf("a function needs a name and a Call")
+	}
+	if function.Optional > len(function.Params) {
+		return fmt.Errorf("function %s has more optional parameters than parameters", function.Name)
+	}
+	if function.Variadic && len(function.Params) == 0 {
+		return fmt.Errorf("variadic function %s needs at least one parameter", function.Name)
+	}
+	if function.Returns == "" {
+		function.Returns = TypeAny
+	}
+
+	function.Name = strings.ToUpper(function.Name)
+	r.functions[function.Name] = function
+	return nil
+}
+
+// Lookup finds a function by name.
+func (r *FunctionRegistry) Lookup(name string) (Function, bool) {
+	function, ok := r.functions[strings.ToUpper(name)]
+	return function, ok
+}
+
+// checkArgs makes sure a call passes arguments of the right number and types, and returns the type of
+// the result.
+func (f Function) checkArgs(argTypes []Type) (Type, error) {
+	minArgs := len(f.Params) - f.Optional
+	if len(argTypes) < minArgs || (!f.Variadic && len(argTypes) > len(f.Params)) {
+		return "", fmt.Errorf("function %s %s but got %d", f.Name, f.describeArity(), len(argTypes))
+	}
+
+	for i, argType := range argTypes {
+		param := f.Params[min(i, len(f.Params) - 1)]
+		if !assignable(argType, param) {
+			return "", fmt.Errorf("argument %d of function %s must be %s but got %s", i + 1, f.Name, param, argType)
+		}
+	}
+
+	if f.Returns != TypeAny {
+		return f.Returns, nil
+	}
+	if !slices.Contains(f.Params, TypeAny) {
+		for _, argType := range argTypes {
+			if argType != TypeNull {
+				return argType, nil
+			}
+		}
+		return TypeNull, nil
+	}
+
+	// any of the arguments taken as ANY can be the result, as with COALESCE, so they need a type in common
+	resultType := TypeNull
+	for i, argType := range argTypes {
+		if f.Params[min(i, len(f.Params) - 1)] != TypeAny {
+			continue
+		}
+		var err error
+		if resultType, err = commonType(resultType, argType); err != nil {
+			return "", fmt.Errorf("arguments of function %s have different types: %w", f.Name, err)
+		}
+	}
+	return resultType, nil
+}
+
+func (f Function) describeArity() string {
+	minArgs := len(f.Params) - f.Optional
+	switch {
+		case f.Variadic:
+			return fmt.Sprintf("takes at least %d arguments", minArgs)
+		case f.Optional > 0:
+			return fmt.Sprintf("takes %d to %d arguments", minArgs, len(f.Params))
+		default:
+			return fmt.Sprintf("takes %d arguments", minArgs)
+	}
+}
+
+// call runs the function, taking care of NULL arguments for functions that don't want to see them.
+func (f Function) call(args []any) (any, error) {
+	if !f.CalledOnNull {
+		for _, arg := range args {
+			if arg == nil {
+				return nil, nil
+			}
+		}
+	}
+
+	// parameters are only known now, so their values still have to be checked against the signature
+	argTypes := make([]Type, len(args))
+	for i, arg := range args {
+		argTypes[i] = valueType(arg)
+	}
+	if _, err := f.checkArgs(argTypes); err != nil {
+		return nil, err
+	}
+	for i, arg := range args {
+		if n, isInt := arg.(int64); isInt && f.Params[min(i, len(f.Params) - 1)] == TypeDouble {
+			args[i] = float64(n)
+		}
+	}
+
+	result, err := f.Call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name, err)
+	}
+	return normalizeValue(result)
+}
+
+// newBuiltinFunctions creates a registry with the functions every database has.
+func newBuiltinFunctions() *FunctionRegistry {
+	registry := NewFunctionRegistry()
+
+	builtins := []Function{
+		{ Name: "UPPER", Params: []Type{ TypeText }, Returns: TypeText, Call: func(args []any) (any, error) {
+			return strings.ToUpper(args[0].(string)), nil
+		} },
+		{ Name: "LOWER", Params: []Type{ TypeText }, Returns: TypeText, Call: func(args []any) (any, error) {
+			return strings.ToLower(args[0].(string)), nil
+		} },
+		{ Name: "LENGTH", Params: []Type{ TypeText }, Returns: TypeInt, Call: func(args []any) (any, error) {
+			return int64(utf8.RuneCountInString(args[0].(string))), nil
+		} },
+		{ Name: "TRIM", Params: []Type{ TypeText }, Returns: TypeText, Call: func(args []any) (any, error) {
+			return strings.TrimSpace(args[0].(string)), nil
+		} },
+		{ Name: "REPLACE", Params: []Type{ TypeText, TypeText, TypeText }, Returns: TypeText, Call: func(args []any) (any, error) {
+			return strings.ReplaceAll(args[0].(string), args[1].(string), args[2].(string)), nil
+		} },
+		{ Name: "SUBSTR", Params: []Type{ TypeText, TypeInt, TypeInt }, Optional: 1, Returns: TypeText, Call: substr },
+		{ Name: "COALESCE", Params: []Type{ TypeAny }, Variadic: true, CalledOnNull: true, Call: func(args []any) (any, error) {
+			for _, arg := range args {
+				if arg != nil {
+					return arg, nil
+				}
+			}
+			return nil, nil
+		} },
+		{ Name: "NULLIF", Params: []Type{ TypeAny, TypeAny }, CalledOnNull: true, Call: func(args []any) (any, error) {
+			if args[0] == nil || args[1] == nil {
+				return args[0], nil
+			}
+			equal, err := compareWith("=", args[0], args[1])
+			if err != nil || equal {
+				return nil, err
+			}
+			return args[0], nil
+		} },
+		{ Name: "ABS", Params: []Type{ TypeNumber }, Call: func(args []any) (any, error) {
+			if i, ok := args[0].(int64); ok {
+				if i == math.MinInt64 {
+					return nil, fmt.Errorf("integer out of range")
+				}
+				if i < 0 {
+					return -i, nil
+				}
+				return i, nil
+			}
+			return math.Abs(args[0].(float64)), nil
+		} },
+		{ Name: "ROUND", Params: []Type{ TypeNumber, TypeInt }, Optional: 1, Call: round },
+		{ Name: "NOW", Returns: TypeText, Call: func(args []any) (any, error) {
+			return time.Now().Format("2006-01-02 15:04:05"), nil
+		} },
+	}
+
+	for _, function := range builtins {
+		registry.Register(function)
+	}
+	return registry
+}
+
+// substr returns part of a string, counting characters from 1 like SQL does: SUBSTR('hello', 2, 3) is 'ell'.
+func substr(args []any) (any, error) {
+	text := []rune(args[0].(string))
+	start := args[1].(int64) - 1
+	end := int64(len(text))
+
+	if len(args) == 3 {
+		length := args[2].(int64)
+		if length < 0 {
+			return nil, fmt.Errorf("negative substring length not allowed")
+		}
+		// the characters before the first one use up part of the length
+		if start < 0 {
+			length += start
+			start = 0
+		}
+		// clamped before adding, so that a huge length can't overflow
+		if length > end - start {
+			length = end - start
+		}
+		end = start + length
+	}
+
+	start = max(start, 0)
+	if start >= end {
+		return "", nil
+	}
+	return string(text[start:end]), nil
+}
+
+// round rounds a number half away from zero, optionally to a number of decimal places.
+func round(args []any) (any, error) {
+	digits := int64(0)
+	if len(args) == 2 {
+		digits = args[1].(int64)
+	}
+
+	if i, ok := args[0].(int64); ok {
+		if digits >= 0 {
+			return i, nil
+		}
+		// 10^19 doesn't fit in an int64, so at that point only the halfway check is left: anything from
+		// 5 * 10^18 up would round to 10^19 and everything smaller rounds to 0.
+		if digits <= -19 {
+			if digits == -19 && (i >= 5e18 || i <= -5e18) {
+				return nil, fmt.Errorf("integer out of range")
+			}
+			return int64(0), nil
+		}
+
+		scale := int64(1)
+		for range -digits {
+			scale *= 10
+		}
+		rounded := i - i % scale
+		switch {
+			case i % scale >= scale / 2:
+				if rounded > math.MaxInt64 - scale {
+					return nil, fmt.Errorf("integer out of range")
+				}
+				rounded += scale
+			case i % scale <= -scale / 2:
+				if rounded < math.MinInt64 + scale {
+					return nil, fmt.Errorf("integer out of range")
+				}
+				rounded -= scale
+		}
+		return rounded, nil
+	}
+
+	value := args[0].(float64)
+	scale := math.Pow(10, float64(digits))
+	if scale == 0 {
+		return 0.0, nil
+	}
+	scaled := value * scale
+	if math.IsInf(scale, 0) || math.IsInf(scaled, 0) || math.IsNaN(scaled) {
+		return value, nil
+	}
+	return math.Round(scaled) / scale, nil
+}
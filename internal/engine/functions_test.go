@@ -0,0 +1,78 @@
+package engine
+
+import "testing"
+
+func TestBuiltinFunctions(t *testing.T) {
+	runQueryTests(t, []queryTest{
+		{ "SELECT id FROM users WHERE UPPER(name) = 'BOB'", "[[1]]" },
+		{ "SELECT id FROM users WHERE LENGTH(name) = 5 AND SUBSTR(name, 1, 1) = 'c'", "[[3]]" },
+		{ "SELECT id FROM users WHERE COALESCE(score, 0) = 0", "[[3]]" },
+		{ "SELECT id FROM users WHERE ABS(score) = 3", "[[2]]" },
+		{ "SELECT id FROM users WHERE UPPER(id) = 'X'", "error: argument 1 of function UPPER must be TEXT but got INT" },
+		{ "SELECT id FROM users WHERE UPPER() = 'X'", "error: function UPPER takes 1 arguments but got 0" },
+		{ "SELECT id FROM users WHERE NOPE(1)", "error: function 'nope' does not exist" },
+		{ "SELECT UPPER(name), LOWER('ABC'), LENGTH(name), TRIM('  x  '), REPLACE(name, 'o', '0') FROM users WHERE id = 1", "[[BOB abc 3 x b0b]]" },
+		{ "SELECT SUBSTR('hello', 2, 3), SUBSTR('hello', 2), SUBSTR('hello', 0, 2), SUBSTR('hello', 9) FROM users WHERE id = 1", "[[ell ello h ]]" },
+		{ "SELECT SUBSTR('hello', 1, -1) FROM users WHERE id = 1", "error: SUBSTR: negative substring length not allowed" },
+		{ "SELECT SUBSTR('abc', 2, 9223372036854775807), SUBSTR('abc', -1, 3), SUBSTR('abc', 5, 9223372036854775807), SUBSTR('abc', -9223372036854775807, 9223372036854775807) FROM users WHERE id = 1", "[[bc a  ]]" },
+		{ "SELECT LENGTH('café'), UPPER('café'), SUBSTR('名前です', 2, 2) FROM users WHERE id = 1", "[[4 CAFÉ 前で]]" },
+		{ "SELECT COALESCE(score, 0), COALESCE(NULL, NULL, 'x') FROM users", "[[2.5 x] [-3 x] [0 x] [10 x]]" },
+		{ "SELECT NULLIF(id, 1) FROM users", "[[<nil>] [2] [3] [4]]" },
+		{ "SELECT COALESCE(id, 'x') FROM users", "error: arguments of function COALESCE have different types: INT and TEXT" },
+		{ "SELECT COALESCE(NULL, name, 1) FROM users", "error: arguments of function COALESCE have different types: TEXT and INT" },
+		{ "SELECT UPPER(COALESCE(name, 'x')), UPPER(COALESCE(NULL, 'x')) FROM users WHERE id = 1", "[[BOB X]]" },
+		{ "SELECT UPPER(COALESCE(score, 0)) FROM users", "error: argument 1 of function UPPER must be TEXT but got DOUBLE" },
+		{ "SELECT COALESCE(score, id) + 0.5 FROM users", "[[3] [-2.5] [3.5] [10.5]]" },
+		{ "SELECT NULLIF(name, 2) FROM users", "error: arguments of function NULLIF have different types: TEXT and INT" },
+		{ "SELECT ABS(-3), ABS(-2.5), ROUND(2.5), ROUND(-2.5), ROUND(3.14159, 2) FROM users WHERE id = 1", "[[3 2.5 3 -3 3.14]]" },
+		{ "SELECT ROUND(1234, -2), ROUND(1250, -2), ROUND(-1250, -2), ROUND(id, -19), ROUND(id, -400) FROM users WHERE id = 1", "[[1200 1300 -1300 0 0]]" },
+		{ "SELECT ROUND(9223372036854775807, -1) FROM users", "error: ROUND: integer out of range" },
+		{ "SELECT ROUND(-9223372036854775807, -19) FROM users", "error: ROUND: integer out of range" },
+		{ "SELECT ROUND(2.5, 400), ROUND(2.5, -400), ROUND(1e308, 10) FROM users WHERE id = 1", "[[2.5 0 1e+308]]" },
+		{ "SELECT UPPER(NULL), LENGTH(name) FROM users WHERE id = 3", "[[<nil> 5]]" },
+		{ "SELECT upper(name) FROM users WHERE id = 2", "[[ALICE]]" },
+		{ "SELECT UPPER(id) FROM users", "error: argument 1 of function UPPER must be TEXT but got INT" },
+		{ "SELECT UPPER() FROM users", "error: function UPPER takes 1 arguments but got 0" },
+		{ "SELECT SUBSTR('a', 1, 2, 3) FROM users", "error: function SUBSTR takes 2 to 3 arguments but got 4" },
+		{ "SELECT NOPE(1) FROM users", "error: function 'nope' does not exist" },
+		{ "SELECT ABS(9223372036854775807 + 0) FROM users WHERE id = 1", "[[9223372036854775807]]" },
+		{ "SELECT LENGTH(DISTINCT name) FROM users", "error: DISTINCT is only allowed in aggregate functions, not in LENGTH" },
+	})
+}
+
+func TestRegisterFunction(t *testing.T) {
+	db := newTestDatabase(t)
+	err := db.RegisterFunction(Function{
+		Name:    "twice",
+		Params:  []Type{ TypeNumber },
+		Returns: TypeDouble,
+		Call: func(args []any) (any, error) {
+			n, _ := toFloat(args[0])
+			return n * 2, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []queryTest{
+		{ "SELECT id FROM users WHERE TWICE(id) = 4 OR twice(score) = 5", "[[1] [2]]" },
+		{ "SELECT id FROM users WHERE TWICE(name) = 1", "error: argument 1 of function TWICE must be NUMBER but got TEXT" },
+		{ "SELECT id FROM users WHERE UPPER(TWICE(id)) = 'X'", "error: argument 1 of function UPPER must be TEXT but got DOUBLE" },
+		{ "SELECT TWICE(id), twice(score) FROM users WHERE id < 4", "[[2 5] [4 -6] [6 <nil>]]" },
+		{ "SELECT TWICE(name) FROM users", "error: argument 1 of function TWICE must be NUMBER but got TEXT" },
+		{ "SELECT UPPER(TWICE(id)) FROM users", "error: argument 1 of function UPPER must be TEXT but got DOUBLE" },
+	}
+	for _, test := range tests {
+		if got := runQuery(db, test.query); got != test.want {
+			t.Errorf("%s\n  got  %s\n  want %s", test.query, got, test.want)
+		}
+	}
+
+	if err := db.RegisterFunction(Function{ Name: "broken" }); err == nil {
+		t.Errorf("registering a function without Call should fail")
+	}
+	if err := db.RegisterFunction(Function{ Name: "broken", Variadic: true, Call: func([]any) (any, error) { return nil, nil } }); err == nil {
+		t.Errorf("registering a variadic function without parameters should fail")
+	}
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jasutiin/deebeejeebees/internal/tokens"
+)
+
+// NamedArg is an argument for a ':name' parameter. Create one with Named.
+type NamedArg struct {
+	Name  string
+	Value any
+}
+
+// Named binds value to the ':name' parameter of a query. Names follow the same case folding as
+// identifiers, so Named("UserID", 1) binds :userid, :UserID and :USERID.
+func Named(name string, value any) NamedArg {
+	return NamedArg{ Name: name, Value: value }
+}
+
+// parameters holds the Go values bound to the parameters of a query.
+type parameters struct {
+	positional []any
+	named      map[string]any
+}
+
+// bindParameters sorts the arguments of Exec into positional and named ones and converts them into the
+// values the engine works with. It fails if there are more positional arguments than the highest $n among
+// the parameters of the lexed query, since an argument nothing refers to is almost always a mistake.
+func bindParameters(list []tokens.Token, args []any) (*parameters, error) {
+	params := &parameters{ named: map[string]any{} }
+
+	for _, arg := range args {
+		if namedArg, ok := arg.(NamedArg); ok {
+			value, err := normalizeValue(namedArg.Value)
+			if err != nil {
+				return nil, fmt.Errorf("parameter :%s: %w", namedArg.Name, err)
+			}
+			params.named[tokens.FoldIdentifier(strings.TrimPrefix(namedArg.Name, ":"))] = value
+			continue
+		}
+
+		value, err := normalizeValue(arg)
+		if err != nil {
+			return nil, fmt.Errorf("parameter $%d: %w", len(params.positional) + 1, err)
+		}
+		params.positional = append(params.positional, value)
+	}
+
+	placeholders := 0
+	for _, token := range list {
+		if token.Kind != tokens.PARAMETER || !strings.HasPrefix(token.Value, "$") {
+			continue
+		}
+		if index, err := strconv.Atoi(token.Value[1:]); err == nil {
+			placeholders = max(placeholders, index)
+		}
+	}
+	if len(params.positional) > placeholders {
+		return nil, fmt.Errorf("got %d positional arguments but the query has %d positional parameters", len(params.positional), placeholders)
+	}
+
+	return params, nil
+}
+
+// lookup returns the value bound to a parameter node, which is named either $n or :name.
+func (p *parameters) lookup(name string) (any, error) {
+	if strings.HasPrefix(name, ":") {
+		value, ok := p.named[name[1:]]
+		if !ok {
+			return nil, fmt.Errorf("no value given for parameter %s", name)
+		}
+		return value, nil
+	}
+
+	index, err := strconv.Atoi(strings.TrimPrefix(name, "$"))
+	if err != nil || index < 1 {
+		return nil, fmt.Errorf("invalid parameter %s", name)
+	}
+	if index > len(p.positional) {
+		return nil, fmt.Errorf("no value given for parameter %s", name)
+	}
+	return p.positional[index - 1], nil
+}
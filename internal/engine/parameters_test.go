@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParameters(t *testing.T) {
+	tests := []struct {
+		query string
+		args  []any
+		want  string
+	}{
+		{ "SELECT name FROM users WHERE id = ?", []any{ 2 }, "[[alice]]" },
+		{ "SELECT name FROM users WHERE id = ? OR id = ?", []any{ 1, int32(4) }, "[[bob] [dave]]" },
+		{ "SELECT name FROM users WHERE id = $2 OR id = $1", []any{ 1, 3 }, "[[bob] [carol]]" },
+		{ "SELECT name FROM users WHERE name = :who", []any{ Named("who", "bob") }, "[[bob]]" },
+		{ "SELECT name FROM users WHERE id = :ID", []any{ Named("id", 3) }, "[[carol]]" },
+		{ "SELECT id FROM users WHERE score > ? AND active = ?", []any{ 1.5, true }, "[[1]]" },
+		{ "SELECT id FROM users WHERE joined < ?", []any{ time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }, "[[2]]" },
+		{ "SELECT ? FROM users WHERE id = 1", []any{ "x" }, "[[x]]" },
+		{ "SELECT id FROM users WHERE score = ?", []any{ nil }, "[]" },
+		{ "SELECT id FROM users LIMIT ?", []any{ 2 }, "[[1] [2]]" },
+		{ "SELECT id FROM users WHERE id = ?", nil, "error: no value given for parameter $1" },
+		{ "SELECT id FROM users WHERE id = :x", []any{ Named("y", 1) }, "error: no value given for parameter :x" },
+		{ "SELECT id FROM users WHERE id = ?", []any{ struct{}{} }, "error: parameter $1: unsupported type struct {}" },
+		{ "SELECT id FROM users WHERE id = ?", []any{ uint64(1) << 63 }, "error: parameter $1: value 9223372036854775808 is too large" },
+		{ "SELECT id FROM users WHERE id = ?", []any{ "1" }, "error: cannot compare INT with TEXT" },
+		{ "SELECT COALESCE(?, 'x') FROM users WHERE id = 1", []any{ 1 }, "error: arguments of function COALESCE have different types: INT and TEXT" },
+		{ "SELECT UPPER(COALESCE(?, 'x')) FROM users WHERE id = 1", []any{ nil }, "[[X]]" },
+		{ "SELECT id FROM users WHERE id = ?", []any{ Named("x", 1), struct{}{} }, "error: parameter $1: unsupported type struct {}" },
+		{ "SELECT id FROM users WHERE id = $2", []any{ 1, 2, 3 }, "error: got 3 positional arguments but the query has 2 positional parameters" },
+		{ "SELECT id FROM users WHERE id = :x", []any{ Named("x", 1), 2 }, "error: got 1 positional arguments but the query has 0 positional parameters" },
+		{ "INSERT INTO orders (id, user_id) VALUES (?, ?)", []any{ 1, 2, 3 }, "error: got 3 positional arguments but the query has 2 positional parameters" },
+		{ "SELECT name FROM users WHERE name = ?", []any{ "x' OR '1' = '1" }, "[]" },
+		{ "INSERT INTO orders (id, user_id, amount, item) VALUES (?, ?, ?, ?)", []any{ 14, 2, 3.5, "mug" }, "affected 1" },
+		{ "INSERT INTO orders (id, item) VALUES (:id, :item)", []any{ Named("id", 15), Named("item", "cap") }, "affected 1" },
+		{ "UPDATE orders SET amount = ? WHERE id = ?", []any{ 1, 15 }, "affected 1" },
+		{ "SELECT id, amount, item FROM orders WHERE id > 13", nil, "[[14 3.5 mug] [15 1 cap]]" },
+	}
+
+	db := newTestDatabase(t)
+	for _, test := range tests {
+		if got := runQuery(db, test.query, test.args...); got != test.want {
+			t.Errorf("%s with %v\n  got  %s\n  want %s", test.query, test.args, got, test.want)
+		}
+	}
+}
+
+func TestParametersInScript(t *testing.T) {
+	db := newTestDatabase(t)
+	results, err := db.ExecScript("INSERT INTO orders (id, user_id, amount, item) VALUES (?, ?, 1, 'a'); SELECT item FROM orders WHERE id = $1", 20, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[1].Rows[0][0] != "a" {
+		t.Errorf("parameters should be numbered across the script, got %v", results)
+	}
+}
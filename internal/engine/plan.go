@@ -0,0 +1,319 @@
+package engine
+
+import (
+	"github.com/jasutiin/deebeejeebees/internal/parser"
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// A query is run as a tree of operators called the plan. Each operator hands out its rows one at a time
+// and pulls the rows it needs from the operators below it, so rows flow up from the table scans at the
+// leaves to the root of the plan without every step having to build its whole result first.
+
+type operator interface {
+	// columns describes the rows the operator produces.
+	columns() *relation
+
+	// open gets the operator ready to produce its rows from the start. Expressions are evaluated as
+	// children of parent, which holds the running statement.
+	open(parent *scope) error
+
+	// next returns the next row, or nil when there are no more.
+	next() ([]any, error)
+}
+
+// drain opens op and reads all of its rows.
+func drain(op operator, parent *scope) ([][]any, error) {
+	if err := op.open(parent); err != nil {
+		return nil, err
+	}
+
+	var rows [][]any
+	for {
+		row, err := op.next()
+		if err != nil {
+			return nil, err
+		}
+		if row == nil {
+			return rows, nil
+		}
+		rows = append(rows, row)
+	}
+}
+
+// tableScan reads every row of a table.
+type tableScan struct {
+	table    *Table
+	rel      *relation
+	position int
+}
+
+func (o *tableScan) columns() *relation {
+	return o.rel
+}
+
+func (o *tableScan) open(parent *scope) error {
+	o.position = 0
+	return nil
+}
+
+func (o *tableScan) next() ([]any, error) {
+	if o.position >= len(o.table.Rows) {
+		return nil, nil
+	}
+	row := o.table.Rows[o.position]
+	o.position++
+	return row, nil
+}
+
+// valuesScan computes the rows of a VALUES list, one row of expressions at a time. DEFAULT is NULL.
+type valuesScan struct {
+	rows     []narytree.Node
+	rel      *relation
+	parent   *scope
+	position int
+}
+
+func (o *valuesScan) columns() *relation {
+	return o.rel
+}
+
+func (o *valuesScan) open(parent *scope) error {
+	o.parent = parent
+	o.position = 0
+	return nil
+}
+
+func (o *valuesScan) next() ([]any, error) {
+	if o.position >= len(o.rows) {
+		return nil, nil
+	}
+
+	var row []any
+	for _, value := range o.rows[o.position].Children {
+		if value.Type == parser.DefaultNode {
+			row = append(row, nil)
+			continue
+		}
+		result, err := evalExpression(value, o.parent)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, result)
+	}
+	o.position++
+	return row, nil
+}
+
+// nestedLoopJoin joins two inputs by trying every row of left with every row of right. The rows of right
+// are read once when the join is opened and kept in memory. Outer joins also produce the rows that didn't
+// match anything, with NULLs in place of the other side: LEFT keeps the rows of left, RIGHT those of
+// right and FULL both.
+type nestedLoopJoin struct {
+	kind      string // INNER, LEFT, RIGHT, FULL or CROSS
+	left      operator
+	right     operator
+	condition narytree.Node // the ON condition, if there is one
+	using     []usingColumn // the columns matched by USING, if there are any
+	rel       *relation
+	parent    *scope
+
+	rightRows    [][]any
+	rightMatched []bool
+	leftRow      []any
+	leftMatched  bool
+	leftDone     bool
+	position     int
+}
+
+func newNestedLoopJoin(kind string, left operator, right operator) *nestedLoopJoin {
+	return &nestedLoopJoin{ kind: kind, left: left, right: right, rel: left.columns().join(right.columns()) }
+}
+
+func (o *nestedLoopJoin) columns() *relation {
+	return o.rel
+}
+
+func (o *nestedLoopJoin) open(parent *scope) error {
+	rightRows, err := drain(o.right, parent)
+	if err != nil {
+		return err
+	}
+	o.parent = parent
+	o.rightRows = rightRows
+	o.rightMatched = make([]bool, len(rightRows))
+	o.leftRow = nil
+	o.leftDone = false
+	o.position = 0
+	return o.left.open(parent)
+}
+
+func (o *nestedLoopJoin) next() ([]any, error) {
+	for {
+		if o.leftDone {
+			// RIGHT and FULL joins end with the rows of right that never matched
+			for o.position < len(o.rightRows) {
+				i := o.position
+				o.position++
+				if !o.rightMatched[i] {
+					return o.combine(nil, o.rightRows[i]), nil
+				}
+			}
+			return nil, nil
+		}
+
+		if o.leftRow == nil {
+			leftRow, err := o.left.next()
+			if err != nil {
+				return nil, err
+			}
+			if leftRow == nil {
+				o.leftDone = true
+				o.position = 0
+				if o.kind != "RIGHT" && o.kind != "FULL" {
+					return nil, nil
+				}
+				continue
+			}
+			o.leftRow = leftRow
+			o.leftMatched = false
+			o.position = 0
+		}
+
+		if o.position >= len(o.rightRows) {
+			leftRow := o.leftRow
+			o.leftRow = nil
+			if !o.leftMatched && (o.kind == "LEFT" || o.kind == "FULL") {
+				return o.combine(leftRow, nil), nil
+			}
+			continue
+		}
+
+		i := o.position
+		o.position++
+		matches, err := o.matches(o.leftRow, o.rightRows[i])
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			o.leftMatched = true
+			o.rightMatched[i] = true
+			return o.combine(o.leftRow, o.rightRows[i]), nil
+		}
+	}
+}
+
+// matches decides whether a row of left and a row of right belong together.
+func (o *nestedLoopJoin) matches(leftRow []any, rightRow []any) (bool, error) {
+	for _, pair := range o.using {
+		equal, err := compareNullable("=", leftRow[pair.left], rightRow[pair.right])
+		if err != nil || equal != true {
+			return false, err
+		}
+	}
+
+	if o.condition.Type == "" {
+		return true, nil
+	}
+	return evalCondition(o.condition, o.parent.rowScope(o.rel, o.combine(leftRow, rightRow)))
+}
+
+// combine builds a row of the join from a row of each side. A nil side is filled with NULLs. With USING,
+// the merged columns come first and take the value of whichever side has one.
+func (o *nestedLoopJoin) combine(leftRow []any, rightRow []any) []any {
+	if leftRow == nil {
+		leftRow = make([]any, len(o.left.columns().columns))
+	}
+	if rightRow == nil {
+		rightRow = make([]any, len(o.right.columns().columns))
+	}
+
+	if len(o.using) == 0 {
+		return concatRows(leftRow, rightRow)
+	}
+
+	row := make([]any, 0, len(o.rel.columns))
+	for _, pair := range o.using {
+		value := leftRow[pair.left]
+		if value == nil {
+			value = rightRow[pair.right]
+		}
+		row = append(row, value)
+	}
+	row = append(row, leftRow...)
+	return append(row, rightRow...)
+}
+
+// concatRows puts two rows side by side in a new row.
+func concatRows(left []any, right []any) []any {
+	row := make([]any, 0, len(left) + len(right))
+	row = append(row, left...)
+	return append(row, right...)
+}
+
+// filter passes on the rows for which a condition is true.
+type filter struct {
+	input     operator
+	condition narytree.Node
+	parent    *scope
+}
+
+func (o *filter) columns() *relation {
+	return o.input.columns()
+}
+
+func (o *filter) open(parent *scope) error {
+	o.parent = parent
+	return o.input.open(parent)
+}
+
+func (o *filter) next() ([]any, error) {
+	for {
+		row, err := o.input.next()
+		if err != nil || row == nil {
+			return nil, err
+		}
+
+		matches, err := evalCondition(o.condition, o.parent.rowScope(o.input.columns(), row))
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			return row, nil
+		}
+	}
+}
+
+// project computes the columns of the result from each row.
+type project struct {
+	input   operator
+	outputs []outputColumn
+	rel     *relation
+	parent  *scope
+}
+
+func (o *project) columns() *relation {
+	return o.rel
+}
+
+func (o *project) open(parent *scope) error {
+	o.parent = parent
+	return o.input.open(parent)
+}
+
+func (o *project) next() ([]any, error) {
+	row, err := o.input.next()
+	if err != nil || row == nil {
+		return nil, err
+	}
+
+	s := o.parent.rowScope(o.input.columns(), row)
+	values := make([]any, len(o.outputs))
+	for i, output := range o.outputs {
+		value, err := evalExpression(output.expression, s)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,222 @@
+package engine
+
+import (
+	"github.com/jasutiin/deebeejeebees/internal/parser"
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// The planner turns the AST of a query into a plan of operators. It runs after semantic analysis, so
+// every name in the query is known to exist.
+
+// planSelect builds the plan of a SELECT: the tables of the FROM clause are combined, the rows that don't
+// pass the WHERE clause are dropped, what's left is grouped if the query needs it, window functions are
+// computed, and the select list is computed from the result. Last, duplicates are removed for DISTINCT
+// and the rows are sorted and cut down to LIMIT and OFFSET. outer is the scope of the query this one is a
+// subquery of, or nil.
+// SelectNode -> WithNode, ...
+// SelectNode -> SetOperationNode, OrderByNode, LimitNode, OffsetNode
+// SelectNode -> DistinctNode, ColumnListNode, FromNode, WhereNode, GroupByNode, HavingNode, OrderByNode, LimitNode, OffsetNode
+func (db *Database) planSelect(ast narytree.Node, outer *analysisScope) (operator, error) {
+	if childOfType(ast, parser.WithNode).Type != "" {
+		return db.planWith(ast, outer)
+	}
+	if childOfType(ast, parser.SetOperationNode).Type != "" {
+		return db.planCompound(ast, outer)
+	}
+
+	plan, err := db.planFrom(childOfType(ast, parser.FromNode), outer)
+	if err != nil {
+		return nil, err
+	}
+
+	if where := childOfType(ast, parser.WhereNode); len(where.Children) > 0 {
+		plan = &filter{ input: plan, condition: where.Children[0] }
+	}
+
+	outputs, err := expandSelectList(childOfType(ast, parser.ColumnListNode), plan.columns())
+	if err != nil {
+		return nil, err
+	}
+
+	visible := len(outputs)
+	outputs, keys, err := sortOutputs(childOfType(ast, parser.OrderByNode), outputs, visible, plan.columns())
+	if err != nil {
+		return nil, err
+	}
+
+	distinct := childOfType(ast, parser.DistinctNode)
+	var compared []int
+	if distinct.Type != "" {
+		if outputs, compared, err = distinctOutputs(distinct, outputs, visible, plan.columns()); err != nil {
+			return nil, err
+		}
+		if keys, err = distinctSortKeys(distinct, compared, keys, visible); err != nil {
+			return nil, err
+		}
+	}
+
+	having := childOfType(ast, parser.HavingNode)
+	group, err := db.newGrouping(childOfType(ast, parser.GroupByNode), having, outputs, &analysisScope{ relation: plan.columns(), outer: outer })
+	if err != nil {
+		return nil, err
+	}
+
+	if group != nil {
+		plan = &hashAggregate{ input: plan, group: group }
+		if outputs, having, err = group.rewriteClauses(outputs, having); err != nil {
+			return nil, err
+		}
+		if len(having.Children) > 0 {
+			plan = &filter{ input: plan, condition: having.Children[0] }
+		}
+	}
+
+	if plan, outputs, err = db.planWindows(plan, outputs, outer); err != nil {
+		return nil, err
+	}
+
+	if plan, err = db.newProject(plan, outputs, outer); err != nil {
+		return nil, err
+	}
+
+	switch {
+		case distinct.Type != "" && len(keys) == 0:
+			plan = &hashDistinct{ input: plan, compared: compared }
+		case distinct.Type != "":
+			// the rows have to be sorted anyway, which puts the duplicates next to each other
+			plan = &sortedDistinct{ input: &sorter{ input: plan, keys: keys }, compared: compared }
+			keys = nil
+	}
+	plan = planOrderAndLimit(plan, keys, ast)
+
+	if len(outputs) > visible {
+		// drop the columns that were only there to sort on
+		var columns []outputColumn
+		for i, column := range plan.columns().columns[:visible] {
+			columns = append(columns, outputColumn{ name: column.name, expression: slot(i) })
+		}
+		return db.newProject(plan, columns, outer)
+	}
+	return plan, nil
+}
+
+// planOrderAndLimit sorts the rows of plan by keys and cuts them down to the LIMIT and OFFSET of the
+// query.
+// SelectNode -> ..., LimitNode, OffsetNode
+func planOrderAndLimit(plan operator, keys []sortKey, ast narytree.Node) operator {
+	limit := childOfType(ast, parser.LimitNode)
+	offset := childOfType(ast, parser.OffsetNode)
+	switch {
+		case len(keys) > 0 && limit.Type != "":
+			plan = &topN{ sorter: sorter{ input: plan, keys: keys }, limit: limit, offset: offset }
+		case len(keys) > 0:
+			plan = &sorter{ input: plan, keys: keys }
+	}
+	if limit.Type != "" || offset.Type != "" {
+		plan = &limiter{ input: plan, limit: limit, offset: offset }
+	}
+	return plan
+}
+
+// planFrom combines the tables of the FROM clause from left to right. Tables separated by commas are
+// joined with CROSS joins.
+// FromNode -> TableNameNode, SubqueryNode or JoinNode, ...
+func (db *Database) planFrom(from narytree.Node, outer *analysisScope) (operator, error) {
+	var plan operator
+
+	for _, tableExpression := range from.Children {
+		input, err := db.planTableExpression(tableExpression, outer)
+		if err != nil {
+			return nil, err
+		}
+
+		if plan == nil {
+			plan = input
+		} else {
+			plan = newNestedLoopJoin("CROSS", plan, input)
+		}
+	}
+
+	return plan, nil
+}
+
+// planTableExpression plans a table of the FROM clause, a subquery, or a join of two of them.
+// TableNameNode -> [AliasNode]
+// SubqueryNode -> SelectNode, AliasNode
+// JoinNode -> left, right, [OnNode -> condition | UsingNode -> IdentifierNode, ...]
+func (db *Database) planTableExpression(node narytree.Node, outer *analysisScope) (operator, error) {
+	switch node.Type {
+		case parser.TableNameNode:
+			if table := outer.commonTable(node.Data); table != nil {
+				return &commonTableScan{ table: table, rel: table.rel.renamed(referenceName(node)) }, nil
+			}
+			table, err := db.table(node.Data)
+			if err != nil {
+				return nil, err
+			}
+			return &tableScan{ table: table, rel: tableRelation(table, referenceName(node)) }, nil
+
+		case parser.SubqueryNode:
+			input, err := db.planSelect(node.Children[0], outer)
+			if err != nil {
+				return nil, err
+			}
+			return &subqueryScan{ input: input, rel: input.columns().renamed(referenceName(node)) }, nil
+	}
+
+	left, err := db.planTableExpression(node.Children[0], outer)
+	if err != nil {
+		return nil, err
+	}
+	right, err := db.planTableExpression(node.Children[1], outer)
+	if err != nil {
+		return nil, err
+	}
+
+	join := newNestedLoopJoin(node.Data, left, right)
+	if on := childOfType(node, parser.OnNode); on.Type != "" {
+		join.condition = on.Children[0]
+	}
+	if using := childOfType(node, parser.UsingNode); using.Type != "" {
+		join.rel, join.using, err = left.columns().usingJoin(right.columns(), usingNames(using))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return join, nil
+}
+
+// usingNames lists the columns of a USING clause.
+func usingNames(using narytree.Node) []string {
+	var names []string
+	for _, column := range using.Children {
+		names = append(names, column.Data)
+	}
+	return names
+}
+
+// newProject builds the operator that computes outputs from the rows of input. The types of the result
+// columns are worked out the same way semantic analysis does.
+func (db *Database) newProject(input operator, outputs []outputColumn, outer *analysisScope) (*project, error) {
+	rel := &relation{}
+	scope := &analysisScope{ relation: input.columns(), outer: outer }
+
+	for _, output := range outputs {
+		outputType, err := db.typeOf(output.expression, scope)
+		if err != nil {
+			return nil, err
+		}
+		rel.columns = append(rel.columns, relationColumn{ name: output.name, typ: outputType })
+	}
+
+	return &project{ input: input, outputs: outputs, rel: rel }, nil
+}
+
+// referenceName is the name a table of the FROM clause goes by in the rest of the query: its alias if it
+// has one, otherwise its own name.
+func referenceName(tableReference narytree.Node) string {
+	if alias := childOfType(tableReference, parser.AliasNode); alias.Type != "" {
+		return alias.Data
+	}
+	return tableReference.Data
+}
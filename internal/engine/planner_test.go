@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	runQueryTests(t, []queryTest{
+		{ "SELECT * FROM users WHERE id = 1", "[[1 bob 2.5 true 2024-01-05]]" },
+		{ "SELECT u.* FROM users u WHERE u.id = 2", "[[2 alice -3 false 2023-11-20]]" },
+		{ "SELECT id, name AS who, score * 2 AS twice FROM users WHERE id < 3", "[[1 bob 5] [2 alice -6]]" },
+		{ "SELECT users.name FROM users WHERE users.id = 4", "[[dave]]" },
+		{ "SELECT Name FROM USERS WHERE ID = 1", "[[bob]]" },
+		{ "SELECT \"name\" FROM users WHERE id = 1", "[[bob]]" },
+		{ "SELECT nope FROM users", "error: column 'nope' does not exist in table 'users'" },
+		{ "SELECT x.id FROM users", "error: table 'x' is not in the FROM clause" },
+		{ "SELECT id FROM nope", "error: table 'nope' does not exist" },
+		{ "SELECT u.id, o.id FROM users u, orders o WHERE u.id = o.user_id", "[[1 10] [1 11] [2 12]]" },
+		{ "SELECT id FROM users, orders", "error: column reference 'id' is ambiguous" },
+		{ "SELECT a.id, b.id FROM users a, users b WHERE a.id = b.id + 1", "[[2 1] [3 2] [4 3]]" },
+		{ "SELECT * FROM users u, users u", "error: table name 'u' is used more than once in the FROM clause" },
+		{ "SELECT users.id FROM users u", "error: table 'users' is not in the FROM clause" },
+	})
+}
+
+func TestJoins(t *testing.T) {
+	runQueryTests(t, []queryTest{
+		{ "SELECT u.name, o.item FROM users u JOIN orders o ON u.id = o.user_id", "[[bob book] [bob lamp] [alice pen]]" },
+		{ "SELECT u.name, o.item FROM users u INNER JOIN orders o ON u.id = o.user_id AND o.amount > 9", "[[bob book] [bob lamp]]" },
+		{ "SELECT u.name, o.item FROM users u LEFT JOIN orders o ON u.id = o.user_id", "[[bob book] [bob lamp] [alice pen] [carol <nil>] [dave <nil>]]" },
+		{ "SELECT u.name, o.item FROM users u RIGHT JOIN orders o ON u.id = o.user_id", "[[bob book] [bob lamp] [alice pen] [<nil> cup]]" },
+		{ "SELECT u.name, o.item FROM users u FULL OUTER JOIN orders o ON u.id = o.user_id", "[[bob book] [bob lamp] [alice pen] [carol <nil>] [dave <nil>] [<nil> cup]]" },
+		{ "SELECT COUNT(*) FROM users CROSS JOIN orders", "[[16]]" },
+		{ "SELECT * FROM users JOIN (SELECT user_id AS id, item FROM orders) o USING (id)", "[[1 bob 2.5 true 2024-01-05 book] [1 bob 2.5 true 2024-01-05 lamp] [2 alice -3 false 2023-11-20 pen]]" },
+		{ "SELECT id, item FROM users LEFT JOIN (SELECT user_id AS id, item FROM orders) o USING (id)", "[[1 book] [1 lamp] [2 pen] [3 <nil>] [4 <nil>]]" },
+		{ "SELECT u.name FROM users u JOIN orders o ON u.id = o.nope", "error: column 'nope' does not exist in table 'o'" },
+		{ "SELECT * FROM users u JOIN orders o ON u.id", "error: ON condition must be BOOLEAN but got INT" },
+		{ "SELECT * FROM users JOIN orders USING (nope)", "error: USING column 'nope' is not usable on the left side of the join: column 'nope' does not exist in table 'users'" },
+		{ "SELECT id FROM users JOIN orders ON users.id = orders.user_id", "error: column reference 'id' is ambiguous" },
+	})
+}
+
+func TestSelectColumnNames(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{ "SELECT id, name AS who, score * 2, u.active FROM users u", "[id who ?column? active]" },
+		{ "SELECT * FROM users", "[id name score active joined]" },
+		{ "SELECT COUNT(*), SUM(score), UPPER(name) FROM users GROUP BY name", "[count sum upper]" },
+		{ "SELECT o.*, u.name FROM orders o JOIN users u ON u.id = o.user_id", "[id user_id amount item name]" },
+		{ "SELECT id AS x FROM users UNION SELECT user_id FROM orders", "[x]" },
+	}
+
+	db := newTestDatabase(t)
+	for _, test := range tests {
+		result, err := db.Exec(test.query)
+		if err != nil {
+			t.Errorf("%s failed: %v", test.query, err)
+			continue
+		}
+		if got := fmt.Sprint(result.Columns); got != test.want {
+			t.Errorf("%s\n  got columns  %s\n  want columns %s", test.query, got, test.want)
+		}
+	}
+}
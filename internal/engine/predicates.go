@@ -0,0 +1,191 @@
+package engine
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// evalInList implements 'x [NOT] IN (a, b, ...)'. It is true when x equals one of the items. When it
+// doesn't but one of the items is NULL the answer is unknown, since the NULL could have been x.
+// InListNode -> tested expression, item, item, ...
+func evalInList(node narytree.Node, s *scope) (any, error) {
+	value, err := evalExpression(node.Children[0], s)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	var result any = false
+	for _, itemNode := range node.Children[1:] {
+		item, err := evalExpression(itemNode, s)
+		if err != nil {
+			return nil, err
+		}
+
+		if item == nil {
+			result = nil
+			continue
+		}
+
+		equal, err := compareWith("=", value, item)
+		if err != nil {
+			return nil, err
+		}
+		if equal {
+			result = true
+			break
+		}
+	}
+
+	if node.Data == "NOT IN" {
+		return not(result), nil
+	}
+	return result, nil
+}
+
+// evalBetween implements 'x [NOT] BETWEEN low AND high', which is the same as 'x >= low AND x <= high'.
+// BetweenNode -> tested expression, low, high
+func evalBetween(node narytree.Node, s *scope) (any, error) {
+	var values [3]any
+	for i := range values {
+		value, err := evalExpression(node.Children[i], s)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	aboveLow, err := compareNullable(">=", values[0], values[1])
+	if err != nil {
+		return nil, err
+	}
+	belowHigh, err := compareNullable("<=", values[0], values[2])
+	if err != nil {
+		return nil, err
+	}
+
+	var result any
+	switch {
+		case aboveLow == false || belowHigh == false:
+			result = false
+		case aboveLow == nil || belowHigh == nil:
+			result = nil
+		default:
+			result = true
+	}
+
+	if node.Data == "NOT BETWEEN" {
+		return not(result), nil
+	}
+	return result, nil
+}
+
+// evalLike implements 'x [NOT] LIKE pattern [ESCAPE c]'. In the pattern '%' matches any number of
+// characters and '_' exactly one; the escape character makes the character after it match literally.
+// LikeNode -> tested expression, pattern, optional escape character
+func evalLike(node narytree.Node, s *scope) (any, error) {
+	var values []any
+	for _, child := range node.Children {
+		value, err := evalExpression(child, s)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return nil, nil
+		}
+		if _, ok := value.(string); !ok {
+			return nil, fmt.Errorf("LIKE expects TEXT but got %s", typeName(value))
+		}
+		values = append(values, value)
+	}
+
+	escape := rune(-1)
+	if len(values) == 3 {
+		escapeText := values[2].(string)
+		if utf8.RuneCountInString(escapeText) != 1 {
+			return nil, fmt.Errorf("ESCAPE must be a single character but got '%s'", escapeText)
+		}
+		escape, _ = utf8.DecodeRuneInString(escapeText)
+	}
+
+	matches, err := matchLike([]rune(values[0].(string)), []rune(values[1].(string)), escape)
+	if err != nil {
+		return nil, err
+	}
+
+	if node.Data == "NOT LIKE" {
+		return !matches, nil
+	}
+	return matches, nil
+}
+
+// matchLike reports whether text matches a LIKE pattern. It backtracks to the last '%' on a mismatch, which
+// keeps it linear for patterns with a single '%' and avoids the blowup of naive recursion.
+func matchLike(text []rune, pattern []rune, escape rune) (bool, error) {
+	t, p := 0, 0
+	starPattern, starText := -1, 0
+
+	for t < len(text) {
+		if p < len(pattern) {
+			ch := pattern[p]
+			literal := false
+
+			if ch == escape {
+				if p + 1 >= len(pattern) {
+					return false, fmt.Errorf("LIKE pattern must not end with the escape character")
+				}
+				ch = pattern[p + 1]
+				literal = true
+			}
+
+			switch {
+				case !literal && ch == '%':
+					starPattern, starText = p, t
+					p++
+					continue
+				case (!literal && ch == '_') || ch == text[t]:
+					t++
+					if literal {
+						p += 2
+					} else {
+						p++
+					}
+					continue
+			}
+		}
+
+		if starPattern == -1 {
+			return false, nil
+		}
+		// let the last '%' swallow one more character and try again from there
+		starText++
+		t = starText
+		p = starPattern + 1
+	}
+
+	// only '%' can match what's left of the pattern
+	for p < len(pattern) {
+		if pattern[p] != '%' || pattern[p] == escape {
+			return false, nil
+		}
+		p++
+	}
+	return true, nil
+}
+
+// compareNullable is compareWith for values that may be NULL, in which case the result is unknown.
+func compareNullable(operator string, left any, right any) (any, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	return compareWith(operator, left, right)
+}
+
+// not negates a three-valued boolean, leaving unknown as unknown.
+func not(value any) any {
+	if b, ok := value.(bool); ok {
+		return !b
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/jasutiin/deebeejeebees/internal/parser"
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// relation describes the rows a query works with: which columns they have, in order, and the table each
+// column came from, so that both name and users.name can be looked up.
+type relation struct {
+	columns []relationColumn
+}
+
+type relationColumn struct {
+	table string // the name the table goes by in the query
+	name  string
+	typ   Type
+
+	// hidden columns can only be referred to with their table's name. A join with USING hides the columns
+	// it matched on behind a single column that has no table.
+	hidden bool
+}
+
+// tableRelation describes the rows of a table that the query calls name.
+func tableRelation(table *Table, name string) *relation {
+	r := &relation{}
+	for _, column := range table.Columns {
+		r.columns = append(r.columns, relationColumn{ table: name, name: column.Name, typ: columnType(column) })
+	}
+	return r
+}
+
+// renamed describes the same rows as r as the columns of a table called name, which is how the result of
+// a subquery in FROM is seen by the rest of the query.
+func (r *relation) renamed(name string) *relation {
+	renamed := &relation{}
+	for _, column := range r.columns {
+		renamed.columns = append(renamed.columns, relationColumn{ table: name, name: column.name, typ: column.typ })
+	}
+	return renamed
+}
+
+// join describes rows made of a row of r followed by a row of other.
+func (r *relation) join(other *relation) *relation {
+	joined := &relation{}
+	joined.columns = append(joined.columns, r.columns...)
+	joined.columns = append(joined.columns, other.columns...)
+	return joined
+}
+
+// usingColumn is a pair of columns that a join with USING matches on, by their positions on each side.
+type usingColumn struct {
+	left  int
+	right int
+}
+
+// usingJoin describes the rows of a join that matches rows on columns both sides have, like USING (id).
+// Each pair of matched columns is merged into one column without a table, which comes first. The matched
+// columns are hidden so that id by itself isn't ambiguous, but a.id and b.id still work.
+func (r *relation) usingJoin(other *relation, names []string) (*relation, []usingColumn, error) {
+	joined := &relation{}
+	var pairs []usingColumn
+	leftMatched := map[int]bool{}
+	rightMatched := map[int]bool{}
+
+	for _, name := range names {
+		left, err := r.resolve("", name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("USING column '%s' is not usable on the left side of the join: %w", name, err)
+		}
+		right, err := other.resolve("", name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("USING column '%s' is not usable on the right side of the join: %w", name, err)
+		}
+		if leftMatched[left] {
+			return nil, nil, fmt.Errorf("column '%s' appears more than once in USING", name)
+		}
+
+		mergedType, err := commonType(r.columns[left].typ, other.columns[right].typ)
+		if err != nil {
+			return nil, nil, fmt.Errorf("USING column '%s' has different types on each side: %w", name, err)
+		}
+
+		joined.columns = append(joined.columns, relationColumn{ name: name, typ: mergedType })
+		pairs = append(pairs, usingColumn{ left: left, right: right })
+		leftMatched[left] = true
+		rightMatched[right] = true
+	}
+
+	for i, column := range r.columns {
+		column.hidden = column.hidden || leftMatched[i]
+		joined.columns = append(joined.columns, column)
+	}
+	for i, column := range other.columns {
+		column.hidden = column.hidden || rightMatched[i]
+		joined.columns = append(joined.columns, column)
+	}
+
+	return joined, pairs, nil
+}
+
+// hasTable reports whether any of the columns come from the table called name.
+func (r *relation) hasTable(name string) bool {
+	for _, column := range r.columns {
+		if column.table == name {
+			return true
+		}
+	}
+	return false
+}
+
+// binds reports whether a column reference belongs to r: its table is one of r's tables, or a column of r
+// that isn't hidden has its name. A subquery looks up the references that don't belong to its own FROM
+// clause in the query around it.
+func (r *relation) binds(node narytree.Node) bool {
+	if node.Type == parser.QualifiedNameNode {
+		return r.hasTable(node.Children[0].Data)
+	}
+	for _, column := range r.columns {
+		if column.name == node.Data && !column.hidden {
+			return true
+		}
+	}
+	return false
+}
+
+// tables returns the names of the tables the columns come from, each one once.
+func (r *relation) tables() []string {
+	var names []string
+	for _, column := range r.columns {
+		if column.table != "" && (len(names) == 0 || names[len(names) - 1] != column.table) {
+			names = append(names, column.table)
+		}
+	}
+	return names
+}
+
+// resolve returns the position of the column a name refers to. qualifier is the table part of a name like
+// users.name, or "" when there is none. An unqualified name has to match exactly one column.
+func (r *relation) resolve(qualifier string, name string) (int, error) {
+	if qualifier != "" && !r.hasTable(qualifier) {
+		return -1, fmt.Errorf("table '%s' is not in the FROM clause", qualifier)
+	}
+
+	found := -1
+	for i, column := range r.columns {
+		if column.name != name || (qualifier != "" && column.table != qualifier) || (qualifier == "" && column.hidden) {
+			continue
+		}
+		if found != -1 {
+			return -1, fmt.Errorf("column reference '%s' is ambiguous", name)
+		}
+		found = i
+	}
+
+	if found == -1 {
+		switch tables := r.tables(); {
+			case qualifier != "":
+				return -1, fmt.Errorf("column '%s' does not exist in table '%s'", name, qualifier)
+			case len(tables) == 1:
+				return -1, fmt.Errorf("column '%s' does not exist in table '%s'", name, tables[0])
+			default:
+				return -1, fmt.Errorf("column '%s' does not exist", name)
+		}
+	}
+	return found, nil
+}
+
+// resolveColumn resolves an IdentifierNode or a QualifiedNameNode.
+// QualifiedNameNode -> IdentifierNode table, IdentifierNode column
+func (r *relation) resolveColumn(node narytree.Node) (int, error) {
+	if node.Type == parser.QualifiedNameNode {
+		return r.resolve(node.Children[0].Data, node.Children[1].Data)
+	}
+	return r.resolve("", node.Data)
+}
+
+// columnName returns a column reference the way it was written, like name or users.name.
+func columnName(node narytree.Node) string {
+	if node.Type == parser.QualifiedNameNode {
+		return node.Children[0].Data + "." + node.Children[1].Data
+	}
+	return node.Data
+}
+
+// outputColumn is one column of a query's result along with the expression that computes it.
+type outputColumn struct {
+	name       string
+	expression narytree.Node
+}
+
+// expandSelectList turns the select list into the columns of the result. '*' stands for every column of
+// the relation that isn't hidden and 't.*' for every column of the table t; both are replaced by references to the columns
+// they stand for.
+// ColumnListNode -> StarNode, AliasNode -> expression, expression, ...
+func expandSelectList(selectList narytree.Node, r *relation) ([]outputColumn, error) {
+	var columns []outputColumn
+
+	for _, item := range selectList.Children {
+		switch item.Type {
+			case parser.StarNode:
+				if item.Data != "" && !r.hasTable(item.Data) {
+					return nil, fmt.Errorf("table '%s' is not in the FROM clause", item.Data)
+				}
+				for _, column := range r.columns {
+					if (item.Data != "" && column.table != item.Data) || (item.Data == "" && column.hidden) {
+						continue
+					}
+					columns = append(columns, outputColumn{ name: column.name, expression: columnReference(column) })
+				}
+
+			case parser.AliasNode:
+				columns = append(columns, outputColumn{ name: item.Data, expression: item.Children[0] })
+
+			default:
+				columns = append(columns, outputColumn{ name: outputName(item), expression: item })
+		}
+	}
+
+	return columns, nil
+}
+
+// columnReference builds the qualified name of a column of a relation.
+func columnReference(column relationColumn) narytree.Node {
+	return narytree.Node{ Type: parser.QualifiedNameNode, Children: []narytree.Node{
+		{ Type: parser.IdentifierNode, Data: column.table },
+		{ Type: parser.IdentifierNode, Data: column.name },
+	} }
+}
+
+// outputName is the name of a result column that wasn't given an alias. Columns keep their name, function
+// calls are named after the function and subqueries after their own column; anything else is called
+// ?column?.
+func outputName(expression narytree.Node) string {
+	switch expression.Type {
+		case parser.IdentifierNode, parser.FunctionCallNode, parser.WindowFunctionNode:
+			return expression.Data
+		case parser.QualifiedNameNode:
+			return expression.Children[1].Data
+		case parser.CaseNode:
+			return "case"
+		case parser.ExistsNode:
+			return "exists"
+		case parser.SubqueryNode:
+			// a UNION takes its column names from its first query
+			query := expression.Children[0]
+			for childOfType(query, parser.SetOperationNode).Type != "" || query.Type == parser.SetOperationNode {
+				if query.Type == parser.SetOperationNode {
+					query = query.Children[0]
+				} else {
+					query = childOfType(query, parser.SetOperationNode)
+				}
+			}
+			selectList := childOfType(query, parser.ColumnListNode)
+			if first := selectList.Children[0]; first.Type == parser.AliasNode {
+				return first.Data
+			} else if first.Type != parser.StarNode {
+				return outputName(first)
+			}
+	}
+	return "?column?"
+}
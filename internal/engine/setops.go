@@ -0,0 +1,268 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jasutiin/deebeejeebees/internal/parser"
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// UNION, INTERSECT and EXCEPT combine the rows of two queries, which must have the same number of
+// columns with types that can be matched up. The result takes its column names from the query on the
+// left. Without ALL duplicates are removed from the result; with ALL a row that appears m times on the
+// left and n times on the right appears m + n times after UNION, min(m, n) times after INTERSECT and
+// max(m - n, 0) times after EXCEPT.
+
+// setOperationRelation works out the columns of the result of a set operation from the columns of its
+// two queries.
+func setOperationRelation(operation string, left *relation, right *relation) (*relation, error) {
+	kind := strings.Fields(operation)[0]
+	if len(left.columns) != len(right.columns) {
+		return nil, fmt.Errorf("each %s query must have the same number of columns", kind)
+	}
+
+	result := &relation{}
+	for i, column := range left.columns {
+		columnType, err := commonType(column.typ, right.columns[i].typ)
+		if err != nil {
+			return nil, fmt.Errorf("%s types %s and %s cannot be matched", kind, column.typ, right.columns[i].typ)
+		}
+		result.columns = append(result.columns, relationColumn{ name: column.name, typ: columnType })
+	}
+	return result, nil
+}
+
+// compoundSortKeys resolves ORDER BY of a query made of set operations. The rows only have the columns
+// of the result, so ORDER BY can't sort on anything else.
+// OrderByNode -> OrderItemNode -> expression, [NullsOrderNode], ...
+func compoundSortKeys(orderBy narytree.Node, rel *relation) ([]sortKey, error) {
+	var outputs []outputColumn
+	for i, column := range rel.columns {
+		outputs = append(outputs, outputColumn{ name: column.name, expression: slot(i) })
+	}
+
+	outputs, keys, err := sortOutputs(orderBy, outputs, len(outputs), rel)
+	if err != nil {
+		return nil, err
+	}
+	if len(outputs) > len(rel.columns) {
+		return nil, fmt.Errorf("ORDER BY on a UNION/INTERSECT/EXCEPT result must be on one of the result columns")
+	}
+	return keys, nil
+}
+
+// analyzeCompound checks a query made of set operations along with its ORDER BY, LIMIT and OFFSET.
+// SelectNode -> SetOperationNode, OrderByNode, LimitNode, OffsetNode
+func (db *Database) analyzeCompound(ast narytree.Node, outer *analysisScope) (*relation, error) {
+	rel, err := db.analyzeSetOperation(childOfType(ast, parser.SetOperationNode), outer)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := compoundSortKeys(childOfType(ast, parser.OrderByNode), rel); err != nil {
+		return nil, err
+	}
+	if err := db.analyzeRowCount("LIMIT", childOfType(ast, parser.LimitNode), outer); err != nil {
+		return nil, err
+	}
+	if err := db.analyzeRowCount("OFFSET", childOfType(ast, parser.OffsetNode), outer); err != nil {
+		return nil, err
+	}
+	return rel, nil
+}
+
+// analyzeSetOperation checks both queries of a set operation and returns the columns of its result.
+// SetOperationNode -> SelectNode or SetOperationNode, SelectNode or SetOperationNode
+func (db *Database) analyzeSetOperation(node narytree.Node, outer *analysisScope) (*relation, error) {
+	var operands []*relation
+	for _, operand := range node.Children {
+		rel, err := db.analyzeOperand(operand, outer)
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, rel)
+	}
+	return setOperationRelation(node.Data, operands[0], operands[1])
+}
+
+// analyzeOperand checks one of the queries a set operation combines.
+func (db *Database) analyzeOperand(operand narytree.Node, outer *analysisScope) (*relation, error) {
+	if operand.Type == parser.SetOperationNode {
+		return db.analyzeSetOperation(operand, outer)
+	}
+	return db.analyzeSelect(operand, outer)
+}
+
+// planCompound builds the plan of a query made of set operations, sorted and cut down by its own ORDER BY,
+// LIMIT and OFFSET.
+// SelectNode -> SetOperationNode, OrderByNode, LimitNode, OffsetNode
+func (db *Database) planCompound(ast narytree.Node, outer *analysisScope) (operator, error) {
+	plan, err := db.planSetOperation(childOfType(ast, parser.SetOperationNode), outer)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := compoundSortKeys(childOfType(ast, parser.OrderByNode), plan.columns())
+	if err != nil {
+		return nil, err
+	}
+	return planOrderAndLimit(plan, keys, ast), nil
+}
+
+// planSetOperation builds the plans of both queries of a set operation and the operator that combines
+// them.
+// SetOperationNode -> SelectNode or SetOperationNode, SelectNode or SetOperationNode
+func (db *Database) planSetOperation(node narytree.Node, outer *analysisScope) (operator, error) {
+	var operands []operator
+	for _, operand := range node.Children {
+		plan, err := db.planOperand(operand, outer)
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, plan)
+	}
+
+	rel, err := setOperationRelation(node.Data, operands[0].columns(), operands[1].columns())
+	if err != nil {
+		return nil, err
+	}
+
+	operation := strings.Fields(node.Data)
+	all := len(operation) > 1 && operation[1] == "ALL"
+	switch operation[0] {
+		case "UNION":
+			return &unionOperator{ left: operands[0], right: operands[1], rel: rel, all: all }, nil
+		case "INTERSECT":
+			return &intersectOperator{ left: operands[0], right: operands[1], rel: rel, all: all }, nil
+		default:
+			return &intersectOperator{ left: operands[0], right: operands[1], rel: rel, all: all, except: true }, nil
+	}
+}
+
+// planOperand builds the plan of one of the queries a set operation combines.
+func (db *Database) planOperand(operand narytree.Node, outer *analysisScope) (operator, error) {
+	if operand.Type == parser.SetOperationNode {
+		return db.planSetOperation(operand, outer)
+	}
+	return db.planSelect(operand, outer)
+}
+
+// unionOperator passes on the rows of its left input followed by those of its right input, skipping rows
+// it has already passed on unless it is UNION ALL.
+type unionOperator struct {
+	left    operator
+	right   operator
+	rel     *relation
+	all     bool
+	parent  *scope
+	onRight bool
+	seen    map[string]bool
+}
+
+func (o *unionOperator) columns() *relation {
+	return o.rel
+}
+
+func (o *unionOperator) open(parent *scope) error {
+	o.parent = parent
+	o.onRight = false
+	o.seen = map[string]bool{}
+	return o.left.open(parent)
+}
+
+func (o *unionOperator) next() ([]any, error) {
+	for {
+		input := o.left
+		if o.onRight {
+			input = o.right
+		}
+
+		row, err := input.next()
+		if err != nil {
+			return nil, err
+		}
+		if row == nil {
+			if o.onRight {
+				return nil, nil
+			}
+			// the right input is only started once the left one is done
+			o.onRight = true
+			if err := o.right.open(o.parent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !o.all {
+			key := rowKey(row)
+			if o.seen[key] {
+				continue
+			}
+			o.seen[key] = true
+		}
+		return row, nil
+	}
+}
+
+// intersectOperator runs INTERSECT, or EXCEPT when except is set. The right input is read when it is
+// opened, counting how many times each row appears in it, and the rows of the left input are then passed
+// on or dropped as they come according to the counts.
+type intersectOperator struct {
+	left   operator
+	right  operator
+	rel    *relation
+	all    bool
+	except bool
+	counts map[string]int
+	seen   map[string]bool
+}
+
+func (o *intersectOperator) columns() *relation {
+	return o.rel
+}
+
+func (o *intersectOperator) open(parent *scope) error {
+	rows, err := drain(o.right, parent)
+	if err != nil {
+		return err
+	}
+
+	o.counts = map[string]int{}
+	for _, row := range rows {
+		o.counts[rowKey(row)]++
+	}
+	o.seen = map[string]bool{}
+	return o.left.open(parent)
+}
+
+func (o *intersectOperator) next() ([]any, error) {
+	for {
+		row, err := o.left.next()
+		if err != nil || row == nil {
+			return nil, err
+		}
+
+		key := rowKey(row)
+		if !o.all {
+			// each distinct row is decided once, by its first appearance on the left
+			if o.seen[key] {
+				continue
+			}
+			o.seen[key] = true
+			if (o.counts[key] > 0) != o.except {
+				return row, nil
+			}
+			continue
+		}
+
+		// with ALL every appearance on the right cancels out, or matches, one appearance on the left
+		matched := o.counts[key] > 0
+		if matched {
+			o.counts[key]--
+		}
+		if matched != o.except {
+			return row, nil
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package engine
+
+import "testing"
+
+func TestSetOperations(t *testing.T) {
+	runQueryTests(t, []queryTest{
+		{ "SELECT user_id FROM orders UNION SELECT id FROM users", "[[1] [2] [9] [3] [4]]" },
+		{ "SELECT user_id FROM orders UNION ALL SELECT id FROM users WHERE id < 3", "[[1] [1] [2] [9] [1] [2]]" },
+		{ "SELECT id FROM users INTERSECT SELECT user_id FROM orders", "[[1] [2]]" },
+		{ "SELECT user_id FROM orders INTERSECT ALL SELECT 1 FROM users", "[[1] [1]]" },
+		{ "SELECT id FROM users EXCEPT SELECT user_id FROM orders", "[[3] [4]]" },
+		{ "SELECT user_id FROM orders EXCEPT ALL SELECT 1 FROM users WHERE id = 1", "[[1] [2] [9]]" },
+		{ "SELECT id AS x FROM users UNION SELECT user_id FROM orders ORDER BY x DESC LIMIT 3", "[[9] [4] [3]]" },
+		{ "SELECT id FROM users UNION SELECT amount FROM orders ORDER BY 1 LIMIT 3", "[[1] [2] [3]]" },
+		{ "SELECT id FROM users UNION (SELECT user_id FROM orders ORDER BY user_id LIMIT 1)", "[[1] [2] [3] [4]]" },
+		{ "(SELECT id FROM users WHERE id = 1) UNION SELECT id FROM users WHERE id = 2", "[[1] [2]]" },
+		{ "(SELECT id FROM users ORDER BY id DESC LIMIT 1) INTERSECT SELECT user_id FROM orders", "[]" },
+		{ "SELECT id FROM users WHERE id IN ((SELECT user_id FROM orders) EXCEPT SELECT 2 FROM users)", "[[1]]" },
+		{ "(SELECT id FROM users)", "error: syntax error at line 1, column 23: expected 'UNION', 'INTERSECT' or 'EXCEPT' but got end of input" },
+		{ "SELECT id FROM users UNION SELECT id, item FROM orders", "error: each UNION query must have the same number of columns" },
+		{ "SELECT id FROM users UNION SELECT item FROM orders", "error: UNION types INT and TEXT cannot be matched" },
+		{ "SELECT id FROM users UNION SELECT user_id FROM orders ORDER BY name", "error: ORDER BY on a UNION/INTERSECT/EXCEPT result must be on one of the result columns" },
+	})
+}
@@ -0,0 +1,343 @@
+package engine
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/jasutiin/deebeejeebees/internal/parser"
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// sortKey is one item of ORDER BY, resolved to the column of the result rows it sorts on.
+type sortKey struct {
+	column     int
+	descending bool
+	nullsFirst bool
+}
+
+// sortOutputs works out what each item of ORDER BY sorts on. The first visible outputs are the columns
+// of the result, any after them are extra columns the query needs. An item that isn't already one of
+// the outputs is added as another extra column, which is computed along with the others and dropped
+// once the rows are sorted.
+// OrderByNode -> OrderItemNode -> expression, [NullsOrderNode], ...
+func sortOutputs(orderBy narytree.Node, outputs []outputColumn, visible int, rel *relation) ([]outputColumn, []sortKey, error) {
+	var keys []sortKey
+
+	for _, item := range orderBy.Children {
+		key := sortKey{ descending: item.Data == "DESC" }
+
+		// NULLs sort as if they were larger than any other value unless NULLS FIRST or LAST says otherwise
+		key.nullsFirst = key.descending
+		if nulls := childOfType(item, parser.NullsOrderNode); nulls.Type != "" {
+			key.nullsFirst = nulls.Data == "FIRST"
+		}
+
+		var err error
+		if outputs, key.column, err = resultColumn("ORDER BY", item.Children[0], outputs, visible, rel); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return outputs, keys, nil
+}
+
+// resultColumn finds the output that an item of ORDER BY or DISTINCT ON stands for. An item can name a
+// column of the result by its name or its position, like 'ORDER BY total' or 'ORDER BY 2'; anything else
+// is an expression over the rows of the FROM clause, which is added to outputs if it isn't there yet.
+func resultColumn(clause string, expression narytree.Node, outputs []outputColumn, visible int, rel *relation) ([]outputColumn, int, error) {
+	column := -1
+
+	switch expression.Type {
+		case parser.NumberLiteralNode:
+			if position, isInt := expression.Value.(int64); isInt {
+				if position < 1 || position > int64(visible) {
+					return nil, -1, fmt.Errorf("%s position %d is not in select list", clause, position)
+				}
+				return outputs, int(position) - 1, nil
+			}
+
+		case parser.IdentifierNode:
+			for i, output := range outputs[:visible] {
+				if output.name != expression.Data {
+					continue
+				}
+				if column != -1 && !sameExpression(outputs[column].expression, output.expression, rel) {
+					return nil, -1, fmt.Errorf("%s '%s' is ambiguous", clause, expression.Data)
+				}
+				column = i
+			}
+			if column != -1 {
+				return outputs, column, nil
+			}
+	}
+
+	for i, output := range outputs {
+		if sameExpression(output.expression, expression, rel) {
+			return outputs, i, nil
+		}
+	}
+
+	outputs = append(outputs, outputColumn{ name: outputName(expression), expression: expression })
+	return outputs, len(outputs) - 1, nil
+}
+
+// compareRows compares two rows by the sort keys, returning -1, 0 or 1 like compareValues.
+func compareRows(a []any, b []any, keys []sortKey) (int, error) {
+	for _, key := range keys {
+		av, bv := a[key.column], b[key.column]
+
+		var order int
+		switch {
+			case av == nil && bv == nil:
+				continue
+			case av == nil:
+				order = 1
+				if key.nullsFirst {
+					order = -1
+				}
+			case bv == nil:
+				order = -1
+				if key.nullsFirst {
+					order = 1
+				}
+			default:
+				var err error
+				if order, err = compareValues(av, bv); err != nil {
+					return 0, err
+				}
+				if key.descending {
+					order = -order
+				}
+		}
+
+		if order != 0 {
+			return order, nil
+		}
+	}
+	return 0, nil
+}
+
+// sortRows sorts rows by the sort keys, keeping rows that are equal in the order they came in.
+func sortRows(rows [][]any, keys []sortKey) error {
+	var sortErr error
+	sort.SliceStable(rows, func(i, j int) bool {
+		order, err := compareRows(rows[i], rows[j], keys)
+		if err != nil && sortErr == nil {
+			sortErr = err
+		}
+		return order < 0
+	})
+	return sortErr
+}
+
+// sorter sorts all the rows of its input. The rows are read and sorted when it is opened.
+type sorter struct {
+	input    operator
+	keys     []sortKey
+	rows     [][]any
+	position int
+}
+
+func (o *sorter) columns() *relation {
+	return o.input.columns()
+}
+
+func (o *sorter) open(parent *scope) error {
+	rows, err := drain(o.input, parent)
+	if err != nil {
+		return err
+	}
+	if err := sortRows(rows, o.keys); err != nil {
+		return err
+	}
+	o.rows = rows
+	o.position = 0
+	return nil
+}
+
+func (o *sorter) next() ([]any, error) {
+	if o.position >= len(o.rows) {
+		return nil, nil
+	}
+	row := o.rows[o.position]
+	o.position++
+	return row, nil
+}
+
+// topN sorts its input when only the first rows of the sorted result are wanted, as with ORDER BY
+// followed by LIMIT. Instead of sorting every row it keeps the best LIMIT + OFFSET rows seen so far in a
+// heap, so the memory it needs depends on the limit and not on the size of the input.
+type topN struct {
+	sorter
+	limit  narytree.Node
+	offset narytree.Node
+}
+
+func (o *topN) open(parent *scope) error {
+	limit, limited, err := evalRowCount("LIMIT", o.limit, parent)
+	if err != nil {
+		return err
+	}
+	offset, _, err := evalRowCount("OFFSET", o.offset, parent)
+	if err != nil {
+		return err
+	}
+	// with a limit so large that LIMIT + OFFSET overflows every row is kept anyway
+	if !limited || limit > math.MaxInt64 - offset {
+		return o.sorter.open(parent)
+	}
+
+	if err := o.input.open(parent); err != nil {
+		return err
+	}
+
+	kept := &rowHeap{ keys: o.keys }
+	for sequence := 0; ; sequence++ {
+		row, err := o.input.next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+
+		candidate := sequencedRow{ row: row, sequence: sequence }
+		switch {
+			case int64(kept.Len()) < limit + offset:
+				heap.Push(kept, candidate)
+			case kept.Len() > 0 && kept.less(candidate, kept.rows[0]):
+				kept.rows[0] = candidate
+				heap.Fix(kept, 0)
+		}
+		if kept.err != nil {
+			return kept.err
+		}
+	}
+
+	// popping the heap hands out the worst row first
+	o.rows = make([][]any, kept.Len())
+	for i := len(o.rows) - 1; i >= 0; i-- {
+		o.rows[i] = heap.Pop(kept).(sequencedRow).row
+	}
+	o.position = 0
+	return kept.err
+}
+
+// sequencedRow is a row along with its position in the input, which breaks ties between equal rows so
+// that topN keeps the same rows a stable sort would.
+type sequencedRow struct {
+	row      []any
+	sequence int
+}
+
+// rowHeap is a heap of rows with the row that sorts last on top.
+type rowHeap struct {
+	rows []sequencedRow
+	keys []sortKey
+	err  error
+}
+
+// less reports whether a sorts before b.
+func (h *rowHeap) less(a sequencedRow, b sequencedRow) bool {
+	order, err := compareRows(a.row, b.row, h.keys)
+	if err != nil && h.err == nil {
+		h.err = err
+	}
+	if order == 0 {
+		return a.sequence < b.sequence
+	}
+	return order < 0
+}
+
+func (h *rowHeap) Len() int           { return len(h.rows) }
+func (h *rowHeap) Less(i, j int) bool { return h.less(h.rows[j], h.rows[i]) }
+func (h *rowHeap) Swap(i, j int)      { h.rows[i], h.rows[j] = h.rows[j], h.rows[i] }
+func (h *rowHeap) Push(x any)         { h.rows = append(h.rows, x.(sequencedRow)) }
+
+func (h *rowHeap) Pop() any {
+	last := h.rows[len(h.rows) - 1]
+	h.rows = h.rows[:len(h.rows) - 1]
+	return last
+}
+
+// limiter skips the first OFFSET rows of its input and passes on at most LIMIT of the rest.
+type limiter struct {
+	input     operator
+	limit     narytree.Node
+	offset    narytree.Node
+	remaining int64
+	limited   bool
+	skip      int64
+}
+
+func (o *limiter) columns() *relation {
+	return o.input.columns()
+}
+
+func (o *limiter) open(parent *scope) error {
+	var err error
+	if o.remaining, o.limited, err = evalRowCount("LIMIT", o.limit, parent); err != nil {
+		return err
+	}
+	if o.skip, _, err = evalRowCount("OFFSET", o.offset, parent); err != nil {
+		return err
+	}
+	return o.input.open(parent)
+}
+
+func (o *limiter) next() ([]any, error) {
+	for {
+		if o.limited && o.remaining <= 0 {
+			return nil, nil
+		}
+
+		row, err := o.input.next()
+		if err != nil || row == nil {
+			return nil, err
+		}
+
+		if o.skip > 0 {
+			o.skip--
+			continue
+		}
+		o.remaining--
+		return row, nil
+	}
+}
+
+// evalRowCount computes the number of rows given to LIMIT or OFFSET. ok is false when there is no count,
+// because the clause was left out or the count is NULL.
+// LimitNode -> expression
+// OffsetNode -> expression
+func evalRowCount(clause string, node narytree.Node, parent *scope) (count int64, ok bool, err error) {
+	if len(node.Children) == 0 {
+		return 0, false, nil
+	}
+
+	value, err := evalExpression(node.Children[0], parent)
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch v := value.(type) {
+		case nil:
+			return 0, false, nil
+		case int64:
+			count = v
+		case float64:
+			if v != float64(int64(v)) {
+				return 0, false, fmt.Errorf("%s must be a whole number, got %v", clause, v)
+			}
+			count = int64(v)
+		default:
+			return 0, false, fmt.Errorf("%s must be a number, got %s", clause, typeName(value))
+	}
+
+	if count < 0 {
+		return 0, false, fmt.Errorf("%s must not be negative", clause)
+	}
+	return count, true, nil
+}
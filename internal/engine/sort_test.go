@@ -0,0 +1,29 @@
+package engine
+
+import "testing"
+
+func TestOrderByLimitOffset(t *testing.T) {
+	runQueryTests(t, []queryTest{
+		{ "SELECT id FROM users ORDER BY score", "[[2] [1] [4] [3]]" },
+		{ "SELECT id FROM users ORDER BY score DESC", "[[3] [4] [1] [2]]" },
+		{ "SELECT id FROM users ORDER BY score NULLS FIRST", "[[3] [2] [1] [4]]" },
+		{ "SELECT id FROM users ORDER BY score DESC NULLS LAST", "[[4] [1] [2] [3]]" },
+		{ "SELECT name FROM users ORDER BY 1", "[[alice] [bob] [carol] [dave]]" },
+		{ "SELECT name AS n FROM users ORDER BY n DESC", "[[dave] [carol] [bob] [alice]]" },
+		{ "SELECT name FROM users ORDER BY active, id DESC", "[[alice] [bob] [dave] [carol]]" },
+		{ "SELECT id FROM users ORDER BY id LIMIT 2", "[[1] [2]]" },
+		{ "SELECT id FROM users ORDER BY id LIMIT 2 OFFSET 1", "[[2] [3]]" },
+		{ "SELECT id FROM users ORDER BY id OFFSET 3", "[[4]]" },
+		{ "SELECT id FROM users ORDER BY id DESC LIMIT 0", "[]" },
+		{ "SELECT id FROM users LIMIT 2", "[[1] [2]]" },
+		{ "SELECT id FROM users ORDER BY score LIMIT 10", "[[2] [1] [4] [3]]" },
+		{ "SELECT id FROM users ORDER BY id LIMIT 9223372036854775807 OFFSET 1", "[[2] [3] [4]]" },
+		{ "SELECT id FROM users ORDER BY id DESC LIMIT 9223372036854775807 OFFSET 9223372036854775807", "[]" },
+		{ "SELECT id FROM users ORDER BY 5", "error: ORDER BY position 5 is not in select list" },
+		{ "SELECT name, id FROM users ORDER BY 0x2 DESC LIMIT 1", "[[dave 4]]" },
+		{ "SELECT id FROM users LIMIT -1", "error: LIMIT must not be negative" },
+		{ "SELECT id FROM users LIMIT 'a'", "error: LIMIT must be INT but got TEXT" },
+		{ "SELECT id FROM users LIMIT id", "error: column 'id' does not exist" },
+		{ "SELECT user_id FROM orders GROUP BY user_id ORDER BY SUM(amount) DESC", "[[1] [9] [2]]" },
+	})
+}
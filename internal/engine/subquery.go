@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jasutiin/deebeejeebees/internal/parser"
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// A subquery is a query inside another statement. In FROM it stands in for a table; in an expression it
+// is run every time the expression is evaluated, with the current row of the query around it in scope,
+// so a correlated subquery like 'SELECT name FROM users u WHERE EXISTS (SELECT 1 FROM orders o WHERE
+// o.user_id = u.id)' can look at the row it is run for.
+
+// subqueryScan reads the rows of a subquery in FROM. The rows are passed on as they are; only the names of
+// the columns change, so that they belong to the subquery's alias.
+type subqueryScan struct {
+	input operator
+	rel   *relation
+}
+
+func (o *subqueryScan) columns() *relation {
+	return o.rel
+}
+
+func (o *subqueryScan) open(parent *scope) error {
+	return o.input.open(parent)
+}
+
+func (o *subqueryScan) next() ([]any, error) {
+	return o.input.next()
+}
+
+// typeOfScalarSubquery checks a subquery whose rows are used as single values, which is every subquery in
+// an expression apart from EXISTS, and returns the type of its only column.
+// SubqueryNode -> SelectNode
+func (db *Database) typeOfScalarSubquery(node narytree.Node, scope *analysisScope) (Type, error) {
+	rel, err := db.analyzeSelect(node.Children[0], scope)
+	if err != nil {
+		return "", err
+	}
+	if len(rel.columns) != 1 {
+		return "", fmt.Errorf("subquery must return only one column but returns %d", len(rel.columns))
+	}
+	return rel.columns[0].typ, nil
+}
+
+// openSubquery starts running a subquery for the current row of s. The plan is made the first time the
+// subquery runs and reused after that.
+// SubqueryNode -> SelectNode
+func openSubquery(node narytree.Node, s *scope) (operator, error) {
+	key := &node.Children[0] // the same for every copy of node
+	plan, planned := s.exec.subqueries[key]
+	if !planned {
+		var err error
+		if plan, err = s.exec.db.planSelect(node.Children[0], s.analysisScope()); err != nil {
+			return nil, err
+		}
+		s.exec.subqueries[key] = plan
+	}
+
+	if err := plan.open(s); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// evalScalarSubquery returns the value of the only row of a subquery, or NULL if it has no rows.
+// SubqueryNode -> SelectNode
+func evalScalarSubquery(node narytree.Node, s *scope) (any, error) {
+	plan, err := openSubquery(node, s)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := plan.next()
+	if err != nil || row == nil {
+		return nil, err
+	}
+
+	another, err := plan.next()
+	if err != nil {
+		return nil, err
+	}
+	if another != nil {
+		return nil, fmt.Errorf("more than one row returned by a subquery used as an expression")
+	}
+	return row[0], nil
+}
+
+// evalExists reports whether a subquery returns any rows. It stops at the first one.
+// ExistsNode -> SubqueryNode
+func evalExists(node narytree.Node, s *scope) (any, error) {
+	plan, err := openSubquery(node.Children[0], s)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := plan.next()
+	return row != nil, err
+}
+
+// evalQuantified compares a value with every row of a subquery. 'x IN (SELECT ...)' is the same as
+// 'x = ANY (SELECT ...)': true if any comparison is true. ALL is true if every comparison is, so it is
+// true for a subquery without rows. When the answer depends on comparisons with NULL it is unknown.
+// InSubqueryNode -> tested expression, SubqueryNode
+// QuantifiedNode -> tested expression, SubqueryNode
+func evalQuantified(node narytree.Node, s *scope) (any, error) {
+	operator, quantifier := "=", "ANY"
+	if node.Type == parser.QuantifiedNode {
+		operator, quantifier, _ = strings.Cut(node.Data, " ")
+	}
+
+	tested, err := evalExpression(node.Children[0], s)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := openSubquery(node.Children[1], s)
+	if err != nil {
+		return nil, err
+	}
+
+	// ANY stops at the first true comparison and ALL at the first false one
+	decisive := quantifier == "ANY"
+	var result any = !decisive
+	for {
+		row, err := plan.next()
+		if err != nil {
+			return nil, err
+		}
+		if row == nil {
+			break
+		}
+
+		matches, err := compareNullable(operator, tested, row[0])
+		if err != nil {
+			return nil, err
+		}
+		if matches == decisive {
+			result = decisive
+			break
+		}
+		if matches == nil {
+			result = nil
+		}
+	}
+
+	if node.Data == "NOT IN" {
+		return not(result), nil
+	}
+	return result, nil
+}
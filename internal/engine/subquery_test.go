@@ -0,0 +1,24 @@
+package engine
+
+import "testing"
+
+func TestSubqueries(t *testing.T) {
+	runQueryTests(t, []queryTest{
+		{ "SELECT id, (SELECT COUNT(*) FROM orders WHERE orders.user_id = users.id) FROM users", "[[1 2] [2 1] [3 0] [4 0]]" },
+		{ "SELECT name FROM users WHERE EXISTS (SELECT 1 FROM orders WHERE user_id = users.id)", "[[bob] [alice]]" },
+		{ "SELECT name FROM users WHERE NOT EXISTS (SELECT 1 FROM orders WHERE user_id = users.id)", "[[carol] [dave]]" },
+		{ "SELECT name FROM users WHERE id IN (SELECT user_id FROM orders)", "[[bob] [alice]]" },
+		{ "SELECT name FROM users WHERE id NOT IN (SELECT user_id FROM orders)", "[[carol] [dave]]" },
+		{ "SELECT id FROM orders WHERE amount > ALL (SELECT amount FROM orders WHERE user_id = 2)", "[[10] [11] [13]]" },
+		{ "SELECT id FROM orders WHERE amount < ANY (SELECT score FROM users)", "[[10] [12] [13]]" },
+		{ "SELECT t.n FROM (SELECT name AS n FROM users WHERE id < 3) AS t", "[[bob] [alice]]" },
+		{ "SELECT big.total FROM (SELECT user_id, SUM(amount) AS total FROM orders GROUP BY user_id) big WHERE big.total > 6", "[[29.5] [7]]" },
+		{ "SELECT (SELECT id FROM orders) FROM users", "error: more than one row returned by a subquery used as an expression" },
+		{ "SELECT (SELECT id, amount FROM orders) FROM users", "error: subquery must return only one column but returns 2" },
+		{ "SELECT id FROM users WHERE id IN (SELECT user_id, id FROM orders)", "error: subquery must return only one column but returns 2" },
+		{ "SELECT id FROM (SELECT id FROM users)", "error: syntax error at line 1, column 38: a subquery in FROM must have an alias" },
+		{ "SELECT id FROM users WHERE id IN (WITH c AS (SELECT user_id FROM orders) SELECT user_id FROM c)", "[[1] [2]]" },
+		{ "SELECT (WITH c AS (SELECT 5 AS v FROM users WHERE id = 1) SELECT v FROM c) FROM users WHERE id = 1", "[[5]]" },
+		{ "SELECT ((SELECT id FROM orders WHERE id = 10) + 1) FROM users WHERE id = 1", "[[11]]" },
+	})
+}
@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Values inside the engine are always one of: nil for NULL, int64, float64, string or bool.
+
+// normalizeValue converts a Go value handed to the engine into one of the value types the engine uses.
+func normalizeValue(value any) (any, error) {
+	switch v := value.(type) {
+		case nil, int64, float64, string, bool:
+			return v, nil
+		case int:
+			return int64(v), nil
+		case int8:
+			return int64(v), nil
+		case int16:
+			return int64(v), nil
+		case int32:
+			return int64(v), nil
+		case uint8:
+			return int64(v), nil
+		case uint16:
+			return int64(v), nil
+		case uint32:
+			return int64(v), nil
+		case uint:
+			if uint64(v) > math.MaxInt64 {
+				return nil, fmt.Errorf("value %d is too large", v)
+			}
+			return int64(v), nil
+		case uint64:
+			if v > math.MaxInt64 {
+				return nil, fmt.Errorf("value %d is too large", v)
+			}
+			return int64(v), nil
+		case float32:
+			return float64(v), nil
+		case []byte:
+			return string(v), nil
+		case time.Time:
+			return v.Format(dateLayout), nil
+		default:
+			return nil, fmt.Errorf("unsupported type %T", value)
+	}
+}
+
+// toFloat returns a numeric value as a float64.
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+		case int64:
+			return float64(v), true
+		case float64:
+			return v, true
+	}
+	return 0, false
+}
+
+// compareValues returns -1, 0 or 1 depending on whether a is smaller than, equal to or larger than b.
+// Integers and floats can be compared with each other, anything else has to be of the same type. NULLs
+// must be handled by the caller.
+func compareValues(a any, b any) (int, error) {
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			ai, aIsInt := a.(int64)
+			bi, bIsInt := b.(int64)
+			if aIsInt && bIsInt {
+				return compareOrdered(ai, bi), nil
+			}
+			return compareOrdered(af, bf), nil
+		}
+	}
+
+	switch av := a.(type) {
+		case string:
+			if bv, ok := b.(string); ok {
+				return compareOrdered(av, bv), nil
+			}
+		case bool:
+			if bv, ok := b.(bool); ok {
+				return compareOrdered(boolToInt(av), boolToInt(bv)), nil
+			}
+	}
+
+	return 0, fmt.Errorf("cannot compare %s with %s", typeName(a), typeName(b))
+}
+
+func compareOrdered[T int64 | float64 | string | int](a T, b T) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// valueType is the Type of a value that isn't NULL.
+func valueType(value any) Type {
+	switch value.(type) {
+		case int64:
+			return TypeInt
+		case float64:
+			return TypeDouble
+		case string:
+			return TypeText
+		case bool:
+			return TypeBoolean
+		default:
+			return TypeAny
+	}
+}
+
+// typeName describes the type of a value for error messages.
+func typeName(value any) string {
+	switch value.(type) {
+		case nil:
+			return "NULL"
+		case int64:
+			return "INT"
+		case float64:
+			return "DOUBLE"
+		case string:
+			return "TEXT"
+		case bool:
+			return "BOOLEAN"
+		default:
+			return fmt.Sprintf("%T", value)
+	}
+}
+
+// valueKey returns a value in a form that can be used as a map key, such that two values are the same key
+// exactly when they are equal. Whole floats become integers so that 1 and 1.0 are the same key.
+func valueKey(value any) any {
+	if f, ok := value.(float64); ok && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return int64(f)
+	}
+	return value
+}
+
+// rowKey turns a list of values into a single string that is the same for two lists exactly when their
+// values are equal one by one. NULLs are equal to each other here, which is what grouping and removing
+// duplicates need.
+func rowKey(values []any) string {
+	var key strings.Builder
+	for _, value := range values {
+		switch v := valueKey(value).(type) {
+			case nil:
+				key.WriteString("n;")
+			case string:
+				fmt.Fprintf(&key, "s%d:%s;", len(v), v)
+			default:
+				fmt.Fprintf(&key, "%s:%v;", typeName(v), v)
+		}
+	}
+	return key.String()
+}
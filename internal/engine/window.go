@@ -0,0 +1,641 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jasutiin/deebeejeebees/internal/parser"
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// A window function computes a value for every row from a set of rows around it, its window, without
+// merging the rows into one like GROUP BY does. PARTITION BY splits the rows into partitions, ORDER BY
+// sorts each partition, and the frame picks the rows of the partition that an aggregate sees. Without a
+// frame an aggregate sees the rows from the start of the partition up to the current row and the rows
+// that sort the same as it, its peers; without ORDER BY every row of the partition is a peer.
+//
+// Window functions are computed after grouping and HAVING, so their arguments can use aggregates, and
+// before the select list, which reads their values from extra columns added to the rows.
+
+// windowFunctions are the functions that can only be called with OVER, by upper-case name. Aggregates
+// can be called with OVER as well. The signatures only check the arguments.
+var windowFunctions = map[string]Function{
+	"ROW_NUMBER": { Name: "ROW_NUMBER", Returns: TypeInt },
+	"RANK":       { Name: "RANK", Returns: TypeInt },
+	"DENSE_RANK": { Name: "DENSE_RANK", Returns: TypeInt },
+	"LAG":        { Name: "LAG", Params: []Type{ TypeAny, TypeInt, TypeAny }, Optional: 2 },
+	"LEAD":       { Name: "LEAD", Params: []Type{ TypeAny, TypeInt, TypeAny }, Optional: 2 },
+}
+
+// containsWindowFunction reports whether there is a window function anywhere in node. Window functions in
+// subqueries don't count, they belong to the subquery.
+func containsWindowFunction(node narytree.Node) bool {
+	if node.Type == parser.WindowFunctionNode {
+		return true
+	}
+	if node.Type == parser.SubqueryNode {
+		return false
+	}
+	for _, child := range node.Children {
+		if containsWindowFunction(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// noWindowFunctions fails if an expression of a clause that is computed before window functions, like
+// WHERE, calls one.
+func noWindowFunctions(clause string, node narytree.Node) error {
+	if containsWindowFunction(node) {
+		return fmt.Errorf("window functions are not allowed in %s", clause)
+	}
+	return nil
+}
+
+// windowParts splits a window function into its arguments and its window.
+// WindowFunctionNode -> [DistinctNode], argument, ..., WindowNode
+func windowParts(node narytree.Node) ([]narytree.Node, narytree.Node) {
+	return node.Children[:len(node.Children) - 1], node.Children[len(node.Children) - 1]
+}
+
+// typeOfWindowFunction checks a window function and returns the type of its result.
+// WindowFunctionNode -> [DistinctNode], argument, ..., WindowNode -> [PartitionByNode], [OrderByNode], [FrameNode]
+func (db *Database) typeOfWindowFunction(node narytree.Node, scope *analysisScope) (Type, error) {
+	arguments, window := windowParts(node)
+
+	var expressions []narytree.Node
+	expressions = append(expressions, arguments...)
+	expressions = append(expressions, childOfType(window, parser.PartitionByNode).Children...)
+	for _, item := range childOfType(window, parser.OrderByNode).Children {
+		expressions = append(expressions, item.Children[0])
+	}
+	for _, expression := range expressions {
+		if containsWindowFunction(expression) {
+			return "", fmt.Errorf("window function calls cannot be nested")
+		}
+	}
+	for _, expression := range expressions[len(arguments):] {
+		if _, err := db.typeOf(expression, scope); err != nil {
+			return "", err
+		}
+	}
+
+	if frame := childOfType(window, parser.FrameNode); frame.Type != "" {
+		if err := db.analyzeFrame(frame, scope.outer); err != nil {
+			return "", err
+		}
+	}
+
+	name := strings.ToUpper(node.Data)
+	if aggregate, ok := lookupAggregate(name); ok {
+		return db.typeOfWindowAggregate(aggregate, arguments, scope)
+	}
+
+	function, ok := windowFunctions[name]
+	if !ok {
+		if _, ok := db.functions.Lookup(node.Data); ok {
+			return "", fmt.Errorf("OVER specified, but %s is not a window function nor an aggregate function", node.Data)
+		}
+		return "", fmt.Errorf("function '%s' does not exist", node.Data)
+	}
+
+	var argTypes []Type
+	for _, argument := range arguments {
+		if argument.Type == parser.StarNode {
+			return "", fmt.Errorf("function %s does not accept '*'", function.Name)
+		}
+		if argument.Type == parser.DistinctNode {
+			return "", fmt.Errorf("DISTINCT is only allowed in aggregate functions, not in %s", function.Name)
+		}
+		argType, err := db.typeOf(argument, scope)
+		if err != nil {
+			return "", err
+		}
+		argTypes = append(argTypes, argType)
+	}
+	resultType, err := function.checkArgs(argTypes)
+	if err != nil {
+		return "", err
+	}
+
+	// LAG and LEAD return the value of their first argument, or the default given as the third
+	if function.Name == "LAG" || function.Name == "LEAD" {
+		resultType = argTypes[0]
+		if len(argTypes) == 3 {
+			if resultType, err = commonType(argTypes[0], argTypes[2]); err != nil {
+				return "", fmt.Errorf("%s types %s and %s cannot be matched", function.Name, argTypes[0], argTypes[2])
+			}
+		}
+	}
+	return resultType, nil
+}
+
+// typeOfWindowAggregate checks an aggregate function called with OVER.
+func (db *Database) typeOfWindowAggregate(aggregate *aggregateFunction, arguments []narytree.Node, scope *analysisScope) (Type, error) {
+	if len(arguments) > 0 && arguments[0].Type == parser.DistinctNode {
+		return "", fmt.Errorf("DISTINCT is not implemented for window functions")
+	}
+	if len(arguments) != 1 {
+		return "", fmt.Errorf("function %s takes 1 arguments but got %d", aggregate.name, len(arguments))
+	}
+
+	argType := TypeAny
+	if arguments[0].Type == parser.StarNode {
+		if !aggregate.acceptsStar {
+			return "", fmt.Errorf("function %s does not accept '*'", aggregate.name)
+		}
+	} else {
+		var err error
+		if argType, err = db.typeOf(arguments[0], scope); err != nil {
+			return "", err
+		}
+	}
+	return aggregate.resultType(argType)
+}
+
+// frameBoundOrder puts the bounds of a frame in the order of the rows they can stand for.
+var frameBoundOrder = map[string]int{
+	"UNBOUNDED PRECEDING": 0,
+	"PRECEDING":           1,
+	"CURRENT ROW":         2,
+	"FOLLOWING":           3,
+	"UNBOUNDED FOLLOWING": 4,
+}
+
+// analyzeFrame checks the frame of a window. The offsets of its bounds are computed once before the query
+// runs, like LIMIT, so they can't refer to the query's own columns.
+// FrameNode -> FrameBoundNode start, FrameBoundNode end
+func (db *Database) analyzeFrame(frame narytree.Node, outer *analysisScope) error {
+	start, end := frame.Children[0], frame.Children[1]
+	switch {
+		case start.Data == "UNBOUNDED FOLLOWING":
+			return fmt.Errorf("frame start cannot be UNBOUNDED FOLLOWING")
+		case end.Data == "UNBOUNDED PRECEDING":
+			return fmt.Errorf("frame end cannot be UNBOUNDED PRECEDING")
+		case start.Data == "CURRENT ROW" && frameBoundOrder[end.Data] < frameBoundOrder[start.Data]:
+			return fmt.Errorf("frame starting from current row cannot have preceding rows")
+		case start.Data == "FOLLOWING" && frameBoundOrder[end.Data] < frameBoundOrder[start.Data]:
+			return fmt.Errorf("frame starting from following row cannot have preceding rows")
+	}
+
+	for _, bound := range frame.Children {
+		if err := db.analyzeRowCount("frame offset", bound, outer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// windowCall is a window function found in a query.
+type windowCall struct {
+	node      narytree.Node
+	name      string // upper case
+	arguments []narytree.Node
+	aggregate *aggregateFunction // nil for the functions that aren't aggregates
+	frame     narytree.Node
+}
+
+// windowSpec is a PARTITION BY and ORDER BY that one or more window functions share. The rows are sorted
+// once for all of them.
+type windowSpec struct {
+	partition []narytree.Node
+	order     []narytree.Node // OrderItemNodes
+	calls     []int
+}
+
+// planWindows adds the operator that computes the window functions of the outputs, if there are any, and
+// replaces the window functions in the outputs by slots that read their values.
+func (db *Database) planWindows(plan operator, outputs []outputColumn, outer *analysisScope) (operator, []outputColumn, error) {
+	var nodes []narytree.Node
+	for _, output := range outputs {
+		nodes = collectWindowFunctions(nodes, output.expression, plan.columns())
+	}
+	if len(nodes) == 0 {
+		return plan, outputs, nil
+	}
+
+	input := plan.columns()
+	window := &windowOperator{ input: plan, rel: &relation{} }
+	window.rel.columns = append(window.rel.columns, input.columns...)
+
+	for _, node := range nodes {
+		callType, err := db.typeOf(node, &analysisScope{ relation: input, outer: outer })
+		if err != nil {
+			return nil, nil, err
+		}
+		window.rel.columns = append(window.rel.columns, relationColumn{ name: outputName(node), typ: callType, hidden: true })
+
+		arguments, windowNode := windowParts(node)
+		call := windowCall{ node: node, name: strings.ToUpper(node.Data), arguments: arguments, frame: childOfType(windowNode, parser.FrameNode) }
+		call.aggregate, _ = lookupAggregate(call.name)
+
+		partition := childOfType(windowNode, parser.PartitionByNode)
+		order := childOfType(windowNode, parser.OrderByNode)
+		spec := -1
+		for i, existing := range window.specs {
+			if sameExpression(narytree.Node{ Children: existing.partition }, partition, input) && sameExpression(narytree.Node{ Children: existing.order }, order, input) {
+				spec = i
+			}
+		}
+		if spec == -1 {
+			window.specs = append(window.specs, windowSpec{ partition: partition.Children, order: order.Children })
+			spec = len(window.specs) - 1
+		}
+		window.specs[spec].calls = append(window.specs[spec].calls, len(window.calls))
+		window.calls = append(window.calls, call)
+	}
+
+	var rewritten []outputColumn
+	for _, output := range outputs {
+		expression := replaceWindowFunctions(output.expression, nodes, len(input.columns), input)
+		rewritten = append(rewritten, outputColumn{ name: output.name, expression: expression })
+	}
+	return window, rewritten, nil
+}
+
+// collectWindowFunctions adds the window functions in node to calls, leaving out ones that are already
+// there.
+func collectWindowFunctions(calls []narytree.Node, node narytree.Node, rel *relation) []narytree.Node {
+	if node.Type == parser.SubqueryNode {
+		return calls
+	}
+	if node.Type != parser.WindowFunctionNode {
+		for _, child := range node.Children {
+			calls = collectWindowFunctions(calls, child, rel)
+		}
+		return calls
+	}
+
+	for _, call := range calls {
+		if sameExpression(call, node, rel) {
+			return calls
+		}
+	}
+	return append(calls, node)
+}
+
+// replaceWindowFunctions replaces the window functions in node by slots. The value of calls[i] is in the
+// column at width + i.
+func replaceWindowFunctions(node narytree.Node, calls []narytree.Node, width int, rel *relation) narytree.Node {
+	if node.Type == parser.SubqueryNode {
+		return node
+	}
+	if node.Type == parser.WindowFunctionNode {
+		for i, call := range calls {
+			if sameExpression(call, node, rel) {
+				return slot(width + i)
+			}
+		}
+	}
+
+	replaced := node
+	replaced.Children = nil
+	for _, child := range node.Children {
+		replaced.AddChild(replaceWindowFunctions(child, calls, width, rel))
+	}
+	return replaced
+}
+
+// windowOperator computes window functions. It reads all of its input when it is opened and passes the
+// rows on in the same order, each with the values of the window functions added at the end.
+type windowOperator struct {
+	input    operator
+	calls    []windowCall
+	specs    []windowSpec
+	rel      *relation
+	rows     [][]any
+	position int
+}
+
+func (o *windowOperator) columns() *relation {
+	return o.rel
+}
+
+// windowRow is a row along with the values it is partitioned and sorted on.
+type windowRow struct {
+	row    []any
+	values []any
+}
+
+func (o *windowOperator) open(parent *scope) error {
+	rows, err := drain(o.input, parent)
+	if err != nil {
+		return err
+	}
+
+	o.rows = make([][]any, len(rows))
+	for i, row := range rows {
+		o.rows[i] = append(append([]any{}, row...), make([]any, len(o.calls))...)
+	}
+
+	for _, spec := range o.specs {
+		if err := o.computeSpec(spec, parent); err != nil {
+			return err
+		}
+	}
+	o.position = 0
+	return nil
+}
+
+func (o *windowOperator) next() ([]any, error) {
+	if o.position >= len(o.rows) {
+		return nil, nil
+	}
+	row := o.rows[o.position]
+	o.position++
+	return row, nil
+}
+
+// computeSpec sorts the rows by the partition and then by the order of spec, and computes the window
+// functions of spec one partition at a time.
+func (o *windowOperator) computeSpec(spec windowSpec, parent *scope) error {
+	var keys []sortKey
+	for i := range spec.partition {
+		keys = append(keys, sortKey{ column: i })
+	}
+	for _, item := range spec.order {
+		key := sortKey{ column: len(keys), descending: item.Data == "DESC" }
+		key.nullsFirst = key.descending
+		if nulls := childOfType(item, parser.NullsOrderNode); nulls.Type != "" {
+			key.nullsFirst = nulls.Data == "FIRST"
+		}
+		keys = append(keys, key)
+	}
+
+	var expressions []narytree.Node
+	expressions = append(expressions, spec.partition...)
+	for _, item := range spec.order {
+		expressions = append(expressions, item.Children[0])
+	}
+
+	sorted := make([]windowRow, len(o.rows))
+	for i, row := range o.rows {
+		s := parent.rowScope(o.input.columns(), row)
+		sorted[i] = windowRow{ row: row, values: make([]any, len(expressions)) }
+		for j, expression := range expressions {
+			value, err := evalExpression(expression, s)
+			if err != nil {
+				return err
+			}
+			sorted[i].values[j] = value
+		}
+	}
+
+	var sortErr error
+	sort.SliceStable(sorted, func(i, j int) bool {
+		order, err := compareRows(sorted[i].values, sorted[j].values, keys)
+		if err != nil && sortErr == nil {
+			sortErr = err
+		}
+		return order < 0
+	})
+	if sortErr != nil {
+		return sortErr
+	}
+
+	partitionKeys, orderKeys := keys[:len(spec.partition)], keys[len(spec.partition):]
+	for start := 0; start < len(sorted); {
+		end := start + 1
+		for end < len(sorted) {
+			order, err := compareRows(sorted[start].values, sorted[end].values, partitionKeys)
+			if err != nil {
+				return err
+			}
+			if order != 0 {
+				break
+			}
+			end++
+		}
+
+		partition, err := newWindowPartition(sorted[start:end], orderKeys)
+		if err != nil {
+			return err
+		}
+		for _, call := range spec.calls {
+			if err := o.computeCall(call, partition, parent); err != nil {
+				return err
+			}
+		}
+		start = end
+	}
+	return nil
+}
+
+// windowPartition is the rows of one partition in sorted order. lastPeer holds the position of the last
+// peer of each row.
+type windowPartition struct {
+	rows     []windowRow
+	lastPeer []int
+}
+
+func newWindowPartition(rows []windowRow, orderKeys []sortKey) (*windowPartition, error) {
+	partition := &windowPartition{ rows: rows, lastPeer: make([]int, len(rows)) }
+	for i := len(rows) - 1; i >= 0; i-- {
+		partition.lastPeer[i] = i
+		if i + 1 < len(rows) {
+			order, err := compareRows(rows[i].values, rows[i + 1].values, orderKeys)
+			if err != nil {
+				return nil, err
+			}
+			if order == 0 {
+				partition.lastPeer[i] = partition.lastPeer[i + 1]
+			}
+		}
+	}
+	return partition, nil
+}
+
+// computeCall computes the window function o.calls[index] for every row of a partition.
+func (o *windowOperator) computeCall(index int, partition *windowPartition, parent *scope) error {
+	call := o.calls[index]
+	column := len(o.input.columns().columns) + index
+	rowScope := func(i int) *scope {
+		return parent.rowScope(o.input.columns(), partition.rows[i].row)
+	}
+
+	switch call.name {
+		case "ROW_NUMBER":
+			for i, row := range partition.rows {
+				row.row[column] = int64(i + 1)
+			}
+			return nil
+
+		case "RANK", "DENSE_RANK":
+			var rank, denseRank int64
+			for i, row := range partition.rows {
+				// a row that isn't a peer of the one before it starts a new rank
+				if i == 0 || partition.lastPeer[i - 1] != partition.lastPeer[i] {
+					rank = int64(i + 1)
+					denseRank++
+				}
+				row.row[column] = rank
+				if call.name == "DENSE_RANK" {
+					row.row[column] = denseRank
+				}
+			}
+			return nil
+
+		case "LAG", "LEAD":
+			for i, row := range partition.rows {
+				value, err := o.evalOffsetValue(call, partition, i, rowScope)
+				if err != nil {
+					return err
+				}
+				row.row[column] = value
+			}
+			return nil
+	}
+
+	return o.computeAggregate(call, column, partition, parent, rowScope)
+}
+
+// evalOffsetValue computes LAG or LEAD for row i of a partition: the value of the first argument for the
+// row that many rows before or after it, or the default if there is no such row.
+func (o *windowOperator) evalOffsetValue(call windowCall, partition *windowPartition, i int, rowScope func(int) *scope) (any, error) {
+	offset := int64(1)
+	if len(call.arguments) > 1 {
+		value, err := evalExpression(call.arguments[1], rowScope(i))
+		if err != nil {
+			return nil, err
+		}
+		switch v := value.(type) {
+			case nil:
+				return nil, nil
+			case int64:
+				offset = v
+			case float64:
+				if v != float64(int64(v)) {
+					return nil, fmt.Errorf("%s offset must be a whole number, got %v", call.name, v)
+				}
+				offset = int64(v)
+			default:
+				return nil, fmt.Errorf("%s offset must be a number, got %s", call.name, typeName(value))
+		}
+	}
+	if call.name == "LAG" {
+		offset = -offset
+	}
+
+	if target := int64(i) + offset; target >= 0 && target < int64(len(partition.rows)) {
+		return evalExpression(call.arguments[0], rowScope(int(target)))
+	}
+	if len(call.arguments) > 2 {
+		return evalExpression(call.arguments[2], rowScope(i))
+	}
+	return nil, nil
+}
+
+// computeAggregate computes an aggregate called with OVER for every row of a partition, over the rows of
+// the row's frame. While the frames start at the start of the partition they only ever grow, so the rows
+// are added to a single accumulator as they come into the frame.
+func (o *windowOperator) computeAggregate(call windowCall, column int, partition *windowPartition, parent *scope, rowScope func(int) *scope) error {
+	values := make([]any, len(partition.rows))
+	for i := range partition.rows {
+		values[i] = true // COUNT(*) counts every row
+		if call.arguments[0].Type != parser.StarNode {
+			var err error
+			if values[i], err = evalExpression(call.arguments[0], rowScope(i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	frame, err := evalFrame(call.frame, parent)
+	if err != nil {
+		return err
+	}
+
+	add := func(acc accumulator, from int, to int) error {
+		for i := from; i <= to; i++ {
+			if values[i] == nil {
+				continue
+			}
+			if err := acc.add(values[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	running := call.aggregate.newAccumulator()
+	added := -1
+	for i, row := range partition.rows {
+		first, last := frame.bounds(i, partition)
+
+		if first == 0 {
+			if err := add(running, added + 1, last); err != nil {
+				return err
+			}
+			added = max(added, last)
+			row.row[column] = running.result()
+			continue
+		}
+
+		acc := call.aggregate.newAccumulator()
+		if err := add(acc, first, last); err != nil {
+			return err
+		}
+		row.row[column] = acc.result()
+	}
+	return nil
+}
+
+// windowFrame is a frame whose offsets have been computed. Without a frame clause rows is false and the
+// frame runs from the start of the partition to the last peer of the current row.
+type windowFrame struct {
+	rows        bool
+	start       string
+	end         string
+	startOffset int64
+	endOffset   int64
+}
+
+// evalFrame computes the offsets of a frame.
+// FrameNode -> FrameBoundNode start, FrameBoundNode end
+func evalFrame(frame narytree.Node, parent *scope) (windowFrame, error) {
+	if frame.Type == "" {
+		return windowFrame{}, nil
+	}
+
+	f := windowFrame{ rows: true, start: frame.Children[0].Data, end: frame.Children[1].Data }
+	offsets := []*int64{ &f.startOffset, &f.endOffset }
+	for i, bound := range frame.Children {
+		offset, ok, err := evalRowCount("frame offset", bound, parent)
+		if err != nil {
+			return windowFrame{}, err
+		}
+		if !ok && len(bound.Children) > 0 {
+			return windowFrame{}, fmt.Errorf("frame offset must not be NULL")
+		}
+		*offsets[i] = offset
+	}
+	return f, nil
+}
+
+// bounds returns the positions of the first and last row of the frame of row i of a partition. The frame
+// is empty when first comes after last. Neither first nor last ever goes down from one row to the next.
+func (f windowFrame) bounds(i int, partition *windowPartition) (int, int) {
+	if !f.rows {
+		return 0, partition.lastPeer[i]
+	}
+
+	position := func(bound string, offset int64) int64 {
+		switch bound {
+			case "UNBOUNDED PRECEDING":
+				return 0
+			case "PRECEDING":
+				return int64(i) - offset
+			case "FOLLOWING":
+				return int64(i) + offset
+			case "UNBOUNDED FOLLOWING":
+				return int64(len(partition.rows) - 1)
+		}
+		return int64(i) // CURRENT ROW
+	}
+
+	first := max(position(f.start, f.startOffset), 0)
+	last := min(position(f.end, f.endOffset), int64(len(partition.rows) - 1))
+	return int(first), int(last)
+}
@@ -0,0 +1,28 @@
+package engine
+
+import "testing"
+
+func TestWindowFunctions(t *testing.T) {
+	runQueryTests(t, []queryTest{
+		{ "SELECT id, ROW_NUMBER() OVER (ORDER BY amount DESC), RANK() OVER (PARTITION BY user_id ORDER BY amount) FROM orders ORDER BY id", "[[10 2 1] [11 1 2] [12 4 1] [13 3 1]]" },
+		{ "SELECT score, RANK() OVER (ORDER BY score), DENSE_RANK() OVER (ORDER BY score DESC NULLS LAST) FROM users ORDER BY id", "[[2.5 2 2] [-3 1 3] [<nil> 4 4] [10 3 1]]" },
+		{ "SELECT active, COUNT(*) OVER (ORDER BY active) FROM users ORDER BY id", "[[true 2] [false 1] [<nil> 4] [<nil> 4]]" },
+		{ "SELECT id, SUM(amount) OVER (PARTITION BY user_id ORDER BY id), SUM(amount) OVER () FROM orders ORDER BY id", "[[10 9.5 41.5] [11 29.5 41.5] [12 5 41.5] [13 7 41.5]]" },
+		{ "SELECT id, AVG(amount) OVER (ORDER BY id ROWS BETWEEN 1 PRECEDING AND 1 FOLLOWING) FROM orders ORDER BY id", "[[10 14.75] [11 11.5] [12 10.666666666666666] [13 6]]" },
+		{ "SELECT id, SUM(amount) OVER (ORDER BY id ROWS 1 PRECEDING), MIN(amount) OVER (ORDER BY id ROWS BETWEEN CURRENT ROW AND UNBOUNDED FOLLOWING) FROM orders ORDER BY id", "[[10 9.5 5] [11 29.5 5] [12 25 5] [13 12 7]]" },
+		{ "SELECT id, SUM(amount) OVER (ORDER BY id ROWS BETWEEN 1 FOLLOWING AND 3 FOLLOWING) FROM orders ORDER BY id", "[[10 32] [11 12] [12 7] [13 <nil>]]" },
+		{ "SELECT id, LAG(amount) OVER (ORDER BY id), LEAD(amount, 2, 0) OVER (ORDER BY id), LAG(item, 1, 'none') OVER (PARTITION BY user_id ORDER BY id) FROM orders ORDER BY id", "[[10 <nil> 5 none] [11 9.5 7 book] [12 20 0 none] [13 5 0 none]]" },
+		{ "SELECT user_id, SUM(amount), RANK() OVER (ORDER BY SUM(amount) DESC) FROM orders GROUP BY user_id ORDER BY user_id", "[[1 29.5 1] [2 5 3] [9 7 2]]" },
+		{ "SELECT id, ROW_NUMBER() OVER (ORDER BY id DESC) AS r FROM orders ORDER BY r LIMIT 2", "[[13 1] [12 2]]" },
+		{ "SELECT id FROM orders WHERE ROW_NUMBER() OVER () > 1", "error: window functions are not allowed in WHERE" },
+		{ "SELECT SUM(ROW_NUMBER() OVER ()) OVER () FROM orders", "error: window function calls cannot be nested" },
+		{ "SELECT UPPER(item) OVER () FROM orders", "error: OVER specified, but upper is not a window function nor an aggregate function" },
+		{ "SELECT SUM(DISTINCT amount) OVER () FROM orders", "error: DISTINCT is not implemented for window functions" },
+		{ "SELECT SUM(amount) OVER (ROWS BETWEEN UNBOUNDED FOLLOWING AND CURRENT ROW) FROM orders", "error: frame start cannot be UNBOUNDED FOLLOWING" },
+		{ "SELECT SUM(amount) OVER (ROWS BETWEEN CURRENT ROW AND 1 PRECEDING) FROM orders", "error: frame starting from current row cannot have preceding rows" },
+		{ "SELECT RANK(id) OVER () FROM orders", "error: function RANK takes 0 arguments but got 1" },
+		{ "SELECT RANK() FROM orders", "error: window function RANK requires an OVER clause" },
+		{ "SELECT id FROM orders ORDER BY row_number()", "error: window function ROW_NUMBER requires an OVER clause" },
+		{ "SELECT LAG(amount) + 1 FROM orders", "error: window function LAG requires an OVER clause" },
+	})
+}
@@ -0,0 +1,354 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jasutiin/deebeejeebees/internal/parser"
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// WITH names queries that the statement after it, and the queries listed after them, can read like
+// tables. Each query runs once, before the statement, and its rows are kept for every place that reads
+// them. The names are in scope for the whole statement, subqueries included, and hide tables of the same
+// name.
+//
+// With RECURSIVE a query of the form 'initial UNION [ALL] step' can read its own rows in step. initial
+// runs first; step is then run over and over, each time reading only the rows the run before it added,
+// until a run adds no rows. With UNION rows that are already in the result don't count as added, which
+// stops queries that would otherwise go around a cycle forever.
+
+// commonTable is a query named by WITH.
+type commonTable struct {
+	name string
+	rel  *relation
+	rows [][]any // the rows of the query once it has run, or the ones a recursive step reads
+}
+
+// commonTable looks up a query named by WITH in the scopes from scope outwards, returning nil if there
+// is none by that name.
+func (scope *analysisScope) commonTable(name string) *commonTable {
+	for current := scope; current != nil; current = current.outer {
+		if table, ok := current.commonTables[name]; ok {
+			return table
+		}
+	}
+	return nil
+}
+
+// analyzeWith checks the queries of a WITH clause in order and returns the scope they are in for the rest
+// of the statement.
+// WithNode -> CommonTableNode -> [ColumnListNode], SelectNode, ...
+func (db *Database) analyzeWith(with narytree.Node, outer *analysisScope) (*analysisScope, error) {
+	scope := &analysisScope{ outer: outer, commonTables: map[string]*commonTable{} }
+
+	for _, definition := range with.Children {
+		if _, ok := scope.commonTables[definition.Data]; ok {
+			return nil, fmt.Errorf("WITH query name '%s' specified more than once", definition.Data)
+		}
+		table := &commonTable{ name: definition.Data }
+		query := childOfType(definition, parser.SelectNode)
+
+		if with.Data != "RECURSIVE" || !readsTable(query, table.name) {
+			rel, err := db.analyzeSelect(query, scope)
+			if err != nil {
+				return nil, err
+			}
+			if table.rel, err = commonTableColumns(definition, rel); err != nil {
+				return nil, err
+			}
+			scope.commonTables[table.name] = table
+			continue
+		}
+
+		setOperation, err := recursiveUnion(definition)
+		if err != nil {
+			return nil, err
+		}
+		initial, err := db.analyzeOperand(setOperation.Children[0], scope)
+		if err != nil {
+			return nil, err
+		}
+		if table.rel, err = commonTableColumns(definition, initial); err != nil {
+			return nil, err
+		}
+
+		// the step reads the rows with the columns of the initial query
+		scope.commonTables[table.name] = table
+		step, err := db.analyzeOperand(setOperation.Children[1], scope)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := setOperationRelation(setOperation.Data, table.rel, step)
+		if err != nil {
+			return nil, err
+		}
+		for i, column := range rel.columns {
+			if column.typ != table.rel.columns[i].typ {
+				return nil, fmt.Errorf("recursive query '%s' column %d has type %s in non-recursive term but type %s overall", table.name, i + 1, table.rel.columns[i].typ, column.typ)
+			}
+		}
+	}
+
+	return scope, nil
+}
+
+// recursiveUnion checks that a query of WITH RECURSIVE that reads itself has the form 'initial UNION
+// [ALL] step', and returns the UNION.
+// CommonTableNode -> [ColumnListNode], SelectNode -> SetOperationNode
+func recursiveUnion(definition narytree.Node) (narytree.Node, error) {
+	query := childOfType(definition, parser.SelectNode)
+	setOperation := childOfType(query, parser.SetOperationNode)
+	if !strings.HasPrefix(setOperation.Data, "UNION") || childOfType(query, parser.WithNode).Type != "" {
+		return narytree.Node{}, fmt.Errorf("recursive query '%s' does not have the form non-recursive-term UNION [ALL] recursive-term", definition.Data)
+	}
+
+	clauses := []struct{ node, keyword string }{
+		{ parser.OrderByNode, "ORDER BY" },
+		{ parser.LimitNode, "LIMIT" },
+		{ parser.OffsetNode, "OFFSET" },
+	}
+	for _, clause := range clauses {
+		if childOfType(query, clause.node).Type != "" {
+			return narytree.Node{}, fmt.Errorf("%s in a recursive query is not implemented", clause.keyword)
+		}
+	}
+
+	if readsTable(setOperation.Children[0], definition.Data) {
+		return narytree.Node{}, fmt.Errorf("recursive reference to query '%s' must not appear within its non-recursive term", definition.Data)
+	}
+	return setOperation, nil
+}
+
+// readsTable reports whether a query reads a table of the given name anywhere, subqueries included.
+func readsTable(node narytree.Node, name string) bool {
+	if node.Type == parser.TableNameNode && node.Data == name {
+		return true
+	}
+	for _, child := range node.Children {
+		if readsTable(child, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// commonTableColumns names the columns of a query named by WITH. The names listed after the query's name,
+// if any, replace the names of its first columns.
+// CommonTableNode -> [ColumnListNode], SelectNode
+func commonTableColumns(definition narytree.Node, rel *relation) (*relation, error) {
+	names := childOfType(definition, parser.ColumnListNode).Children
+	if len(names) > len(rel.columns) {
+		return nil, fmt.Errorf("WITH query '%s' has %d columns available but %d columns specified", definition.Data, len(rel.columns), len(names))
+	}
+
+	columns := &relation{}
+	for i, column := range rel.columns {
+		if i < len(names) {
+			column.name = names[i].Data
+		}
+		columns.columns = append(columns.columns, relationColumn{ name: column.name, typ: column.typ })
+	}
+	return columns, nil
+}
+
+// planWith plans the queries of a WITH clause, and the query after it with the scope they are in.
+// SelectNode -> WithNode, ...
+func (db *Database) planWith(ast narytree.Node, outer *analysisScope) (operator, error) {
+	plan, scope, err := db.planCommonTables(childOfType(ast, parser.WithNode), outer)
+	if err != nil {
+		return nil, err
+	}
+
+	// the rest of the statement is planned like a query without WITH
+	rest := narytree.Node{ Type: ast.Type }
+	for _, clause := range ast.Children {
+		if clause.Type != parser.WithNode {
+			rest.AddChild(clause)
+		}
+	}
+
+	if plan.input, err = db.planSelect(rest, scope); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// planCommonTables plans the queries of a WITH clause. It returns the operator that runs them, whose input
+// is left for the caller to set, and the scope they are in for the rest of the statement.
+// WithNode -> CommonTableNode -> [ColumnListNode], SelectNode, ...
+func (db *Database) planCommonTables(with narytree.Node, outer *analysisScope) (*withOperator, *analysisScope, error) {
+	scope := &analysisScope{ outer: outer, commonTables: map[string]*commonTable{} }
+	plan := &withOperator{ commonTables: scope.commonTables }
+
+	for _, definition := range with.Children {
+		table := &commonTable{ name: definition.Data }
+		query := childOfType(definition, parser.SelectNode)
+
+		var input operator
+		if with.Data != "RECURSIVE" || !readsTable(query, table.name) {
+			var err error
+			if input, err = db.planSelect(query, scope); err != nil {
+				return nil, nil, err
+			}
+			if table.rel, err = commonTableColumns(definition, input.columns()); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			setOperation := childOfType(query, parser.SetOperationNode)
+			initial, err := db.planOperand(setOperation.Children[0], scope)
+			if err != nil {
+				return nil, nil, err
+			}
+			if table.rel, err = commonTableColumns(definition, initial.columns()); err != nil {
+				return nil, nil, err
+			}
+
+			scope.commonTables[table.name] = table
+			step, err := db.planOperand(setOperation.Children[1], scope)
+			if err != nil {
+				return nil, nil, err
+			}
+			input = &recursiveScan{ initial: initial, step: step, table: table, all: setOperation.Data == "UNION ALL" }
+		}
+
+		scope.commonTables[table.name] = table
+		plan.tables = append(plan.tables, table)
+		plan.inputs = append(plan.inputs, input)
+	}
+
+	return plan, scope, nil
+}
+
+// withOperator runs the queries of a WITH clause when it is opened, keeping their rows, and then passes on
+// the rows of the query after it.
+type withOperator struct {
+	tables       []*commonTable
+	inputs       []operator
+	commonTables map[string]*commonTable
+	input        operator
+}
+
+func (o *withOperator) columns() *relation {
+	return o.input.columns()
+}
+
+func (o *withOperator) open(parent *scope) error {
+	s, err := o.run(parent)
+	if err != nil {
+		return err
+	}
+	return o.input.open(s)
+}
+
+// run runs the queries of the WITH clause and returns the scope the rest of the statement runs in.
+func (o *withOperator) run(parent *scope) (*scope, error) {
+	s := &scope{ exec: parent.exec, outer: parent, commonTables: o.commonTables }
+
+	for i, table := range o.tables {
+		rows, err := drain(o.inputs[i], s)
+		if err != nil {
+			return nil, err
+		}
+		table.rows = rows
+	}
+	return s, nil
+}
+
+func (o *withOperator) next() ([]any, error) {
+	return o.input.next()
+}
+
+// commonTableScan reads the rows of a query named by WITH.
+type commonTableScan struct {
+	table    *commonTable
+	rel      *relation
+	rows     [][]any
+	position int
+}
+
+func (o *commonTableScan) columns() *relation {
+	return o.rel
+}
+
+func (o *commonTableScan) open(parent *scope) error {
+	o.rows = o.table.rows
+	o.position = 0
+	return nil
+}
+
+func (o *commonTableScan) next() ([]any, error) {
+	if o.position >= len(o.rows) {
+		return nil, nil
+	}
+	row := o.rows[o.position]
+	o.position++
+	return row, nil
+}
+
+// maxRecursiveRows is how many rows a recursive query may produce. Nothing stops a recursive step from
+// adding rows forever, and failing is better than running until memory runs out.
+const maxRecursiveRows = 100000
+
+// recursiveScan runs a query of WITH RECURSIVE. Every run of step reads the rows added by the run before
+// it through table, starting with the rows of initial.
+type recursiveScan struct {
+	initial  operator
+	step     operator
+	table    *commonTable
+	all      bool
+	rows     [][]any
+	position int
+}
+
+func (o *recursiveScan) columns() *relation {
+	return o.table.rel
+}
+
+func (o *recursiveScan) open(parent *scope) error {
+	seen := map[string]bool{}
+	o.rows = nil
+	o.position = 0
+
+	// add keeps the rows that count as new and returns them
+	add := func(rows [][]any) [][]any {
+		var added [][]any
+		for _, row := range rows {
+			if !o.all {
+				key := rowKey(row)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			}
+			added = append(added, row)
+		}
+		o.rows = append(o.rows, added...)
+		return added
+	}
+
+	rows, err := drain(o.initial, parent)
+	if err != nil {
+		return err
+	}
+
+	for working := add(rows); len(working) > 0; working = add(rows) {
+		if len(o.rows) > maxRecursiveRows {
+			return fmt.Errorf("recursive query '%s' produced more than %d rows", o.table.name, maxRecursiveRows)
+		}
+		o.table.rows = working
+		if rows, err = drain(o.step, parent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *recursiveScan) next() ([]any, error) {
+	if o.position >= len(o.rows) {
+		return nil, nil
+	}
+	row := o.rows[o.position]
+	o.position++
+	return row, nil
+}
@@ -0,0 +1,19 @@
+package engine
+
+import "testing"
+
+func TestCommonTableExpressions(t *testing.T) {
+	runQueryTests(t, []queryTest{
+		{ "WITH big AS (SELECT * FROM orders WHERE amount > 8) SELECT item FROM big", "[[book] [lamp]]" },
+		{ "WITH t (a, b) AS (SELECT id, name FROM users) SELECT b FROM t WHERE a = 2", "[[alice]]" },
+		{ "WITH a AS (SELECT id FROM users), b AS (SELECT id FROM a WHERE id > 2) SELECT * FROM b", "[[3] [4]]" },
+		{ "WITH RECURSIVE n (i) AS (SELECT 1 FROM users WHERE id = 1 UNION ALL SELECT i + 1 FROM n WHERE i < 5) SELECT * FROM n", "[[1] [2] [3] [4] [5]]" },
+		{ "WITH RECURSIVE n (i) AS (SELECT 1 FROM users WHERE id = 1 UNION SELECT 3 - i FROM n) SELECT * FROM n", "[[1] [2]]" },
+		{ "WITH RECURSIVE r (n) AS (SELECT 1 FROM users WHERE id = 1 UNION ALL SELECT n + 1 FROM r) SELECT n FROM r LIMIT 5", "error: recursive query 'r' produced more than 100000 rows" },
+		{ "WITH users AS (SELECT 99 AS id FROM orders WHERE id = 10) SELECT id FROM users", "[[99]]" },
+		{ "WITH a AS (SELECT 1 FROM users), a AS (SELECT 2 FROM users) SELECT * FROM a", "error: WITH query name 'a' specified more than once" },
+		{ "WITH t (a, b) AS (SELECT id FROM users) SELECT * FROM t", "error: WITH query 't' has 1 columns available but 2 columns specified" },
+		{ "WITH RECURSIVE n (i) AS (SELECT i FROM n UNION SELECT 1 FROM users) SELECT * FROM n", "error: recursive reference to query 'n' must not appear within its non-recursive term" },
+		{ "WITH RECURSIVE n (i) AS (SELECT 1 FROM users UNION SELECT 'x' FROM n) SELECT * FROM n", "error: UNION types INT and TEXT cannot be matched" },
+	})
+}
@@ -1,36 +1,143 @@
 package lexer
 
 import (
-	"strings"
-	"unicode"
+    "fmt"
+    "strconv"
+    "strings"
+    "unicode"
+    "unicode/utf8"
 
-	"github.com/jasutiin/deebeejeebees/internal/tokens"
+    "github.com/jasutiin/deebeejeebees/internal/tokens"
 )
 
-// AnalyzeString tokenizes the input SQL string and returns the list of tokens.
-func AnalyzeString(input string) []string {
-    var parsedTokens []string
+// LexicalError is returned when the input can't be split into tokens, for example when a string literal or
+// a block comment is never closed.
+type LexicalError struct {
+    Message    string
+    Offset     int // byte offset of where the problem starts
+    CharOffset int // the same offset counted in characters
+    Line       int
+    Column     int
+}
+
+func (e *LexicalError) Error() string {
+    return fmt.Sprintf("%s at line %d, column %d", e.Message, e.Line, e.Column)
+}
+
+// AnalyzeString tokenizes the input SQL string and returns the list of tokens. Comments are skipped. The
+// input is read as UTF-8 and the text of literals and identifiers is kept exactly as written.
+func AnalyzeString(input string) ([]tokens.Token, error) {
+    var parsedTokens []tokens.Token
+    lines := &positions{ input: input, line: 1 }
+    positionalParameters := 0
 
     i := 0
     for i < len(input) {
-        character := rune(input[i])
+        character, size := utf8.DecodeRuneInString(input[i:])
+
+        if character == utf8.RuneError && size == 1 {
+            return nil, lines.error("invalid UTF-8 encoding", i)
+        }
 
         if unicode.IsSpace(character) {
-            i++
+            i += size
+            continue
+        }
+
+        // '-- comment' runs until the end of the line
+        if strings.HasPrefix(input[i:], "--") {
+            for i < len(input) && input[i] != '\n' {
+                i++
+            }
+            continue
+        }
+
+        if strings.HasPrefix(input[i:], "/*") {
+            end := strings.Index(input[i + 2:], "*/")
+            if end == -1 {
+                return nil, lines.error("unterminated block comment", i)
+            }
+            i += 2 + end + 2
+            continue
+        }
+
+        // E'...' strings understand backslash escapes like '\n'
+        isEscapeString := (character == 'E' || character == 'e') && i + 1 < len(input) && input[i + 1] == '\''
+
+        if character == '\'' || isEscapeString {
+            quote := i
+            if isEscapeString {
+                quote++
+            }
+
+            str, newIndex, err := analyzeStringLiteralToken(input, quote, isEscapeString)
+            if err != nil {
+                return nil, lines.error(err.Error(), i)
+            }
+
+            parsedTokens = append(parsedTokens, lines.token(tokens.STRING, input[i:newIndex + 1], str, i))
+            i = newIndex + 1
             continue
         }
 
-        if character == '\'' {
-            str, newIndex := analyzeStringLiteralToken(input, i)
-            parsedTokens = append(parsedTokens, str)
+        // "name" and `name` are quoted identifiers. they can be keywords and are never case folded
+        if character == '"' || character == '`' {
+            name, newIndex, err := analyzeQuotedIdentifierToken(input, i)
+            if err != nil {
+                return nil, lines.error(err.Error(), i)
+            }
+
+            token := lines.token(tokens.IDENTIFIER, input[i:newIndex + 1], name, i)
+            token.Quoted = true
+            parsedTokens = append(parsedTokens, token)
             i = newIndex + 1
             continue
         }
 
+        // bind parameters: ?, $1 and :name
+        if character == '?' || character == '$' || character == ':' {
+            value, newIndex, err := analyzeParameterToken(input, i, &positionalParameters)
+            if err != nil {
+                return nil, lines.error(err.Error(), i)
+            }
+
+            parsedTokens = append(parsedTokens, lines.token(tokens.PARAMETER, input[i:newIndex], value, i))
+            i = newIndex
+            continue
+        }
+
+        // numbers are checked before symbols so that '.5' is read as a number and not as a '.'
+        if isDigit(input[i]) || (character == '.' && i + 1 < len(input) && isDigit(input[i + 1])) {
+            newIndex := analyzeNumberToken(input, i)
+
+            // a letter straight after a number, like 123abc or 1e, isn't a number followed by an identifier
+            if next, _ := utf8.DecodeRuneInString(input[newIndex:]); isIdentifierCharacter(next) {
+                end := newIndex
+                for end < len(input) {
+                    next, nextSize := utf8.DecodeRuneInString(input[end:])
+                    if !isIdentifierCharacter(next) {
+                        break
+                    }
+                    end += nextSize
+                }
+                return nil, lines.error(fmt.Sprintf("invalid number '%s'", input[i:end]), i)
+            }
+
+            token := lines.token(tokens.NUMBER, input[i:newIndex], input[i:newIndex], i)
+            number, err := tokens.ParseNumber(token.Text)
+            if err != nil {
+                return nil, lines.error(fmt.Sprintf("invalid number '%s'", token.Text), i)
+            }
+            token.Number = number
+            parsedTokens = append(parsedTokens, token)
+            i = newIndex
+            continue
+        }
+
         symbol, newIndex, ok := tryAnalyzeSymbol(input, i);
 
         if ok {
-            parsedTokens = append(parsedTokens, symbol)
+            parsedTokens = append(parsedTokens, lines.token(tokens.Kind(tokens.ReservedSymbols[symbol]), symbol, symbol, i))
             i = newIndex + 1
             continue
         }
@@ -38,41 +145,121 @@ func AnalyzeString(input string) []string {
         if unicode.IsLetter(character) || character == '_' {
             start := i
 
-            // read the entire word
-            for i < len(input) && (unicode.IsLetter(rune(input[i])) || unicode.IsDigit(rune(input[i])) || rune(input[i]) == '_') {
-                i++
+            // read the entire word, one character at a time since letters like 'é' or '名' take up several bytes
+            for i < len(input) {
+                next, nextSize := utf8.DecodeRuneInString(input[i:])
+                if !isIdentifierCharacter(next) {
+                    break
+                }
+                i += nextSize
             }
 
             word := strings.ToUpper(input[start:i]) // all of the reserved keywords are uppercase
 
-            // if it's a reserved keyword, add it. if not, then take its original form and add it
+            // if it's a reserved keyword, keep the uppercase form. if not, then it's an identifier and gets case folded
             if tokens.ReservedKeywords[word] {
-                parsedTokens = append(parsedTokens, word)
+                parsedTokens = append(parsedTokens, lines.token(tokens.KEYWORD, input[start:i], word, start))
             } else {
-                parsedTokens = append(parsedTokens, input[start:i])
+                parsedTokens = append(parsedTokens, lines.token(tokens.IDENTIFIER, input[start:i], tokens.FoldIdentifier(input[start:i]), start))
             }
 
             continue
         }
 
-        // checks for numbers. the reason why this is separate from the logic above is because it takes into 
-        // account identifiers that start with numbers: '1age', which is not allowed in SQL.
-        // identifiers must start with a letter.
-        if unicode.IsDigit(character) {
-            start := i
+        return nil, lines.error(fmt.Sprintf("unexpected character '%c'", character), i)
+    }
 
-            for i < len(input) && unicode.IsDigit(rune(input[i])) {
+    return parsedTokens, nil
+}
+
+// analyzeParameterToken reads the bind parameter starting at index and returns its normalized name and the
+// index just past its end. Positional '?' parameters are numbered from left to right so that they look the
+// same as '$1' style ones, and the names of ':name' parameters are case folded like identifiers.
+func analyzeParameterToken(input string, index int, positionalParameters *int) (string, int, error) {
+    switch input[index] {
+        case '?':
+            *positionalParameters += 1
+            return fmt.Sprintf("$%d", *positionalParameters), index + 1, nil
+        case '$':
+            i := index + 1
+            for i < len(input) && isDigit(input[i]) {
                 i++
             }
+            if i == index + 1 || input[index + 1] == '0' {
+                return "", index, fmt.Errorf("invalid parameter, expected a number starting at 1 after '$'")
+            }
+            return input[index:i], i, nil
+        default:
+            i := index + 1
+            for i < len(input) {
+                next, nextSize := utf8.DecodeRuneInString(input[i:])
+                if !isIdentifierCharacter(next) {
+                    break
+                }
+                i += nextSize
+            }
+            if i == index + 1 {
+                return "", index, fmt.Errorf("invalid parameter, expected a name after ':'")
+            }
+            return ":" + tokens.FoldIdentifier(input[index + 1:i]), i, nil
+    }
+}
 
-            parsedTokens = append(parsedTokens, input[start:i])
-            continue
+// analyzeNumberToken takes in the input string and the index of the first character of a number and returns
+// the index just past its end. Numbers can be integers (42), decimals (3.14, .5, 1.), use scientific
+// notation (1e10, 2.5E-3) or be hexadecimal integers (0x1F). Signs are not part of the number since '-' is
+// also subtraction; the parser handles negative numbers.
+func analyzeNumberToken(input string, index int) int {
+    i := index
+
+    if input[i] == '0' && i + 2 < len(input) && (input[i + 1] == 'x' || input[i + 1] == 'X') && isHexDigit(input[i + 2]) {
+        i += 2
+        for i < len(input) && isHexDigit(input[i]) {
+            i++
         }
+        return i
+    }
 
+    for i < len(input) && isDigit(input[i]) {
         i++
     }
 
-    return parsedTokens
+    if i < len(input) && input[i] == '.' {
+        i++
+        for i < len(input) && isDigit(input[i]) {
+            i++
+        }
+    }
+
+    // only treat an 'e' as an exponent when digits follow it; the caller rejects a dangling one like '1e'
+    if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+        j := i + 1
+        if j < len(input) && (input[j] == '+' || input[j] == '-') {
+            j++
+        }
+        if j < len(input) && isDigit(input[j]) {
+            i = j
+            for i < len(input) && isDigit(input[i]) {
+                i++
+            }
+        }
+    }
+
+    return i
+}
+
+// isIdentifierCharacter reports whether the character can appear after the first letter of an identifier.
+// Combining marks are allowed so that decomposed letters like 'e' + '\u0301' stay in one word.
+func isIdentifierCharacter(ch rune) bool {
+    return unicode.IsLetter(ch) || unicode.IsDigit(ch) || unicode.IsMark(ch) || ch == '_'
+}
+
+func isDigit(ch byte) bool {
+    return ch >= '0' && ch <= '9'
+}
+
+func isHexDigit(ch byte) bool {
+    return isDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
 }
 
 // tryAnalyzeSymbol takes in the input string and the index we were on to check if the symbol is a reserved symbol.
@@ -92,20 +279,154 @@ func tryAnalyzeSymbol(input string, index int) (string, int, bool) {
     return "", index, false
 }
 
-// analyzeStringLiteralToken takes in the input string and the index we were on to check for the entire sentence
-// inside the string literals.
-func analyzeStringLiteralToken(input string, index int) (string, int) {
+// analyzeStringLiteralToken takes in the input string and the index of the opening quote to check for the
+// entire sentence inside the string literals. It returns the contents without the surrounding quotes and the
+// index of the closing quote. Two quotes in a row ('O''Brien') stand for a single quote, and if escapes is set
+// backslash escapes are decoded as well.
+func analyzeStringLiteralToken(input string, index int, escapes bool) (string, int, error) {
     var sb strings.Builder
-    sb.WriteRune('\'')
     i := index + 1
     for i < len(input) {
-        ch := rune(input[i])
-        sb.WriteRune(ch)
+        ch := input[i]
+
         if ch == '\'' {
-            return sb.String(), i
+            if i + 1 < len(input) && input[i + 1] == '\'' {
+                sb.WriteRune('\'')
+                i += 2
+                continue
+            }
+            return sb.String(), i, nil
         }
+
+        if ch == '\\' && escapes {
+            decoded, newIndex, err := analyzeEscapeSequence(input, i)
+            if err != nil {
+                return "", i, err
+            }
+            sb.WriteString(decoded)
+            i = newIndex
+            continue
+        }
+
+        // quotes and backslashes are never part of a multi-byte UTF-8 character, so copying byte by byte
+        // keeps the literal exactly as it was written
+        sb.WriteByte(ch)
         i++
     }
 
-    return sb.String(), i - 1
-}
\ No newline at end of file
+    return "", i, fmt.Errorf("unterminated string literal")
+}
+
+// analyzeQuotedIdentifierToken reads a "quoted" or `quoted` identifier starting at index and returns the name
+// and the index of the closing quote. The quote character can be written twice to include it in the name.
+func analyzeQuotedIdentifierToken(input string, index int) (string, int, error) {
+    quote := input[index]
+    var sb strings.Builder
+    i := index + 1
+    for i < len(input) {
+        if input[i] == quote {
+            if i + 1 < len(input) && input[i + 1] == quote {
+                sb.WriteByte(quote)
+                i += 2
+                continue
+            }
+            if sb.Len() == 0 {
+                return "", i, fmt.Errorf("zero-length quoted identifier")
+            }
+            return sb.String(), i, nil
+        }
+        sb.WriteByte(input[i])
+        i++
+    }
+
+    return "", i, fmt.Errorf("unterminated quoted identifier")
+}
+
+// analyzeEscapeSequence decodes the backslash escape starting at index and returns the decoded text and the
+// index just past the escape. Unknown escapes like '\q' stand for the character itself.
+func analyzeEscapeSequence(input string, index int) (string, int, error) {
+    if index + 1 >= len(input) {
+        return "", index, fmt.Errorf("unterminated string literal")
+    }
+
+    switch ch := input[index + 1]; ch {
+        case 'n':
+            return "\n", index + 2, nil
+        case 't':
+            return "\t", index + 2, nil
+        case 'r':
+            return "\r", index + 2, nil
+        case 'b':
+            return "\b", index + 2, nil
+        case 'f':
+            return "\f", index + 2, nil
+        case '0':
+            return "\x00", index + 2, nil
+        case 'x', 'u':
+            size := 2
+            if ch == 'u' {
+                size = 4
+            }
+            end := index + 2 + size
+            if end > len(input) {
+                return "", index, fmt.Errorf("invalid escape sequence '%s'", input[index:])
+            }
+            code, err := strconv.ParseUint(input[index + 2:end], 16, 32)
+            if err != nil {
+                return "", index, fmt.Errorf("invalid escape sequence '%s'", input[index:end])
+            }
+            // both name a code point, so '\xff' is 'ÿ' and not a lone byte that isn't valid UTF-8
+            return string(rune(code)), end, nil
+        default:
+            escaped, size := utf8.DecodeRuneInString(input[index + 1:])
+            return string(escaped), index + 1 + size, nil
+    }
+}
+
+// positions turns byte offsets into line and column numbers and character offsets. Tokens are created from
+// left to right, so it only has to count the characters since the last offset it was asked about.
+type positions struct {
+    input         string
+    byteOffset    int
+    charOffset    int
+    line          int
+    lineStartChar int // character offset of the first character on the current line
+}
+
+// advance moves the cursor up to the given byte offset.
+func (p *positions) advance(offset int) {
+    if offset < p.byteOffset {
+        *p = positions{ input: p.input, line: 1 }
+    }
+
+    for p.byteOffset < offset {
+        ch, size := utf8.DecodeRuneInString(p.input[p.byteOffset:])
+        p.byteOffset += size
+        p.charOffset++
+        if ch == '\n' {
+            p.line++
+            p.lineStartChar = p.charOffset
+        }
+    }
+}
+
+// token builds a token that starts at the given byte offset.
+func (p *positions) token(kind tokens.Kind, text string, value string, offset int) tokens.Token {
+    p.advance(offset)
+
+    return tokens.Token{
+        Kind:       kind,
+        Text:       text,
+        Value:      value,
+        Offset:     offset,
+        CharOffset: p.charOffset,
+        Line:       p.line,
+        Column:     p.charOffset - p.lineStartChar + 1,
+    }
+}
+
+// error builds a LexicalError that points at the given byte offset.
+func (p *positions) error(message string, offset int) *LexicalError {
+    token := p.token("", "", "", offset)
+    return &LexicalError{ Message: message, Offset: offset, CharOffset: token.CharOffset, Line: token.Line, Column: token.Column }
+}
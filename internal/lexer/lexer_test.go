@@ -0,0 +1,144 @@
+package lexer
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "testing"
+
+    "github.com/jasutiin/deebeejeebees/internal/tokens"
+)
+
+// describe renders tokens as "KIND:value" separated by spaces, which keeps the expected output of the
+// tests short.
+func describe(list []tokens.Token) string {
+    parts := make([]string, len(list))
+    for i, token := range list {
+        parts[i] = fmt.Sprintf("%s:%s", token.Kind, token.Value)
+    }
+    return strings.Join(parts, " ")
+}
+
+func TestAnalyzeString(t *testing.T) {
+    tests := []struct {
+        name  string
+        input string
+        want  string
+    }{
+        { "keywords and identifiers", "select a, SELECT_x from Users", "KEYWORD:SELECT IDENTIFIER:a COMMA:, IDENTIFIER:select_x KEYWORD:FROM IDENTIFIER:users" },
+        { "symbols", "a <> b != c <= d", "IDENTIFIER:a NEQ:<> IDENTIFIER:b NEQ:!= IDENTIFIER:c LTE:<= IDENTIFIER:d" },
+        { "integers and decimals", "1 3.14 .5 1.", "NUMBER:1 NUMBER:3.14 NUMBER:.5 NUMBER:1." },
+        { "exponents and hex", "1e10 2.5E-3 0x1F", "NUMBER:1e10 NUMBER:2.5E-3 NUMBER:0x1F" },
+        { "minus is a separate token", "-5", "MINUS:- NUMBER:5" },
+        { "string literal", "'hello world'", "STRING:hello world" },
+        { "doubled quote", "'O''Brien'", "STRING:O'Brien" },
+        { "escape string", `E'a\nb\tc\\'`, "STRING:a\nb\tc\\" },
+        { "unicode escape", `E'caf\u00e9'`, "STRING:café" },
+        { "hex escape", `E'\x41\xe9\xff'`, "STRING:Aéÿ" },
+        { "line comment", "SELECT -- a comment\n a", "KEYWORD:SELECT IDENTIFIER:a" },
+        { "block comment", "SELECT /* a\n comment */ a", "KEYWORD:SELECT IDENTIFIER:a" },
+        { "double quoted identifier", `"order" "Mixed"`, "IDENTIFIER:order IDENTIFIER:Mixed" },
+        { "backtick identifier", "`date`", "IDENTIFIER:date" },
+        { "doubled quote in identifier", `"a""b"`, `IDENTIFIER:a"b` },
+        { "positional parameters", "? ? $5", "PARAMETER:$1 PARAMETER:$2 PARAMETER:$5" },
+        { "named parameter", ":UserID", "PARAMETER::userid" },
+        { "unicode identifier and string", "名前 = 'café'", "IDENTIFIER:名前 EQ:= STRING:café" },
+        { "empty input", "   ", "" },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            got, err := AnalyzeString(test.input)
+            if err != nil {
+                t.Fatalf("AnalyzeString(%q) failed: %v", test.input, err)
+            }
+            if describe(got) != test.want {
+                t.Errorf("AnalyzeString(%q) =\n  %s\nwant\n  %s", test.input, describe(got), test.want)
+            }
+        })
+    }
+}
+
+func TestAnalyzeStringParsesNumbers(t *testing.T) {
+    got, err := AnalyzeString("42 3.5 1e3 0x1F 9223372036854775808")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    want := []any{ int64(42), 3.5, 1000.0, int64(31), 9223372036854775808.0 }
+    for i, number := range want {
+        if got[i].Number != number {
+            t.Errorf("token %v: got number %#v, want %#v", got[i], got[i].Number, number)
+        }
+    }
+}
+
+func TestAnalyzeStringKeepsQuotedNames(t *testing.T) {
+    got, err := AnalyzeString(`"Users" users`)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !got[0].Quoted || got[1].Quoted {
+        t.Errorf("only the first identifier should be quoted: %v", got)
+    }
+    if got[0].Value == got[1].Value {
+        t.Errorf("a quoted name should not be case folded: %v", got)
+    }
+}
+
+func TestAnalyzeStringPositions(t *testing.T) {
+    got, err := AnalyzeString("SELECT 'é',\n  名前")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        offset, charOffset, line, column int
+    }{
+        { 0, 0, 1, 1 },
+        { 7, 7, 1, 8 },
+        { 11, 10, 1, 11 },
+        { 15, 14, 2, 3 },
+    }
+    for i, want := range tests {
+        token := got[i]
+        if token.Offset != want.offset || token.CharOffset != want.charOffset || token.Line != want.line || token.Column != want.column {
+            t.Errorf("token %d %v: got offset %d, char offset %d, line %d, column %d, want %d, %d, %d, %d", i, token,
+                token.Offset, token.CharOffset, token.Line, token.Column, want.offset, want.charOffset, want.line, want.column)
+        }
+    }
+}
+
+func TestAnalyzeStringErrors(t *testing.T) {
+    tests := []struct {
+        input string
+        want  string
+    }{
+        { "SELECT 'abc", "unterminated string literal at line 1, column 8" },
+        { "SELECT /* abc", "unterminated block comment at line 1, column 8" },
+        { `SELECT "abc`, "unterminated quoted identifier at line 1, column 8" },
+        { `SELECT ""`, "zero-length quoted identifier at line 1, column 8" },
+        { "SELECT $0", "invalid parameter, expected a number starting at 1 after '$' at line 1, column 8" },
+        { "SELECT :", "invalid parameter, expected a name after ':' at line 1, column 8" },
+        { "SELECT #", "unexpected character '#' at line 1, column 8" },
+        { "SELECT 0xFFFFFFFFFFFFFFFFF", "invalid number '0xFFFFFFFFFFFFFFFFF' at line 1, column 8" },
+        { "SELECT 123abc", "invalid number '123abc' at line 1, column 8" },
+        { "SELECT 1e", "invalid number '1e' at line 1, column 8" },
+        { "SELECT 1.5_0", "invalid number '1.5_0' at line 1, column 8" },
+        { "SELECT 0xZZ", "invalid number '0xZZ' at line 1, column 8" },
+        { "SELECT \xff", "invalid UTF-8 encoding at line 1, column 8" },
+        { "\n  @", "unexpected character '@' at line 2, column 3" },
+    }
+
+    for _, test := range tests {
+        _, err := AnalyzeString(test.input)
+        var lexicalError *LexicalError
+        if !errors.As(err, &lexicalError) {
+            t.Errorf("AnalyzeString(%q) should fail with a *LexicalError, got %v", test.input, err)
+            continue
+        }
+        if err.Error() != test.want {
+            t.Errorf("AnalyzeString(%q) error = %q, want %q", test.input, err.Error(), test.want)
+        }
+    }
+}
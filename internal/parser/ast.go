@@ -1,7 +1,11 @@
 package parser
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+	"github.com/jasutiin/deebeejeebees/internal/tokens"
 )
 
 const (
@@ -20,20 +24,77 @@ const (
 	SelectNode          = "SelectNode"
 	CreateTableNode     = "CreateTableNode"
 	InsertNode          = "InsertNode"
+	UpdateNode          = "UpdateNode"
+	StringLiteralNode   = "StringLiteralNode"
+	NumberLiteralNode   = "NumberLiteralNode"
+	ParameterNode       = "ParameterNode"
+	NullLiteralNode     = "NullLiteralNode"
+	BooleanLiteralNode  = "BooleanLiteralNode"
+	UnaryOperationNode  = "UnaryOperationNode"
+	WhereNode           = "WhereNode"
+	InListNode          = "InListNode"
+	BetweenNode         = "BetweenNode"
+	LikeNode            = "LikeNode"
+	IsNullNode          = "IsNullNode"
+	CaseNode            = "CaseNode"
+	WhenNode            = "WhenNode"
+	ElseNode            = "ElseNode"
+	FunctionCallNode    = "FunctionCallNode"
+	QualifiedNameNode   = "QualifiedNameNode"
+	AliasNode           = "AliasNode"
+	StarNode            = "StarNode"
+	FromNode            = "FromNode"
+	JoinNode            = "JoinNode"
+	OnNode              = "OnNode"
+	UsingNode           = "UsingNode"
+	GroupByNode         = "GroupByNode"
+	HavingNode          = "HavingNode"
+	DistinctNode        = "DistinctNode"
+	OrderByNode         = "OrderByNode"
+	OrderItemNode       = "OrderItemNode"
+	NullsOrderNode      = "NullsOrderNode"
+	LimitNode           = "LimitNode"
+	OffsetNode          = "OffsetNode"
+	SubqueryNode        = "SubqueryNode"
+	ExistsNode          = "ExistsNode"
+	InSubqueryNode      = "InSubqueryNode"
+	QuantifiedNode      = "QuantifiedNode"
+	SetOperationNode    = "SetOperationNode"
+	WithNode            = "WithNode"
+	CommonTableNode     = "CommonTableNode"
+	WindowFunctionNode  = "WindowFunctionNode"
+	WindowNode          = "WindowNode"
+	PartitionByNode     = "PartitionByNode"
+	FrameNode           = "FrameNode"
+	FrameBoundNode      = "FrameBoundNode"
+	DefaultNode         = "DefaultNode"
+	SetListNode         = "SetListNode"
+	AssignmentNode      = "AssignmentNode"
 )
 
 var transformationRules = map[string]string{
 	"<column_list>":           ColumnListNode,
+	"<select_list>":           ColumnListNode,
+	"<from_list>":             FromNode,
 	"<table_name>":            TableNameNode,
-	"<optional_where>":        BinaryOperationNode,
+	"<set_operation>":         SetOperationNode,
+	"<optional_with>":         WithNode,
+	"<optional_distinct>":     DistinctNode,
+	"<optional_where>":        WhereNode,
+	"<optional_group_by>":     GroupByNode,
+	"<optional_having>":       HavingNode,
+	"<optional_order_by>":     OrderByNode,
+	"<optional_limit>":        LimitNode,
+	"<optional_offset>":       OffsetNode,
 	"<value_list>":            ValuesListNode,
+	"<set_list>":              SetListNode,
 	"<column_defs_list>":      ColumnListNode,
 	"<column_def>":            ColumnDefNode,
 	"<data_type>":             DataTypeNode,
+	"<select_statement>":      SelectNode,
 
 	"<column_name>":           "DEL",
 	"<column_list_tail>":      "DEL",
-	"<condition>":             "DEL",
 	"<value>":                 "DEL",
 	"<value_list_tail>":       "DEL",
 	"<column_defs_list_tail>": "DEL",
@@ -42,6 +103,8 @@ var transformationRules = map[string]string{
 	"FROM":   "DEL",
 	"WHERE":  "DEL",
 	"INSERT": "DEL",
+	"UPDATE": "DEL",
+	"SET":    "DEL",
 	"INTO":   "DEL",
 	"VALUES": "DEL",
 	"CREATE": "DEL",
@@ -52,44 +115,85 @@ var transformationRules = map[string]string{
 	")":      "DEL",
 }
 
-func ConvertToAST(root narytree.Node) narytree.Node {
+// ConvertToAST turns the parse tree of a statement into its abstract syntax tree. The parse tree is left
+// unchanged.
+func ConvertToAST(root narytree.Node) (narytree.Node, error) {
 	astRoot := root
 	astRoot.Type = determineQueryType(&astRoot) // set root node based on type
 	astRoot.Data = ""
+	astRoot.Children = append([]narytree.Node{}, root.Children...) // children are removed below, don't touch the parse tree's
+
+	if astRoot.Type == "" {
+		return narytree.Node{}, errors.New("could not determine the query type! must be one of: SELECT, INSERT, UPDATE, CREATE")
+	}
 
+	astRoot.Children = convertClauses(astRoot.Children)
+	return astRoot, nil
+}
+
+// convertClauses converts the clauses of a statement, dropping keywords and the optional clauses that were
+// left out. children is changed in place.
+func convertClauses(children []narytree.Node) []narytree.Node {
 	i := 0
-	for i < len(astRoot.Children) {
-		if rule := transformationRules[astRoot.Children[i].Data]; rule == "DEL" {
-			astRoot.Children = append(astRoot.Children[:i], astRoot.Children[i+1:]...) // remove child
+	for i < len(children) {
+		if rule := ruleFor(children[i]); rule == "DEL" || isEmptyOptionalClause(children[i]) {
+			children = append(children[:i], children[i+1:]...) // remove child
 			continue
 		}
 
 		// if we don't have '&', we get a copy of the node and do the transformation on the copy.
 		// this means that the original node inside the slice is left unchanged.
-		node := &astRoot.Children[i]
+		node := &children[i]
 		transformNode(node)
 		i++
 	}
+	return children
+}
 
-	return astRoot
+// convertSubquery turns a query in parentheses into a SubqueryNode holding the AST of the query:
+//
+//	(SELECT a FROM t)  ->  SubqueryNode -> SelectNode -> ColumnListNode -> IdentifierNode a
+//	                                                     FromNode -> TableNameNode t
+func convertSubquery(node narytree.Node) narytree.Node {
+	clauses := append([]narytree.Node{}, node.Children[1].Children...) // don't touch the parse tree's
+	selectNode := narytree.Node{ Type: SelectNode, Children: convertClauses(clauses) }
+	return narytree.Node{ Type: SubqueryNode, Children: []narytree.Node{ selectNode } }
+}
+
+// isEmptyOptionalClause reports whether node is an optional clause, like <optional_where>, that was left out
+// of the query. Those don't show up in the AST at all.
+func isEmptyOptionalClause(node narytree.Node) bool {
+	return strings.HasPrefix(node.Data, "<optional_") && len(node.Children) == 0
+}
+
+// ruleFor looks up the transformation rule of a node. Identifiers and literals never have a rule, otherwise
+// a quoted identifier like "select" would be mistaken for the keyword.
+func ruleFor(node narytree.Node) string {
+	switch tokens.Kind(node.Type) {
+		case tokens.IDENTIFIER, tokens.STRING, tokens.NUMBER, tokens.PARAMETER:
+			return ""
+	}
+	return transformationRules[node.Data]
 }
 
 func determineQueryType(node *narytree.Node) string {
 	for _, child := range node.Children {
 		switch child.Data {
-			case "SELECT":
+			case "SELECT", "<set_operation>":
 				return SelectNode
 			case "CREATE":
 				return CreateTableNode
 			case "INSERT":
 				return InsertNode
+			case "UPDATE":
+				return UpdateNode
 		}
 	}
 	return ""
 }
 
 func transformNode(node *narytree.Node) {
-	ruleName := transformationRules[node.Data]
+	ruleName := ruleFor(*node)
 
 	if ruleName == "DEL" {
 		return
@@ -105,28 +209,95 @@ func transformNode(node *narytree.Node) {
 		return
 	}
 
-	// handle binary operation node (WHERE clause)
-	if ruleName == BinaryOperationNode {
-		node.Type = BinaryOperationNode
-		node.Data = "WhereClause"
-		identifiers := collectIdentifiers(node)
-
-		// label the children as Left, Operator, Right
-		var newChildren []narytree.Node
-		for i, child := range identifiers {
-			switch i {
-				case 0:
-					child.Type = Left
-				case 1:
-					child.Type = Operator
-				case 2:
-					child.Type = Right
-			}
+	// handle the WHERE, HAVING, LIMIT and OFFSET clauses, the keyword is dropped and what follows becomes an
+	// expression tree
+	if ruleName == WhereNode || ruleName == HavingNode || ruleName == LimitNode || ruleName == OffsetNode {
+		node.Type = ruleName
+		node.Data = ""
+		node.Children = []narytree.Node{ convertExpression(node.Children[1]) }
+		return
+	}
+
+	// handle GROUP BY, the keywords are dropped and every expression becomes a child
+	if ruleName == GroupByNode {
+		node.Type = GroupByNode
+		node.Data = ""
+		node.Children = convertExpressionList(node.Children[2:])
+		return
+	}
+
+	// handle UNION, INTERSECT and EXCEPT
+	if ruleName == SetOperationNode {
+		*node = convertSetOperation(*node)
+		return
+	}
+
+	// handle WITH
+	if ruleName == WithNode {
+		*node = convertWith(*node)
+		return
+	}
 
-			newChildren = append(newChildren, child)
+	// handle the values of a row of INSERT, DEFAULT becomes a DefaultNode
+	// VALUES (1 + 2, DEFAULT)  ->  ValuesListNode -> BinaryOperationNode, DefaultNode
+	if ruleName == ValuesListNode {
+		node.Type = ValuesListNode
+		node.Data = ""
+		node.Children = convertValueList(*node)
+		return
+	}
+
+	// handle the SET clause of UPDATE, every column and its new value becomes an AssignmentNode
+	// SET a = a + 1, b = DEFAULT  ->  SetListNode -> AssignmentNode a -> BinaryOperationNode
+	//                                                AssignmentNode b -> DefaultNode
+	if ruleName == SetListNode {
+		node.Type = SetListNode
+		node.Data = ""
+		node.Children = convertSetList(*node)
+		return
+	}
+
+	// handle the query of INSERT ... SELECT
+	if ruleName == SelectNode {
+		clauses := append([]narytree.Node{}, node.Children...) // don't touch the parse tree's
+		*node = narytree.Node{ Type: SelectNode, Children: convertClauses(clauses) }
+		return
+	}
+
+	// handle DISTINCT, the expressions of DISTINCT ON become its children
+	// DISTINCT ON (a, b)  ->  DistinctNode -> IdentifierNode a, IdentifierNode b
+	if ruleName == DistinctNode {
+		var expressions []narytree.Node
+		if len(node.Children) > 1 {
+			expressions = convertExpressionList(node.Children[3:len(node.Children) - 1]) // DISTINCT ON ( ... )
 		}
+		node.Type = DistinctNode
+		node.Data = ""
+		node.Children = expressions
+		return
+	}
+
+	// handle the FROM clause, a list of tables
+	if ruleName == FromNode {
+		node.Type = FromNode
+		node.Data = ""
+		node.Children = convertFromList(*node)
+		return
+	}
 
-		node.Children = newChildren
+	// handle ORDER BY, every item becomes an OrderItemNode
+	if ruleName == OrderByNode {
+		node.Type = OrderByNode
+		node.Data = ""
+		node.Children = convertOrderBy(*node)
+		return
+	}
+
+	// handle the select list, every item is an expression
+	if node.Data == "<select_list>" {
+		node.Type = ColumnListNode
+		node.Data = ""
+		node.Children = convertSelectList(*node)
 		return
 	}
 
@@ -143,11 +314,11 @@ func collectIdentifiers(currentNode *narytree.Node) []narytree.Node {
 	var result []narytree.Node
 
 	for _, child := range currentNode.Children {
-		ruleName := transformationRules[child.Data]
+		ruleName := ruleFor(child)
 
 		switch ruleName {
 			case "":
-				child.Type = IdentifierNode
+				child.Type = leafNodeType(child)
 				result = append(result, child)
 				
 			case ColumnDefNode:
@@ -156,7 +327,7 @@ func collectIdentifiers(currentNode *narytree.Node) []narytree.Node {
 				var newChildren []narytree.Node
 
 				for i, grandchild := range child.Children {
-					grandchildRule := transformationRules[grandchild.Data]
+					grandchildRule := ruleFor(grandchild)
 
 					if i == 0 { // this is the name of the column
 						grandchild.Type = IdentifierNode
@@ -195,6 +366,538 @@ func collectIdentifiers(currentNode *narytree.Node) []narytree.Node {
 	return result
 }
 
+// convertSelectList turns the items of a select list into expressions. An item with an alias becomes an
+// AliasNode holding the expression, and '*' or 't.*' becomes a StarNode with the table name, if any, in Data:
+//
+//	SELECT *, u.*, a + 1 AS total  ->  ColumnListNode -> StarNode
+//	                                                     StarNode u
+//	                                                     AliasNode total -> BinaryOperationNode -> ...
+func convertSelectList(node narytree.Node) []narytree.Node {
+	var items []narytree.Node
+
+	for _, selectItem := range node.Children {
+		if selectItem.Data != "<select_item>" {
+			continue // ','
+		}
+
+		first := selectItem.Children[0]
+		if first.Data == "<all_columns>" {
+			star := narytree.Node{ Type: StarNode }
+			if len(first.Children) > 1 {
+				star.Data = first.Children[0].Data
+			}
+			items = append(items, star)
+			continue
+		}
+
+		item := convertExpression(first)
+		if len(selectItem.Children) > 1 {
+			alias := selectItem.Children[1]
+			item = narytree.Node{ Type: AliasNode, Data: alias.Children[len(alias.Children) - 1].Data, Children: []narytree.Node{ item } }
+		}
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// convertFromList turns the tables of a FROM clause into TableNameNodes and JoinNodes. A table with an alias
+// gets an AliasNode child:
+//
+//	FROM users AS u, orders  ->  FromNode -> TableNameNode users -> AliasNode u
+//	                                         TableNameNode orders
+func convertFromList(node narytree.Node) []narytree.Node {
+	var tables []narytree.Node
+
+	for _, child := range node.Children {
+		switch child.Data {
+			case "<table_reference>":
+				tables = append(tables, convertTableReference(child))
+			case "<join>":
+				tables = append(tables, convertJoin(child))
+		}
+	}
+
+	return tables
+}
+
+// convertJoin turns a join into a JoinNode. Data is the kind of join, one of INNER, LEFT, RIGHT, FULL or
+// CROSS, and the children are both sides followed by how rows are matched:
+//
+//	JoinNode LEFT -> TableNameNode or JoinNode, TableNameNode, OnNode -> condition
+//	                                                           UsingNode -> IdentifierNode, ...
+func convertJoin(node narytree.Node) narytree.Node {
+	joinNode := narytree.Node{ Type: JoinNode, Data: "INNER" }
+
+	for _, child := range node.Children {
+		switch {
+			case child.Data == "<table_reference>":
+				joinNode.AddChild(convertTableReference(child))
+			case child.Data == "<join>":
+				joinNode.AddChild(convertJoin(child))
+			case child.Data == "<join_condition>":
+				joinNode.AddChild(convertJoinCondition(child))
+			case child.Data == "LEFT", child.Data == "RIGHT", child.Data == "FULL", child.Data == "CROSS":
+				joinNode.Data = child.Data
+		}
+	}
+
+	return joinNode
+}
+
+// convertJoinCondition turns 'ON condition' into an OnNode and 'USING (a, b)' into a UsingNode listing the
+// columns.
+func convertJoinCondition(node narytree.Node) narytree.Node {
+	if node.Children[0].Data == "ON" {
+		return narytree.Node{ Type: OnNode, Children: []narytree.Node{ convertExpression(node.Children[1]) } }
+	}
+
+	usingNode := narytree.Node{ Type: UsingNode }
+	for _, child := range node.Children[1:] {
+		if tokens.Kind(child.Type) == tokens.IDENTIFIER {
+			usingNode.AddChild(narytree.Node{ Type: IdentifierNode, Data: child.Data })
+		}
+	}
+	return usingNode
+}
+
+// convertSetOperation turns UNION, INTERSECT and EXCEPT into a SetOperationNode. Data is the operator,
+// followed by ALL if it was given, and the children are the two queries it combines. The whole statement
+// stays a SelectNode, so ORDER BY and LIMIT after the last query sit next to the SetOperationNode:
+//
+//	SELECT a FROM t UNION ALL SELECT b FROM u ORDER BY 1  ->  SelectNode -> SetOperationNode UNION ALL -> SelectNode -> ...
+//	                                                                                                      SelectNode -> ...
+//	                                                                        OrderByNode -> ...
+func convertSetOperation(node narytree.Node) narytree.Node {
+	setOperation := narytree.Node{ Type: SetOperationNode }
+
+	for _, child := range node.Children {
+		switch child.Data {
+			case "<select_core>":
+				clauses := append([]narytree.Node{}, child.Children...) // don't touch the parse tree's
+				setOperation.AddChild(narytree.Node{ Type: SelectNode, Children: convertClauses(clauses) })
+			case "<subquery>":
+				setOperation.AddChild(convertSubquery(child).Children[0])
+			case "<set_operation>":
+				setOperation.AddChild(convertSetOperation(child))
+			case "UNION", "INTERSECT", "EXCEPT":
+				setOperation.Data = child.Data
+			case "ALL":
+				setOperation.Data += " ALL"
+		}
+	}
+
+	return setOperation
+}
+
+// convertWith turns a WITH clause into a WithNode, with RECURSIVE in Data if it was given. Every query it
+// names becomes a CommonTableNode with the name in Data, holding the names given to its columns, if any,
+// and the query:
+//
+//	WITH t (a) AS (SELECT x FROM u)  ->  WithNode -> CommonTableNode t -> ColumnListNode -> IdentifierNode a
+//	                                                                      SelectNode -> ...
+func convertWith(node narytree.Node) narytree.Node {
+	withNode := narytree.Node{ Type: WithNode }
+
+	for _, child := range node.Children {
+		switch {
+			case child.Data == "RECURSIVE" && tokens.Kind(child.Type) == tokens.KEYWORD:
+				withNode.Data = "RECURSIVE"
+			case child.Data == "<common_table_expression>":
+				withNode.AddChild(convertCommonTable(child))
+		}
+	}
+
+	return withNode
+}
+
+// <common_table_expression> := identifier [( identifier { , identifier } )] AS <subquery>
+func convertCommonTable(node narytree.Node) narytree.Node {
+	commonTable := narytree.Node{ Type: CommonTableNode, Data: node.Children[0].Data }
+
+	columnList := narytree.Node{ Type: ColumnListNode }
+	for _, child := range node.Children[1:] {
+		if tokens.Kind(child.Type) == tokens.IDENTIFIER {
+			columnList.AddChild(narytree.Node{ Type: IdentifierNode, Data: child.Data })
+		}
+	}
+	if len(columnList.Children) > 0 {
+		commonTable.AddChild(columnList)
+	}
+
+	subquery := convertSubquery(node.Children[len(node.Children) - 1])
+	commonTable.AddChild(subquery.Children[0])
+	return commonTable
+}
+
+// convertValueList turns the values of a row of INSERT into expressions.
+func convertValueList(node narytree.Node) []narytree.Node {
+	var values []narytree.Node
+	for _, child := range node.Children {
+		if child.Data == "<value>" {
+			values = append(values, convertValue(child))
+		}
+	}
+	return values
+}
+
+// convertSetList turns the SET clause of UPDATE into AssignmentNodes, the column name in Data and the new
+// value as the only child.
+func convertSetList(node narytree.Node) []narytree.Node {
+	var assignments []narytree.Node
+	for _, child := range node.Children {
+		if child.Data != "<set_clause>" {
+			continue
+		}
+		assignment := narytree.Node{ Type: AssignmentNode, Data: child.Children[0].Data }
+		assignment.AddChild(convertValue(child.Children[2]))
+		assignments = append(assignments, assignment)
+	}
+	return assignments
+}
+
+// convertValue turns a <value> into an expression, or a DefaultNode for DEFAULT.
+func convertValue(node narytree.Node) narytree.Node {
+	value := node.Children[0]
+	if value.Data == "DEFAULT" && tokens.Kind(value.Type) == tokens.KEYWORD {
+		return narytree.Node{ Type: DefaultNode }
+	}
+	return convertExpression(value)
+}
+
+// convertTableReference turns a <table_reference> into a TableNameNode with an optional AliasNode child. A
+// subquery becomes a SubqueryNode with the AliasNode after its SelectNode.
+func convertTableReference(node narytree.Node) narytree.Node {
+	if node.Children[0].Data == "<subquery>" {
+		subquery := convertSubquery(node.Children[0])
+		alias := node.Children[1]
+		subquery.AddChild(narytree.Node{ Type: AliasNode, Data: alias.Children[len(alias.Children) - 1].Data })
+		return subquery
+	}
+
+	table := narytree.Node{ Type: TableNameNode, Data: node.Children[0].Children[0].Data }
+	if len(node.Children) > 1 {
+		alias := node.Children[1]
+		table.AddChild(narytree.Node{ Type: AliasNode, Data: alias.Children[len(alias.Children) - 1].Data })
+	}
+	return table
+}
+
+// convertExpression turns the parse tree of an expression into nested expression nodes:
+//
+//	a = 1 AND NOT b  ->  BinaryOperationNode -> Left -> BinaryOperationNode -> Left -> IdentifierNode a
+//	                                                                         Operator =
+//	                                                                         Right -> NumberLiteralNode 1
+//	                                            Operator AND
+//	                                            Right -> UnaryOperationNode -> Operator NOT
+//	                                                                           IdentifierNode b
+//
+// Parentheses only group and are dropped, and a '-' in front of a number is folded into the literal.
+func convertExpression(node narytree.Node) narytree.Node {
+	switch node.Data {
+		case "<binary_expression>":
+			left := convertExpression(node.Children[0])
+			right := convertExpression(node.Children[2])
+			return narytree.Node{ Type: BinaryOperationNode, Children: []narytree.Node{
+				{ Type: Left, Children: []narytree.Node{ left } },
+				{ Type: Operator, Data: node.Children[1].Data },
+				{ Type: Right, Children: []narytree.Node{ right } },
+			} }
+
+		case "<unary_expression>":
+			operator := node.Children[0].Data
+			operand := convertExpression(node.Children[1])
+
+			// parsing the negated text rather than negating the value keeps -9223372036854775808 an integer
+			if operator == "-" && operand.Type == NumberLiteralNode && !strings.HasPrefix(operand.Data, "-") {
+				if value, err := tokens.ParseNumber("-" + operand.Data); err == nil {
+					operand.Data = "-" + operand.Data
+					operand.Value = value
+					return operand
+				}
+			}
+			if operator == "+" && operand.Type == NumberLiteralNode {
+				return operand
+			}
+
+			return narytree.Node{ Type: UnaryOperationNode, Children: []narytree.Node{
+				{ Type: Operator, Data: operator },
+				operand,
+			} }
+
+		case "<parenthesized_expression>":
+			return convertExpression(node.Children[1])
+
+		case "<in_predicate>", "<between_predicate>", "<like_predicate>", "<is_null_predicate>":
+			return convertPredicate(node)
+
+		case "<case_expression>":
+			return convertCase(node)
+
+		case "<subquery>":
+			return convertSubquery(node)
+
+		case "<exists_predicate>":
+			// ExistsNode -> SubqueryNode
+			return narytree.Node{ Type: ExistsNode, Children: []narytree.Node{ convertSubquery(node.Children[1]) } }
+
+		case "<quantified_comparison>":
+			// a < ALL (SELECT ...)  ->  QuantifiedNode "< ALL" -> tested expression, SubqueryNode
+			return narytree.Node{ Type: QuantifiedNode, Data: node.Children[1].Data + " " + node.Children[2].Data, Children: []narytree.Node{
+				convertExpression(node.Children[0]),
+				convertSubquery(node.Children[3]),
+			} }
+
+		case "<function_call>":
+			// FunctionCallNode -> [DistinctNode], argument, argument, ... where COUNT(*) has a StarNode as its
+			// argument. With OVER it is a WindowFunctionNode instead, with a WindowNode after the arguments.
+			functionCall := narytree.Node{ Type: FunctionCallNode, Data: node.Children[0].Data }
+			arguments := node.Children[2:len(node.Children) - 1]
+			overClause := node.Children[len(node.Children) - 1]
+			if overClause.Data == "<over_clause>" {
+				functionCall.Type = WindowFunctionNode
+				arguments = node.Children[2:len(node.Children) - 2]
+			}
+			for _, argument := range arguments {
+				switch {
+					case tokens.Kind(argument.Type) == tokens.COMMA:
+						continue
+					case tokens.Kind(argument.Type) == tokens.KEYWORD && argument.Data == "DISTINCT":
+						functionCall.AddChild(narytree.Node{ Type: DistinctNode })
+					case isAsterisk(argument):
+						functionCall.AddChild(narytree.Node{ Type: StarNode })
+					default:
+						functionCall.AddChild(convertExpression(argument))
+				}
+			}
+			if functionCall.Type == WindowFunctionNode {
+				functionCall.AddChild(convertOverClause(overClause))
+			}
+			return functionCall
+
+		case "<qualified_name>":
+			// QualifiedNameNode -> IdentifierNode table, IdentifierNode column
+			return narytree.Node{ Type: QualifiedNameNode, Children: []narytree.Node{
+				{ Type: IdentifierNode, Data: node.Children[0].Data },
+				{ Type: IdentifierNode, Data: node.Children[2].Data },
+			} }
+	}
+
+	node.Type = leafNodeType(node)
+	node.Children = nil
+	return node
+}
+
+// convertOrderBy turns the items of ORDER BY into OrderItemNodes. Data is the direction, ASC unless DESC
+// was given, and NULLS FIRST or NULLS LAST become a NullsOrderNode:
+//
+//	ORDER BY a DESC NULLS LAST, b  ->  OrderByNode -> OrderItemNode DESC -> IdentifierNode a, NullsOrderNode LAST
+//	                                                  OrderItemNode ASC -> IdentifierNode b
+func convertOrderBy(node narytree.Node) []narytree.Node {
+	var items []narytree.Node
+
+	for _, orderItem := range node.Children {
+		if orderItem.Data != "<order_item>" {
+			continue // ORDER, BY and ','
+		}
+
+		item := narytree.Node{ Type: OrderItemNode, Data: "ASC" }
+		item.AddChild(convertExpression(orderItem.Children[0]))
+
+		for _, keyword := range orderItem.Children[1:] {
+			switch keyword.Data {
+				case "ASC", "DESC":
+					item.Data = keyword.Data
+				case "FIRST", "LAST":
+					item.AddChild(narytree.Node{ Type: NullsOrderNode, Data: keyword.Data })
+			}
+		}
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// convertOverClause turns the window of a window function into a WindowNode. A frame given by its start
+// alone ends at the current row:
+//
+//	OVER (PARTITION BY a ORDER BY b ROWS 2 PRECEDING)  ->  WindowNode -> PartitionByNode -> IdentifierNode a
+//	                                                                     OrderByNode -> OrderItemNode ASC -> IdentifierNode b
+//	                                                                     FrameNode ROWS -> FrameBoundNode PRECEDING -> NumberLiteralNode 2
+//	                                                                                       FrameBoundNode CURRENT ROW
+func convertOverClause(node narytree.Node) narytree.Node {
+	window := narytree.Node{ Type: WindowNode }
+
+	for _, child := range node.Children {
+		switch child.Data {
+			case "<partition_by>":
+				window.AddChild(narytree.Node{ Type: PartitionByNode, Children: convertExpressionList(child.Children[2:]) })
+			case "<optional_order_by>":
+				if len(child.Children) > 0 {
+					window.AddChild(narytree.Node{ Type: OrderByNode, Children: convertOrderBy(child) })
+				}
+			case "<frame_clause>":
+				frame := narytree.Node{ Type: FrameNode, Data: child.Children[0].Data }
+				for _, bound := range child.Children[1:] {
+					if bound.Data == "<frame_bound>" {
+						frame.AddChild(convertFrameBound(bound))
+					}
+				}
+				if len(frame.Children) == 1 {
+					frame.AddChild(narytree.Node{ Type: FrameBoundNode, Data: "CURRENT ROW" })
+				}
+				window.AddChild(frame)
+		}
+	}
+
+	return window
+}
+
+// convertFrameBound turns a bound of a window frame into a FrameBoundNode. Data is the words of the bound,
+// like UNBOUNDED PRECEDING or CURRENT ROW; a bound with an offset has PRECEDING or FOLLOWING in Data and
+// the offset as its child.
+func convertFrameBound(node narytree.Node) narytree.Node {
+	bound := narytree.Node{ Type: FrameBoundNode }
+
+	var words []string
+	for _, child := range node.Children {
+		if tokens.Kind(child.Type) == tokens.KEYWORD {
+			words = append(words, child.Data)
+		} else {
+			bound.AddChild(convertExpression(child))
+		}
+	}
+	bound.Data = strings.Join(words, " ")
+	return bound
+}
+
+// convertExpressionList converts the expressions of a comma separated list.
+func convertExpressionList(nodes []narytree.Node) []narytree.Node {
+	var expressions []narytree.Node
+	for _, node := range nodes {
+		if tokens.Kind(node.Type) == tokens.COMMA {
+			continue
+		}
+		expressions = append(expressions, convertExpression(node))
+	}
+	return expressions
+}
+
+// predicateTypes maps each predicate of the parse tree to its AST node.
+var predicateTypes = map[string]string{
+	"<in_predicate>":      InListNode,
+	"<between_predicate>": BetweenNode,
+	"<like_predicate>":    LikeNode,
+	"<is_null_predicate>": IsNullNode,
+}
+
+// convertPredicate turns IN, BETWEEN, LIKE and IS NULL predicates into their AST nodes. The keywords end up
+// in Data, e.g. "NOT IN" or "IS NOT NULL", and the children are the expressions in the order they were
+// written:
+//
+//	InListNode  -> tested expression, item, item, ...
+//	InSubqueryNode -> tested expression, SubqueryNode
+//	BetweenNode -> tested expression, low, high
+//	LikeNode    -> tested expression, pattern, optional escape character
+//	IsNullNode  -> tested expression
+func convertPredicate(node narytree.Node) narytree.Node {
+	predicate := narytree.Node{ Type: predicateTypes[node.Data] }
+	predicate.AddChild(convertExpression(node.Children[0]))
+
+	// the keywords come right after the tested expression: [NOT] IN, [NOT] BETWEEN, [NOT] LIKE or IS [NOT] NULL
+	var keywords []string
+	i := 1
+	for i < len(node.Children) && len(keywords) < 3 {
+		keyword := node.Children[i].Data
+		keywords = append(keywords, keyword)
+		i++
+
+		if keyword != "NOT" && keyword != "IS" {
+			break
+		}
+	}
+	predicate.Data = strings.Join(keywords, " ")
+
+	rest := node.Children[i:]
+	if predicate.Type == InListNode && rest[0].Data == "<subquery>" {
+		predicate.Type = InSubqueryNode
+		predicate.AddChild(convertSubquery(rest[0]))
+		return predicate
+	}
+
+	switch predicate.Type {
+		case InListNode:
+			// ( item , item , ... )
+			for j := 1; j < len(rest); j += 2 {
+				predicate.AddChild(convertExpression(rest[j]))
+			}
+		case BetweenNode, LikeNode:
+			// low AND high, or pattern [ESCAPE escape]
+			for j := 0; j < len(rest); j += 2 {
+				predicate.AddChild(convertExpression(rest[j]))
+			}
+	}
+
+	return predicate
+}
+
+// convertCase turns a CASE expression into a CaseNode. The simple form keeps its operand as the first
+// child, followed by a WhenNode per branch and an optional ElseNode:
+//
+//	CaseNode -> [operand], WhenNode -> value or condition, result
+//	                       ElseNode -> result
+func convertCase(node narytree.Node) narytree.Node {
+	caseNode := narytree.Node{ Type: CaseNode }
+
+	for i := 1; i < len(node.Children); i++ {
+		child := node.Children[i]
+
+		switch {
+			case child.Data == "<when_clause>":
+				caseNode.AddChild(narytree.Node{ Type: WhenNode, Children: []narytree.Node{
+					convertExpression(child.Children[1]),
+					convertExpression(child.Children[3]),
+				} })
+			case tokens.Kind(child.Type) == tokens.KEYWORD && child.Data == "ELSE":
+				i++
+				caseNode.AddChild(narytree.Node{ Type: ElseNode, Children: []narytree.Node{ convertExpression(node.Children[i]) } })
+			case tokens.Kind(child.Type) == tokens.KEYWORD && child.Data == "END":
+				continue
+			default:
+				caseNode.AddChild(convertExpression(child)) // the operand of a simple CASE
+		}
+	}
+
+	return caseNode
+}
+
+// isAsterisk reports whether a parse tree leaf is the symbol '*', and not a quoted identifier "*".
+func isAsterisk(leaf narytree.Node) bool {
+	return tokens.Kind(leaf.Type) == tokens.Kind(tokens.ReservedSymbols["*"])
+}
+
+// leafNodeType picks the AST type of a parse tree leaf based on the kind of token it was made from.
+func leafNodeType(leaf narytree.Node) string {
+	switch tokens.Kind(leaf.Type) {
+		case tokens.STRING:
+			return StringLiteralNode
+		case tokens.NUMBER:
+			return NumberLiteralNode
+		case tokens.PARAMETER:
+			return ParameterNode
+		case tokens.KEYWORD:
+			if leaf.Data == "NULL" {
+				return NullLiteralNode
+			}
+			if leaf.Data == "TRUE" || leaf.Data == "FALSE" {
+				return BooleanLiteralNode
+			}
+			return IdentifierNode
+		default:
+			return IdentifierNode
+	}
+}
+
 func processDataType(node *narytree.Node) {
 	if len(node.Children) == 0 {
 		return
@@ -0,0 +1,204 @@
+package parser
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+)
+
+// render writes an AST on one line as Type:Data(children...), e.g. TableNameNode:t or
+// FromNode(TableNameNode:t).
+func render(node narytree.Node) string {
+	text := node.Type
+	if node.Data != "" {
+		text += ":" + node.Data
+	}
+	if len(node.Children) > 0 {
+		children := make([]string, len(node.Children))
+		for i, child := range node.Children {
+			children[i] = render(child)
+		}
+		text += "(" + strings.Join(children, " ") + ")"
+	}
+	return text
+}
+
+func TestConvertToAST(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			"SELECT a, b FROM t WHERE a = 1",
+			"SelectNode(ColumnListNode(IdentifierNode:a IdentifierNode:b) FromNode(TableNameNode:t) WhereNode(BinaryOperationNode(Left(IdentifierNode:a) Operator:= Right(NumberLiteralNode:1))))",
+		},
+		{
+			"INSERT INTO t (a, b) VALUES (1, 'x')",
+			"InsertNode(TableNameNode:t ColumnListNode(IdentifierNode:a IdentifierNode:b) ValuesListNode(NumberLiteralNode:1 StringLiteralNode:x))",
+		},
+		{
+			"SELECT a, t.b AS x, * FROM t",
+			"SelectNode(ColumnListNode(IdentifierNode:a AliasNode:x(QualifiedNameNode(IdentifierNode:t IdentifierNode:b)) StarNode) FromNode(TableNameNode:t))",
+		},
+		{
+			"SELECT -1.5, 'x', NULL, TRUE, ? FROM t",
+			"SelectNode(ColumnListNode(NumberLiteralNode:-1.5 StringLiteralNode:x NullLiteralNode:NULL BooleanLiteralNode:TRUE ParameterNode:$1) FromNode(TableNameNode:t))",
+		},
+		{
+			"SELECT a FROM t WHERE a = 1 AND NOT b OR c > -3",
+			"SelectNode(ColumnListNode(IdentifierNode:a) FromNode(TableNameNode:t) WhereNode(BinaryOperationNode(" +
+				"Left(BinaryOperationNode(Left(BinaryOperationNode(Left(IdentifierNode:a) Operator:= Right(NumberLiteralNode:1))) Operator:AND Right(UnaryOperationNode(Operator:NOT IdentifierNode:b)))) " +
+				"Operator:OR Right(BinaryOperationNode(Left(IdentifierNode:c) Operator:> Right(NumberLiteralNode:-3))))))",
+		},
+		{
+			"SELECT (a + 1) * 2 - b / c FROM t",
+			"SelectNode(ColumnListNode(BinaryOperationNode(Left(BinaryOperationNode(Left(BinaryOperationNode(Left(IdentifierNode:a) Operator:+ Right(NumberLiteralNode:1))) Operator:* Right(NumberLiteralNode:2))) " +
+				"Operator:- Right(BinaryOperationNode(Left(IdentifierNode:b) Operator:/ Right(IdentifierNode:c))))) FromNode(TableNameNode:t))",
+		},
+		{
+			"SELECT a FROM t WHERE a IN (1, 2) AND b NOT BETWEEN 1 AND 2 AND c LIKE 'x%' AND d IS NOT NULL",
+			"SelectNode(ColumnListNode(IdentifierNode:a) FromNode(TableNameNode:t) WhereNode(BinaryOperationNode(Left(BinaryOperationNode(Left(BinaryOperationNode(" +
+				"Left(InListNode:IN(IdentifierNode:a NumberLiteralNode:1 NumberLiteralNode:2)) Operator:AND Right(BetweenNode:NOT BETWEEN(IdentifierNode:b NumberLiteralNode:1 NumberLiteralNode:2)))) " +
+				"Operator:AND Right(LikeNode:LIKE(IdentifierNode:c StringLiteralNode:x%)))) Operator:AND Right(IsNullNode:IS NOT NULL(IdentifierNode:d)))))",
+		},
+		{
+			"SELECT CASE a WHEN 1 THEN 'one' ELSE 'other' END, CASE WHEN a > 1 THEN 1 END FROM t",
+			"SelectNode(ColumnListNode(CaseNode(IdentifierNode:a WhenNode(NumberLiteralNode:1 StringLiteralNode:one) ElseNode(StringLiteralNode:other)) " +
+				"CaseNode(WhenNode(BinaryOperationNode(Left(IdentifierNode:a) Operator:> Right(NumberLiteralNode:1)) NumberLiteralNode:1))) FromNode(TableNameNode:t))",
+		},
+		{
+			"SELECT UPPER(a), COUNT(*), COUNT(DISTINCT b) FROM t",
+			"SelectNode(ColumnListNode(FunctionCallNode:upper(IdentifierNode:a) FunctionCallNode:count(StarNode) FunctionCallNode:count(DistinctNode IdentifierNode:b)) FromNode(TableNameNode:t))",
+		},
+		{
+			"SELECT * FROM a AS x, b y",
+			"SelectNode(ColumnListNode(StarNode) FromNode(TableNameNode:a(AliasNode:x) TableNameNode:b(AliasNode:y)))",
+		},
+		{
+			"SELECT * FROM a JOIN b ON a.id = b.id LEFT JOIN c USING (id) CROSS JOIN d",
+			"SelectNode(ColumnListNode(StarNode) FromNode(JoinNode:CROSS(JoinNode:LEFT(JoinNode:INNER(TableNameNode:a TableNameNode:b " +
+				"OnNode(BinaryOperationNode(Left(QualifiedNameNode(IdentifierNode:a IdentifierNode:id)) Operator:= Right(QualifiedNameNode(IdentifierNode:b IdentifierNode:id))))) " +
+				"TableNameNode:c UsingNode(IdentifierNode:id)) TableNameNode:d)))",
+		},
+		{
+			"SELECT a, SUM(b) FROM t GROUP BY a HAVING SUM(b) > 1",
+			"SelectNode(ColumnListNode(IdentifierNode:a FunctionCallNode:sum(IdentifierNode:b)) FromNode(TableNameNode:t) GroupByNode(IdentifierNode:a) " +
+				"HavingNode(BinaryOperationNode(Left(FunctionCallNode:sum(IdentifierNode:b)) Operator:> Right(NumberLiteralNode:1))))",
+		},
+		{
+			"SELECT a FROM t ORDER BY a DESC NULLS FIRST, b LIMIT 10 OFFSET 5",
+			"SelectNode(ColumnListNode(IdentifierNode:a) FromNode(TableNameNode:t) OrderByNode(OrderItemNode:DESC(IdentifierNode:a NullsOrderNode:FIRST) OrderItemNode:ASC(IdentifierNode:b)) " +
+				"LimitNode(NumberLiteralNode:10) OffsetNode(NumberLiteralNode:5))",
+		},
+		{
+			"SELECT DISTINCT ON (a) a, b FROM t",
+			"SelectNode(DistinctNode(IdentifierNode:a) ColumnListNode(IdentifierNode:a IdentifierNode:b) FromNode(TableNameNode:t))",
+		},
+		{
+			"SELECT (SELECT MAX(b) FROM u) FROM (SELECT a FROM t) AS s WHERE EXISTS (SELECT 1 FROM u) AND a > ALL (SELECT b FROM u)",
+			"SelectNode(ColumnListNode(SubqueryNode(SelectNode(ColumnListNode(FunctionCallNode:max(IdentifierNode:b)) FromNode(TableNameNode:u)))) " +
+				"FromNode(SubqueryNode(SelectNode(ColumnListNode(IdentifierNode:a) FromNode(TableNameNode:t)) AliasNode:s)) " +
+				"WhereNode(BinaryOperationNode(Left(ExistsNode(SubqueryNode(SelectNode(ColumnListNode(NumberLiteralNode:1) FromNode(TableNameNode:u))))) " +
+				"Operator:AND Right(QuantifiedNode:> ALL(IdentifierNode:a SubqueryNode(SelectNode(ColumnListNode(IdentifierNode:b) FromNode(TableNameNode:u))))))))",
+		},
+		{
+			"SELECT a FROM t WHERE a IN (SELECT b FROM u)",
+			"SelectNode(ColumnListNode(IdentifierNode:a) FromNode(TableNameNode:t) WhereNode(InSubqueryNode:IN(IdentifierNode:a SubqueryNode(SelectNode(ColumnListNode(IdentifierNode:b) FromNode(TableNameNode:u))))))",
+		},
+		{
+			"SELECT a FROM t UNION ALL SELECT b FROM u INTERSECT SELECT c FROM v ORDER BY 1",
+			"SelectNode(SetOperationNode:UNION ALL(SelectNode(ColumnListNode(IdentifierNode:a) FromNode(TableNameNode:t)) SetOperationNode:INTERSECT(" +
+				"SelectNode(ColumnListNode(IdentifierNode:b) FromNode(TableNameNode:u)) SelectNode(ColumnListNode(IdentifierNode:c) FromNode(TableNameNode:v)))) " +
+				"OrderByNode(OrderItemNode:ASC(NumberLiteralNode:1)))",
+		},
+		{
+			"(SELECT a FROM t LIMIT 1) UNION SELECT b FROM u",
+			"SelectNode(SetOperationNode:UNION(SelectNode(ColumnListNode(IdentifierNode:a) FromNode(TableNameNode:t) LimitNode(NumberLiteralNode:1)) " +
+				"SelectNode(ColumnListNode(IdentifierNode:b) FromNode(TableNameNode:u))))",
+		},
+		{
+			"WITH RECURSIVE r (n) AS (SELECT 1 FROM t UNION SELECT n + 1 FROM r) SELECT n FROM r",
+			"SelectNode(WithNode:RECURSIVE(CommonTableNode:r(ColumnListNode(IdentifierNode:n) SelectNode(SetOperationNode:UNION(" +
+				"SelectNode(ColumnListNode(NumberLiteralNode:1) FromNode(TableNameNode:t)) " +
+				"SelectNode(ColumnListNode(BinaryOperationNode(Left(IdentifierNode:n) Operator:+ Right(NumberLiteralNode:1))) FromNode(TableNameNode:r)))))) " +
+				"ColumnListNode(IdentifierNode:n) FromNode(TableNameNode:r))",
+		},
+		{
+			"SELECT ROW_NUMBER() OVER (PARTITION BY a ORDER BY b), SUM(c) OVER (ROWS BETWEEN 1 PRECEDING AND CURRENT ROW), LAG(c) OVER (ROWS UNBOUNDED PRECEDING) FROM t",
+			"SelectNode(ColumnListNode(WindowFunctionNode:row_number(WindowNode(PartitionByNode(IdentifierNode:a) OrderByNode(OrderItemNode:ASC(IdentifierNode:b)))) " +
+				"WindowFunctionNode:sum(IdentifierNode:c WindowNode(FrameNode:ROWS(FrameBoundNode:PRECEDING(NumberLiteralNode:1) FrameBoundNode:CURRENT ROW))) " +
+				"WindowFunctionNode:lag(IdentifierNode:c WindowNode(FrameNode:ROWS(FrameBoundNode:UNBOUNDED PRECEDING FrameBoundNode:CURRENT ROW)))) FromNode(TableNameNode:t))",
+		},
+		{
+			"CREATE TABLE t (a INT, b VARCHAR(20))",
+			"CreateTableNode(TableNameNode:t ColumnListNode(ColumnDefNode(IdentifierNode:a DataTypeNode:INT) ColumnDefNode(IdentifierNode:b DataTypeNode:VARCHAR ValueNode:20)))",
+		},
+		{
+			"INSERT INTO t (a, b) VALUES (1, 'x'), (2 + 3, DEFAULT)",
+			"InsertNode(TableNameNode:t ColumnListNode(IdentifierNode:a IdentifierNode:b) ValuesListNode(NumberLiteralNode:1 StringLiteralNode:x) " +
+				"ValuesListNode(BinaryOperationNode(Left(NumberLiteralNode:2) Operator:+ Right(NumberLiteralNode:3)) DefaultNode))",
+		},
+		{
+			"WITH s AS (SELECT a FROM u) INSERT INTO t SELECT a FROM s",
+			"InsertNode(WithNode(CommonTableNode:s(SelectNode(ColumnListNode(IdentifierNode:a) FromNode(TableNameNode:u)))) TableNameNode:t " +
+				"SelectNode(ColumnListNode(IdentifierNode:a) FromNode(TableNameNode:s)))",
+		},
+		{
+			"UPDATE t SET a = a + 1, b = DEFAULT WHERE a > 1",
+			"UpdateNode(TableNameNode:t SetListNode(AssignmentNode:a(BinaryOperationNode(Left(IdentifierNode:a) Operator:+ Right(NumberLiteralNode:1))) AssignmentNode:b(DefaultNode)) " +
+				"WhereNode(BinaryOperationNode(Left(IdentifierNode:a) Operator:> Right(NumberLiteralNode:1))))",
+		},
+	}
+
+	for _, test := range tests {
+		cst, err := ParseTokensToCST(tokenize(t, test.query))
+		if err != nil {
+			t.Errorf("ParseTokensToCST(%q) failed: %v", test.query, err)
+			continue
+		}
+		ast, err := ConvertToAST(cst)
+		if err != nil {
+			t.Errorf("ConvertToAST(%q) failed: %v", test.query, err)
+			continue
+		}
+		if got := render(ast); got != test.want {
+			t.Errorf("ConvertToAST(%q) =\n  %s\nwant\n  %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestConvertToASTLeavesParseTreeAlone(t *testing.T) {
+	cst, err := ParseTokensToCST(tokenize(t, "SELECT a FROM t WHERE a > 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := render(cst)
+
+	if _, err := ConvertToAST(cst); err != nil {
+		t.Fatal(err)
+	}
+	if after := render(cst); after != before {
+		t.Errorf("ConvertToAST changed the parse tree:\n  %s\nbecame\n  %s", before, after)
+	}
+}
+
+func TestConvertToASTKeepsNumberValues(t *testing.T) {
+	cst, err := ParseTokensToCST(tokenize(t, "SELECT -5, 2.5, -0x10, -9223372036854775808, - -1 FROM t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, err := ConvertToAST(cst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns := ast.Children[0]
+	want := []any{ int64(-5), 2.5, int64(-16), int64(math.MinInt64) }
+	for i, value := range want {
+		if number := columns.Children[i]; number.Value != value {
+			t.Errorf("%s has value %#v, want %#v", number.Data, number.Value, value)
+		}
+	}
+}
@@ -1,360 +1,1982 @@
 package parser
 
 import (
-	"errors"
-	"fmt"
+	"strings"
 
 	"github.com/jasutiin/deebeejeebees/internal/parser/narytree"
+	"github.com/jasutiin/deebeejeebees/internal/tokens"
 )
 
 type Parser struct {
-	tokens []string
-	pos int
+	tokens []tokens.Token
+	pos int // position of the last token that was consumed, -1 before the first one
 	rootNode *narytree.Node
 }
 
-func ParseTokensToCST(tokens []string) narytree.Node {
+// ParseTokensToCST parses a single statement into a parse tree. If the tokens don't form a valid statement
+// it returns an empty node and a *SyntaxError describing the first problem it found. Use ParseScript for
+// more than one statement.
+func ParseTokensToCST(tokenList []tokens.Token) (narytree.Node, error) {
 	rootNode := narytree.Node{ Data: "<query>", Children: []narytree.Node{} }
-	parser := Parser{ tokens: tokens, pos: 0, rootNode: &rootNode }
-	queryType := tokens[parser.pos]
+	parser := Parser{ tokens: tokenList, pos: -1, rootNode: &rootNode }
 
-	switch queryType {
-		case "SELECT":
-			err := parser.parseSelectCST() // parsing select statements
+	if err := parser.parseStatementCST(); err != nil {
+		return narytree.Node{}, err
+	}
+
+	if next := parser.peek(); next.Kind != tokens.EOF {
+		return narytree.Node{}, parser.errorAtNext("end of input")
+	}
+
+	return rootNode, nil
+}
+
+// ParseScript parses every statement in the tokens, like the contents of a .sql file, and returns one parse
+// tree per statement. Empty statements (';;') are skipped and the last statement doesn't need a ';'.
+// After a syntax error the parser skips ahead to the next statement and carries on, so the returned
+// ErrorList holds every problem in the script rather than just the first. Trees are only returned when
+// there are no errors.
+func ParseScript(tokenList []tokens.Token) ([]narytree.Node, error) {
+	statements, errs := parseStatements(tokenList)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return statements, nil
+}
+
+// CheckSyntax parses a script only to find its syntax errors, which is what editors need to list every
+// problem in a file in one pass. It returns nil when there are none.
+func CheckSyntax(tokenList []tokens.Token) ErrorList {
+	_, errs := parseStatements(tokenList)
+	return errs
+}
+
+func parseStatements(tokenList []tokens.Token) ([]narytree.Node, ErrorList) {
+	parser := Parser{ tokens: tokenList, pos: -1 }
+	var statements []narytree.Node
+	var errs ErrorList
+
+	for parser.peek().Kind != tokens.EOF {
+		if parser.peek().Is(";") { // empty statement
+			parser.incrementPosition()
+			continue
+		}
+
+		rootNode := narytree.Node{ Data: "<query>", Children: []narytree.Node{} }
+		parser.rootNode = &rootNode
+
+		statementStart := parser.pos + 1
+		if err := parser.parseStatementCST(); err != nil {
+			errs = append(errs, err.(*SyntaxError)) // the parser only ever fails with a *SyntaxError
+			parser.synchronize(statementStart)
+			continue
+		}
+
+		statements = append(statements, rootNode)
+	}
+
+	return statements, errs
+}
+
+// statementKeywords are the keywords parseStatementCST knows how to start a statement with. Error recovery
+// stops in front of them; stopping at a keyword the parser doesn't support would only report the same
+// token a second time.
+var statementKeywords = []string{ "WITH", "SELECT", "INSERT", "UPDATE", "CREATE" }
+
+// synchronize skips the rest of a statement that failed to parse. It stops after the next ';' or in front
+// of the next keyword that starts a statement, whichever comes first. Keywords inside parentheses belong to
+// a subquery of the failed statement, so they don't count. statementStart is the index of the first token
+// of the failed statement; that token is always skipped so that a statement the parser doesn't understand
+// at all can't make it loop forever.
+func (p *Parser) synchronize(statementStart int) {
+	depth := 0
+	for i := statementStart; i <= p.pos; i++ {
+		depth += parenthesisDepthChange(p.tokens[i])
+	}
+
+	for {
+		nextToken := p.peek()
+		if nextToken.Kind == tokens.EOF {
+			return
+		}
+
+		if nextToken.Is(";") {
+			p.incrementPosition()
+			return
+		}
+
+		if p.pos >= statementStart && depth <= 0 {
+			for _, keyword := range statementKeywords {
+				if nextToken.Is(keyword) {
+					return
+				}
+			}
+		}
+
+		depth += parenthesisDepthChange(nextToken)
+		p.incrementPosition()
+	}
+}
+
+// parenthesisDepthChange is 1 for '(', -1 for ')' and 0 for any other token.
+func parenthesisDepthChange(token tokens.Token) int {
+	switch {
+		case token.Is("("):
+			return 1
+		case token.Is(")"):
+			return -1
+	}
+	return 0
+}
+
+// parseStatementCST looks at the first keyword to decide what kind of statement follows.
+func (p *Parser) parseStatementCST() error {
+	queryType := p.peek()
+
+	// the statement after a WITH clause parses the clause along with the rest of it
+	if queryType.Is("WITH") {
+		statement := p.statementAfterWith()
+		switch {
+			case statement.Is("INSERT"):
+				return p.parseInsertCST()
+			case statement.Is("UPDATE"):
+				return p.parseUpdateCST()
+			default:
+				return p.parseSelectCST()
+		}
+	}
+
+	switch {
+		case queryType.Is("SELECT") || queryType.Is("("):
+			return p.parseSelectCST() // parsing select statements
+		case queryType.Is("INSERT"):
+			return p.parseInsertCST() // parsing insert statements
+		case queryType.Is("UPDATE"):
+			return p.parseUpdateCST() // parsing update statements
+		case queryType.Is("CREATE"):
+			return p.parseCreateCST() // parsing create statements
+		default:
+			return p.errorAtNext("'SELECT'", "'INSERT'", "'UPDATE'", "'CREATE'", "'WITH'")
+	}
+}
+
+// statementAfterWith looks past the WITH clause at the start of a statement, without consuming anything,
+// and returns the first token after it that isn't inside parentheses.
+func (p *Parser) statementAfterWith() tokens.Token {
+	depth := 0
+	for offset := 2; ; offset++ {
+		nextToken := p.peekAt(offset)
+		switch {
+			case nextToken.Kind == tokens.EOF:
+				return nextToken
+			case nextToken.Is("("):
+				depth++
+			case nextToken.Is(")"):
+				depth--
+			case depth == 0 && !nextToken.Is(",") && !nextToken.Is("AS") && nextToken.Kind != tokens.IDENTIFIER:
+				return nextToken
+		}
+	}
+}
+
+// parseSelect is responsible for parsing the SELECT query type
+func (p *Parser) parseSelectCST() error {
+	selectStatementNode, err := p.parseSelectStatementCST()
+	if err != nil {
+		return err
+	}
+
+	semicolonNode, err := p.parseSemicolonCST()
+	if err != nil {
+		return err
+	}
+
+	for _, clause := range selectStatementNode.Children {
+		p.rootNode.AddChild(clause)
+	}
+	if semicolonNode.Data != "" { // the last statement of a script may leave out the ';'
+		p.rootNode.AddChild(semicolonNode)
+	}
+	return nil
+}
+
+// parseSelectStatementCST parses a query without the ';' after it, so that it can also be used inside
+// another statement. ORDER BY, LIMIT and OFFSET after a set operation apply to its whole result.
+// <select_statement> := <optional_with> <query_expression> <optional_order_by> <optional_limit> <optional_offset>
+func (p *Parser) parseSelectStatementCST() (narytree.Node, error) {
+	selectStatementNode := narytree.Node{ Data: "<select_statement>", Children: []narytree.Node{} }
+
+	optionalWithNode, err := p.parseOptionalWithCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	selectStatementNode.AddChild(optionalWithNode)
+
+	queryNode, err := p.parseQueryExpressionCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	if queryNode.Data == "<select_core>" {
+		for _, clause := range queryNode.Children {
+			selectStatementNode.AddChild(clause)
+		}
+	} else {
+		selectStatementNode.AddChild(queryNode)
+	}
+
+	optionalOrderByNode, err := p.parseOptionalOrderByCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	optionalLimitNode, err := p.parseOptionalLimitCST("LIMIT")
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	optionalOffsetNode, err := p.parseOptionalLimitCST("OFFSET")
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	selectStatementNode.AddChild(optionalOrderByNode)
+	selectStatementNode.AddChild(optionalLimitNode)
+	selectStatementNode.AddChild(optionalOffsetNode)
+	return selectStatementNode, nil
+}
+
+// parseOptionalWithCST parses the queries that a statement names in front of it, which the statement can
+// then read like tables: 'WITH big AS (SELECT ...) SELECT * FROM big'. With RECURSIVE a query can also
+// read its own rows.
+// <optional_with>           := [WITH [RECURSIVE] <common_table_expression> { , <common_table_expression> }]
+// <common_table_expression> := identifier [( identifier { , identifier } )] AS <subquery>
+func (p *Parser) parseOptionalWithCST() (narytree.Node, error) {
+	optionalWithNode := narytree.Node{ Data: "<optional_with>", Children: []narytree.Node{} }
+
+	if !p.peek().Is("WITH") {
+		return optionalWithNode, nil
+	}
+
+	p.incrementPosition()
+	optionalWithNode.AddChild(p.terminalNode())
+
+	if p.peekContextualKeyword("RECURSIVE") {
+		p.incrementPosition()
+		optionalWithNode.AddChild(p.contextualKeywordNode())
+	}
+
+	for {
+		commonTableNode, err := p.parseCommonTableExpressionCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		optionalWithNode.AddChild(commonTableNode)
+
+		if !p.peek().Is(",") {
+			break
+		}
+		p.incrementPosition()
+		optionalWithNode.AddChild(p.terminalNode())
+	}
+
+	return optionalWithNode, nil
+}
+
+func (p *Parser) parseCommonTableExpressionCST() (narytree.Node, error) {
+	commonTableNode := narytree.Node{ Data: "<common_table_expression>", Children: []narytree.Node{} }
+
+	nameNode, err := p.expectKindNamed("query name", tokens.IDENTIFIER)
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	commonTableNode.AddChild(nameNode)
+
+	if p.peek().Is("(") {
+		p.incrementPosition()
+		commonTableNode.AddChild(p.terminalNode())
+
+		for {
+			columnName, err := p.expectKindNamed("column name", tokens.IDENTIFIER)
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			commonTableNode.AddChild(columnName)
+
+			if !p.peek().Is(",") {
+				break
+			}
+			p.incrementPosition()
+			commonTableNode.AddChild(p.terminalNode())
+		}
+
+		closeParenNode, err := p.parseCloseParenCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		commonTableNode.AddChild(closeParenNode)
+	}
+
+	asNode, err := p.expect("AS")
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	commonTableNode.AddChild(asNode)
+
+	subqueryNode, err := p.parseSubqueryCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	commonTableNode.AddChild(subqueryNode)
+
+	return commonTableNode, nil
+}
+
+// parseQueryExpressionCST parses queries combined with UNION, INTERSECT and EXCEPT. INTERSECT binds more
+// tightly than the other two, and operators of the same precedence are left associative.
+// <query_expression> := <query_term> { (UNION | EXCEPT) [ALL | DISTINCT] <query_term> }
+// <query_term>       := <query_primary> { INTERSECT [ALL | DISTINCT] <query_primary> }
+// <query_primary>    := <select_core> | <subquery>
+func (p *Parser) parseQueryExpressionCST() (narytree.Node, error) {
+	left, err := p.parseQueryTermCST(p.parseQueryPrimaryCST)
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	for p.peek().Is("UNION") || p.peek().Is("EXCEPT") {
+		left, err = p.parseSetOperationCST(left, func() (narytree.Node, error) {
+			return p.parseQueryTermCST(p.parseQueryPrimaryCST)
+		})
+		if err != nil {
+			return narytree.Node{}, err
+		}
+	}
+
+	// a query in parentheses has to be combined with another one, '(SELECT ...)' on its own isn't a query
+	if left.Data == "<subquery>" {
+		return narytree.Node{}, p.errorAtNext("'UNION'", "'INTERSECT'", "'EXCEPT'")
+	}
+
+	return left, nil
+}
+
+// parseQueryTermCST parses queries combined with INTERSECT. parseFirst parses the first of them.
+func (p *Parser) parseQueryTermCST(parseFirst func() (narytree.Node, error)) (narytree.Node, error) {
+	left, err := parseFirst()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	for p.peek().Is("INTERSECT") {
+		left, err = p.parseSetOperationCST(left, p.parseQueryPrimaryCST)
+		if err != nil {
+			return narytree.Node{}, err
+		}
+	}
+
+	return left, nil
+}
+
+// parseSetOperationCST parses a set operator and the query on its right, after the query on its left has
+// been parsed.
+// <set_operation> := query (UNION | INTERSECT | EXCEPT) [ALL | DISTINCT] query
+func (p *Parser) parseSetOperationCST(left narytree.Node, parseRight func() (narytree.Node, error)) (narytree.Node, error) {
+	setOperationNode := narytree.Node{ Data: "<set_operation>", Children: []narytree.Node{} }
+	setOperationNode.AddChild(left)
+
+	p.incrementPosition()
+	setOperationNode.AddChild(p.terminalNode())
+
+	if p.peek().Is("ALL") || p.peek().Is("DISTINCT") {
+		p.incrementPosition()
+		setOperationNode.AddChild(p.terminalNode())
+	}
+
+	right, err := parseRight()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	setOperationNode.AddChild(right)
+
+	return setOperationNode, nil
+}
+
+// parseQueryPrimaryCST parses a query that a set operator combines. A query in parentheses can have its
+// own ORDER BY and LIMIT.
+func (p *Parser) parseQueryPrimaryCST() (narytree.Node, error) {
+	if p.peek().Is("(") {
+		return p.parseSubqueryCST()
+	}
+	if !p.peek().Is("SELECT") {
+		return narytree.Node{}, p.errorAtNext("'SELECT'", "'('")
+	}
+	return p.parseSelectCoreCST()
+}
+
+// parseSelectCoreCST parses a single query block, everything from SELECT up to HAVING.
+// SELECT [DISTINCT [ON (expression, ...)]] expression [AS alias], ... FROM table_name [AS alias], ... WHERE expression GROUP BY expression, ...
+// HAVING expression
+func (p *Parser) parseSelectCoreCST() (narytree.Node, error) {
+	selectCoreNode := narytree.Node{ Data: "<select_core>", Children: []narytree.Node{} }
+
+	selectNode, err := p.expect("SELECT")
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	optionalDistinctNode, err := p.parseOptionalDistinctCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	colListNode, err := p.parseSelectListCST() // should return a whole branch
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	fromNode, err := p.parseFromNodeCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	fromListNode, err := p.parseFromListCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	optionalWhereNode, err := p.parseOptionalWhereCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	optionalGroupByNode, err := p.parseOptionalGroupByCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	optionalHavingNode, err := p.parseOptionalHavingCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	selectCoreNode.AddChild(selectNode)
+	selectCoreNode.AddChild(optionalDistinctNode)
+	selectCoreNode.AddChild(colListNode)
+	selectCoreNode.AddChild(fromNode)
+	selectCoreNode.AddChild(fromListNode)
+	selectCoreNode.AddChild(optionalWhereNode)
+	selectCoreNode.AddChild(optionalGroupByNode)
+	selectCoreNode.AddChild(optionalHavingNode)
+	return selectCoreNode, nil
+}
+
+// parseSelectListCST parses the items of a select list.
+// <select_list> := <select_item> { , <select_item> }
+func (p *Parser) parseSelectListCST() (narytree.Node, error) {
+	nextToken := p.peek()
+
+	if nextToken.Is("FROM") {
+		return narytree.Node{}, p.syntaxError(nextToken, "missing at least one column name after SELECT")
+	}
+
+	selectListNode := narytree.Node{ Data: "<select_list>", Children: []narytree.Node{} }
+
+	for {
+		selectItem, err := p.parseSelectItemCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		selectListNode.AddChild(selectItem)
+
+		if !p.peek().Is(",") {
+			break
+		}
+		p.incrementPosition()
+		selectListNode.AddChild(p.terminalNode())
+	}
+
+	return selectListNode, nil
+}
+
+// parseSelectItemCST parses a single item of the select list: '*' for every column, 't.*' for every column
+// of one table, or an expression that can be given a name with an alias.
+// <select_item> := <all_columns> | expression [<alias>]
+// <all_columns> := [identifier .] *
+// <alias>       := [AS] identifier
+func (p *Parser) parseSelectItemCST() (narytree.Node, error) {
+	selectItemNode := narytree.Node{ Data: "<select_item>", Children: []narytree.Node{} }
+	nextToken := p.peek()
+
+	if nextToken.Is("*") || (nextToken.Kind == tokens.IDENTIFIER && p.peekAt(2).Is(".") && p.peekAt(3).Is("*")) {
+		allColumnsNode := narytree.Node{ Data: "<all_columns>", Children: []narytree.Node{} }
+		for !p.peek().Is("*") {
+			p.incrementPosition()
+			allColumnsNode.AddChild(p.terminalNode())
+		}
+		p.incrementPosition()
+		allColumnsNode.AddChild(p.terminalNode())
+
+		selectItemNode.AddChild(allColumnsNode)
+		return selectItemNode, nil
+	}
+
+	expression, err := p.parseExpressionCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	selectItemNode.AddChild(expression)
+
+	if p.peek().Is("AS") || p.peek().Kind == tokens.IDENTIFIER {
+		aliasNode, err := p.parseAliasCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		selectItemNode.AddChild(aliasNode)
+	}
+
+	return selectItemNode, nil
+}
+
+// parseAliasCST parses the name given to a select item or a table. The AS is optional, 'SELECT a + 1 total'
+// works too.
+func (p *Parser) parseAliasCST() (narytree.Node, error) {
+	aliasNode := narytree.Node{ Data: "<alias>", Children: []narytree.Node{} }
+
+	if p.peek().Is("AS") {
+		p.incrementPosition()
+		aliasNode.AddChild(p.terminalNode())
+	}
+
+	name, err := p.expectKindNamed("alias", tokens.IDENTIFIER)
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	aliasNode.AddChild(name)
+
+	return aliasNode, nil
+}
+
+func (p *Parser) parseColumnNameCST() (narytree.Node, error) {
+	columnNameNonTerminal := narytree.Node{ Data: "<column_name>", Children: []narytree.Node{} }
+	columnName, err := p.expectIdentifier()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	columnNameNonTerminal.Children = append(columnNameNonTerminal.Children, columnName)
+	return columnNameNonTerminal, nil
+}
+
+func (p *Parser) parseFromNodeCST() (narytree.Node, error) {
+	if !p.peek().Is("FROM") {
+		return narytree.Node{}, p.errorAtNext("','", "'FROM'")
+	}
+	return p.expect("FROM")
+}
+
+// parseFromListCST parses the tables a query reads from. Listing more than one table combines every row of
+// one with every row of the others.
+// <from_list> := <table_expression> { , <table_expression> }
+func (p *Parser) parseFromListCST() (narytree.Node, error) {
+	fromListNode := narytree.Node{ Data: "<from_list>", Children: []narytree.Node{} }
+
+	for {
+		tableReference, err := p.parseTableExpressionCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		fromListNode.AddChild(tableReference)
+
+		if !p.peek().Is(",") {
+			break
+		}
+		p.incrementPosition()
+		fromListNode.AddChild(p.terminalNode())
+	}
+
+	return fromListNode, nil
+}
+
+// parseTableExpressionCST parses a table followed by any number of joins. Joins are left associative, so
+// 'a JOIN b ON ... JOIN c ON ...' joins c to the result of joining a and b.
+// <table_expression> := <table_reference> { <join> }
+// <join>             := <join_type> JOIN <table_reference> <join_condition>
+//                     | CROSS JOIN <table_reference>
+// <join_type>        := [INNER] | LEFT [OUTER] | RIGHT [OUTER] | FULL [OUTER]
+func (p *Parser) parseTableExpressionCST() (narytree.Node, error) {
+	left, err := p.parseTableReferenceCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	for p.peekJoin() {
+		joinNode := narytree.Node{ Data: "<join>", Children: []narytree.Node{} }
+		joinNode.AddChild(left)
+
+		cross := p.peek().Is("CROSS")
+		for !p.peek().Is("JOIN") {
+			p.incrementPosition()
+			joinNode.AddChild(p.terminalNode())
+		}
+		p.incrementPosition()
+		joinNode.AddChild(p.terminalNode())
+
+		right, err := p.parseTableReferenceCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		joinNode.AddChild(right)
+
+		if !cross {
+			joinConditionNode, err := p.parseJoinConditionCST()
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			joinNode.AddChild(joinConditionNode)
+		}
+
+		left = joinNode
+	}
+
+	return left, nil
+}
+
+// peekJoin reports whether a join starts at the next token.
+func (p *Parser) peekJoin() bool {
+	nextToken := p.peek()
+	switch {
+		case nextToken.Is("JOIN"):
+			return true
+		case nextToken.Is("INNER"), nextToken.Is("CROSS"):
+			return p.peekAt(2).Is("JOIN")
+		case nextToken.Is("LEFT"), nextToken.Is("RIGHT"), nextToken.Is("FULL"):
+			return p.peekAt(2).Is("JOIN") || (p.peekAt(2).Is("OUTER") && p.peekAt(3).Is("JOIN"))
+	}
+	return false
+}
+
+// parseJoinConditionCST parses how the rows of a join are matched up: with a condition, or by a list of
+// columns both sides have that need to be equal.
+// <join_condition> := ON expression | USING ( identifier { , identifier } )
+func (p *Parser) parseJoinConditionCST() (narytree.Node, error) {
+	joinConditionNode := narytree.Node{ Data: "<join_condition>", Children: []narytree.Node{} }
+
+	keywordNode, err := p.expect("ON", "USING")
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	joinConditionNode.AddChild(keywordNode)
+
+	if keywordNode.Data == "ON" {
+		condition, err := p.parseExpressionCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		joinConditionNode.AddChild(condition)
+		return joinConditionNode, nil
+	}
+
+	openParenNode, err := p.parseOpenParenCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	joinConditionNode.AddChild(openParenNode)
+
+	for {
+		columnName, err := p.expectKindNamed("column name", tokens.IDENTIFIER)
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		joinConditionNode.AddChild(columnName)
+
+		if !p.peek().Is(",") {
+			break
+		}
+		p.incrementPosition()
+		joinConditionNode.AddChild(p.terminalNode())
+	}
+
+	closeParenNode, err := p.parseCloseParenCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	joinConditionNode.AddChild(closeParenNode)
+
+	return joinConditionNode, nil
+}
+
+// parseTableReferenceCST parses a table of the FROM clause, which can be given another name for the rest
+// of the query with an alias: 'FROM users AS u' or 'FROM users u'. A subquery can stand in for a table,
+// in which case it needs an alias: 'FROM (SELECT ...) AS t'.
+// <table_reference> := <table_name> [<alias>] | <subquery> <alias>
+func (p *Parser) parseTableReferenceCST() (narytree.Node, error) {
+	tableReferenceNode := narytree.Node{ Data: "<table_reference>", Children: []narytree.Node{} }
+
+	if p.peek().Is("(") {
+		subqueryNode, err := p.parseSubqueryCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		tableReferenceNode.AddChild(subqueryNode)
+
+		if !p.peek().Is("AS") && p.peek().Kind != tokens.IDENTIFIER {
+			return narytree.Node{}, p.syntaxError(p.peek(), "a subquery in FROM must have an alias")
+		}
+		aliasNode, err := p.parseAliasCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		tableReferenceNode.AddChild(aliasNode)
+		return tableReferenceNode, nil
+	}
+
+	tableNameNode, err := p.parseTableNameCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	tableReferenceNode.AddChild(tableNameNode)
+
+	if p.peek().Is("AS") || p.peek().Kind == tokens.IDENTIFIER {
+		aliasNode, err := p.parseAliasCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		tableReferenceNode.AddChild(aliasNode)
+	}
+
+	return tableReferenceNode, nil
+}
+
+func (p *Parser) parseTableNameCST() (narytree.Node, error) {
+	tableNameNoneTerminal := narytree.Node{ Data: "<table_name>", Children: []narytree.Node{} }
+	tableNameNode, err := p.expectIdentifier()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	tableNameNoneTerminal.AddChild(tableNameNode)
+	return tableNameNoneTerminal, nil
+}
+
+func (p *Parser) parseOptionalWhereCST() (narytree.Node, error) {
+	optionalWhereNode := narytree.Node{ Data: "<optional_where>", Children: []narytree.Node{} }
+	
+	nextToken := p.peek()
+	if !nextToken.Is("WHERE") {
+		return optionalWhereNode, nil
+	}
+	
+	p.incrementPosition()
+	whereNode := p.terminalNode()
+	optionalWhereNode.AddChild(whereNode)
+	
+	conditionNode, err := p.parseExpressionCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	optionalWhereNode.AddChild(conditionNode)
+	
+	return optionalWhereNode, nil
+}
+
+// parseOptionalDistinctCST parses DISTINCT, which removes duplicate rows from the result. DISTINCT ON only
+// compares the listed expressions and keeps the first row of each set of rows that are equal on them.
+// <optional_distinct> := [DISTINCT [ON ( expression { , expression } )]]
+func (p *Parser) parseOptionalDistinctCST() (narytree.Node, error) {
+	optionalDistinctNode := narytree.Node{ Data: "<optional_distinct>", Children: []narytree.Node{} }
+
+	if !p.peek().Is("DISTINCT") {
+		return optionalDistinctNode, nil
+	}
+
+	p.incrementPosition()
+	optionalDistinctNode.AddChild(p.terminalNode())
+
+	if !p.peek().Is("ON") {
+		return optionalDistinctNode, nil
+	}
+
+	p.incrementPosition()
+	optionalDistinctNode.AddChild(p.terminalNode())
+
+	openParenNode, err := p.parseOpenParenCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	optionalDistinctNode.AddChild(openParenNode)
+
+	for {
+		expression, err := p.parseExpressionCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		optionalDistinctNode.AddChild(expression)
 
+		if !p.peek().Is(",") {
+			break
+		}
+		p.incrementPosition()
+		optionalDistinctNode.AddChild(p.terminalNode())
+	}
+
+	closeParenNode, err := p.parseCloseParenCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	optionalDistinctNode.AddChild(closeParenNode)
+
+	return optionalDistinctNode, nil
+}
+
+// parseOptionalGroupByCST parses the expressions rows are grouped by.
+// <optional_group_by> := [GROUP BY expression { , expression }]
+func (p *Parser) parseOptionalGroupByCST() (narytree.Node, error) {
+	optionalGroupByNode := narytree.Node{ Data: "<optional_group_by>", Children: []narytree.Node{} }
+
+	if !p.peek().Is("GROUP") {
+		return optionalGroupByNode, nil
+	}
+
+	p.incrementPosition()
+	optionalGroupByNode.AddChild(p.terminalNode())
+
+	byNode, err := p.expect("BY")
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	optionalGroupByNode.AddChild(byNode)
+
+	for {
+		expression, err := p.parseExpressionCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		optionalGroupByNode.AddChild(expression)
+
+		if !p.peek().Is(",") {
+			break
+		}
+		p.incrementPosition()
+		optionalGroupByNode.AddChild(p.terminalNode())
+	}
+
+	return optionalGroupByNode, nil
+}
+
+// parseOptionalHavingCST parses the condition groups have to pass.
+// <optional_having> := [HAVING expression]
+func (p *Parser) parseOptionalHavingCST() (narytree.Node, error) {
+	optionalHavingNode := narytree.Node{ Data: "<optional_having>", Children: []narytree.Node{} }
+
+	if !p.peek().Is("HAVING") {
+		return optionalHavingNode, nil
+	}
+
+	p.incrementPosition()
+	optionalHavingNode.AddChild(p.terminalNode())
+
+	conditionNode, err := p.parseExpressionCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	optionalHavingNode.AddChild(conditionNode)
+
+	return optionalHavingNode, nil
+}
+
+// parseOptionalOrderByCST parses the order the rows of the result are sorted in.
+// <optional_order_by> := [ORDER BY <order_item> { , <order_item> }]
+// <order_item>        := expression [ASC | DESC] [NULLS FIRST | NULLS LAST]
+func (p *Parser) parseOptionalOrderByCST() (narytree.Node, error) {
+	optionalOrderByNode := narytree.Node{ Data: "<optional_order_by>", Children: []narytree.Node{} }
+
+	if !p.peek().Is("ORDER") {
+		return optionalOrderByNode, nil
+	}
+
+	p.incrementPosition()
+	optionalOrderByNode.AddChild(p.terminalNode())
+
+	byNode, err := p.expect("BY")
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	optionalOrderByNode.AddChild(byNode)
+
+	for {
+		orderItemNode := narytree.Node{ Data: "<order_item>", Children: []narytree.Node{} }
+
+		expression, err := p.parseExpressionCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		orderItemNode.AddChild(expression)
+
+		if p.peek().Is("ASC") || p.peek().Is("DESC") {
+			p.incrementPosition()
+			orderItemNode.AddChild(p.terminalNode())
+		}
+
+		if p.peekContextualKeyword("NULLS") {
+			p.incrementPosition()
+			orderItemNode.AddChild(p.contextualKeywordNode())
+
+			if !p.peekContextualKeyword("FIRST") && !p.peekContextualKeyword("LAST") {
+				return narytree.Node{}, p.errorAtNext("'FIRST'", "'LAST'")
+			}
+			p.incrementPosition()
+			orderItemNode.AddChild(p.contextualKeywordNode())
+		}
+
+		optionalOrderByNode.AddChild(orderItemNode)
+
+		if !p.peek().Is(",") {
+			break
+		}
+		p.incrementPosition()
+		optionalOrderByNode.AddChild(p.terminalNode())
+	}
+
+	return optionalOrderByNode, nil
+}
+
+// parseOptionalLimitCST parses LIMIT or OFFSET, whichever keyword is given, followed by the number of rows.
+// The number can be any expression that doesn't refer to columns, usually a number or a parameter.
+// <optional_limit>  := [LIMIT expression]
+// <optional_offset> := [OFFSET expression]
+func (p *Parser) parseOptionalLimitCST(keyword string) (narytree.Node, error) {
+	optionalLimitNode := narytree.Node{ Data: "<optional_" + strings.ToLower(keyword) + ">", Children: []narytree.Node{} }
+
+	if !p.peek().Is(keyword) {
+		return optionalLimitNode, nil
+	}
+
+	p.incrementPosition()
+	optionalLimitNode.AddChild(p.terminalNode())
+
+	count, err := p.parseExpressionCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	optionalLimitNode.AddChild(count)
+
+	return optionalLimitNode, nil
+}
+
+// binaryPrecedence says how tightly each binary operator binds, higher numbers binding tighter. NOT sits
+// between AND and the comparisons, and unary '-' and '+' bind tighter than everything.
+var binaryPrecedence = map[string]int{
+	"OR":  1,
+	"AND": 2,
+	"=":   4,
+	"!=":  4,
+	"<>":  4,
+	"<":   4,
+	">":   4,
+	"<=":  4,
+	">=":  4,
+	"+":   5,
+	"-":   5,
+	"*":   6,
+	"/":   6,
+}
+
+const (
+	notPrecedence        = 3
+	comparisonPrecedence = 4
+	unaryPrecedence      = 7
+)
+
+// parseExpressionCST parses a full expression like 'a = 1 AND (b + 1) * 2 > c' using precedence climbing.
+// Operators of the same precedence are left associative, so 'a - b - c' is '(a - b) - c'.
+// <expression> := <operand> { binary_operator <operand> }
+func (p *Parser) parseExpressionCST() (narytree.Node, error) {
+	return p.parseBinaryExpressionCST(1)
+}
+
+// parseBinaryExpressionCST parses an expression made of operators that bind at least as tightly as
+// minPrecedence. Each operator found becomes a <binary_expression> holding the left side, the operator
+// and the right side.
+func (p *Parser) parseBinaryExpressionCST(minPrecedence int) (narytree.Node, error) {
+	left, err := p.parsePrefixExpressionCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+
+	for {
+		if minPrecedence <= comparisonPrecedence && p.peekPredicate() {
+			left, err = p.parsePredicateCST(left)
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			continue
+		}
+
+		operatorToken := p.peek()
+		precedence, ok := binaryPrecedence[operatorToken.Value]
+		if !ok || !operatorToken.Is(operatorToken.Value) || precedence < minPrecedence { // Is rules out a quoted "AND"
+			return left, nil
+		}
+
+		p.incrementPosition()
+		operatorNode := p.terminalNode()
+
+		if precedence == comparisonPrecedence && (p.peek().Is("ANY") || p.peek().Is("ALL")) {
+			left, err = p.parseQuantifiedComparisonCST(left, operatorNode)
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			continue
+		}
+
+		right, err := p.parseBinaryExpressionCST(precedence + 1)
+		if err != nil {
+			return narytree.Node{}, err
+		}
+
+		binaryNode := narytree.Node{ Data: "<binary_expression>", Children: []narytree.Node{} }
+		binaryNode.AddChild(left)
+		binaryNode.AddChild(operatorNode)
+		binaryNode.AddChild(right)
+		left = binaryNode
+	}
+}
+
+// parseQuantifiedComparisonCST parses a comparison with every row of a subquery, after the left side and
+// the operator have been parsed. With ANY it is true if the comparison is true for any row, with ALL if it
+// is true for all of them.
+// <quantified_comparison> := expression comparison_operator (ANY | ALL) <subquery>
+func (p *Parser) parseQuantifiedComparisonCST(left narytree.Node, operatorNode narytree.Node) (narytree.Node, error) {
+	quantifiedNode := narytree.Node{ Data: "<quantified_comparison>", Children: []narytree.Node{} }
+	quantifiedNode.AddChild(left)
+	quantifiedNode.AddChild(operatorNode)
+
+	p.incrementPosition()
+	quantifiedNode.AddChild(p.terminalNode())
+
+	subqueryNode, err := p.parseSubqueryCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	quantifiedNode.AddChild(subqueryNode)
+
+	return quantifiedNode, nil
+}
+
+// atSubquery reports whether the next tokens start a subquery rather than an expression in parentheses: a
+// '(' followed by SELECT or WITH, or by a query in parentheses that a set operator combines with another,
+// as in '((SELECT a FROM t) UNION SELECT b FROM u)'. '((SELECT a FROM t) + 1)' stays an expression.
+func (p *Parser) atSubquery() bool {
+	return p.subqueryAt(1)
+}
+
+func (p *Parser) subqueryAt(offset int) bool {
+	if !p.peekAt(offset).Is("(") {
+		return false
+	}
+	first := p.peekAt(offset + 1)
+	if first.Is("SELECT") || first.Is("WITH") {
+		return true
+	}
+	if !p.subqueryAt(offset + 1) {
+		return false
+	}
+
+	depth := 0
+	for i := offset + 1; ; i++ {
+		nextToken := p.peekAt(i)
+		switch {
+			case nextToken.Kind == tokens.EOF:
+				return false
+			case nextToken.Is("("):
+				depth++
+			case nextToken.Is(")"):
+				depth--
+				if depth == 0 {
+					after := p.peekAt(i + 1)
+					return after.Is("UNION") || after.Is("INTERSECT") || after.Is("EXCEPT")
+				}
+		}
+	}
+}
+
+// parseSubqueryCST parses a query in parentheses that is used inside another statement.
+// <subquery> := ( <select_statement> )
+func (p *Parser) parseSubqueryCST() (narytree.Node, error) {
+	subqueryNode := narytree.Node{ Data: "<subquery>", Children: []narytree.Node{} }
+
+	openParenNode, err := p.expect("(")
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	subqueryNode.AddChild(openParenNode)
+
+	selectStatementNode, err := p.parseSelectStatementCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	subqueryNode.AddChild(selectStatementNode)
+
+	closeParenNode, err := p.parseCloseParenCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	subqueryNode.AddChild(closeParenNode)
+
+	return subqueryNode, nil
+}
+
+// parseFunctionCallCST parses a call to a function like UPPER(name), NOW(), COUNT(*) or COUNT(DISTINCT x).
+// <function_call> := identifier ( [DISTINCT] [* | expression { , expression }] ) [<over_clause>]
+func (p *Parser) parseFunctionCallCST() (narytree.Node, error) {
+	functionCallNode := narytree.Node{ Data: "<function_call>", Children: []narytree.Node{} }
+
+	nameNode, err := p.expectIdentifier()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	functionCallNode.AddChild(nameNode)
+
+	openParenNode, err := p.expect("(")
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	functionCallNode.AddChild(openParenNode)
+
+	if p.peek().Is("DISTINCT") { // COUNT(DISTINCT x)
+		p.incrementPosition()
+		functionCallNode.AddChild(p.terminalNode())
+	}
+
+	if p.peek().Is("*") && p.peekAt(2).Is(")") { // COUNT(*)
+		p.incrementPosition()
+		functionCallNode.AddChild(p.terminalNode())
+	} else if !p.peek().Is(")") {
+		for {
+			argument, err := p.parseExpressionCST()
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			functionCallNode.AddChild(argument)
+
+			if !p.peek().Is(",") {
+				break
+			}
+			p.incrementPosition()
+			functionCallNode.AddChild(p.terminalNode())
+		}
+	}
+
+	closeParenNode, err := p.parseCloseParenCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	functionCallNode.AddChild(closeParenNode)
+
+	if p.peekContextualKeyword("OVER") {
+		overClauseNode, err := p.parseOverClauseCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		functionCallNode.AddChild(overClauseNode)
+	}
+
+	return functionCallNode, nil
+}
+
+// parseOverClauseCST parses the window a function is computed over, which turns the call into a window
+// function: 'SUM(amount) OVER (PARTITION BY user_id ORDER BY id ROWS BETWEEN 2 PRECEDING AND CURRENT ROW)'.
+// OVER and the words of the frame are only keywords here.
+// <over_clause>  := OVER ( [PARTITION BY expression { , expression }] <optional_order_by> [<frame_clause>] )
+// <frame_clause> := ROWS <frame_bound> | ROWS BETWEEN <frame_bound> AND <frame_bound>
+// <frame_bound>  := UNBOUNDED PRECEDING | UNBOUNDED FOLLOWING | CURRENT ROW | expression PRECEDING | expression FOLLOWING
+func (p *Parser) parseOverClauseCST() (narytree.Node, error) {
+	overClauseNode := narytree.Node{ Data: "<over_clause>", Children: []narytree.Node{} }
+
+	p.incrementPosition()
+	overClauseNode.AddChild(p.contextualKeywordNode())
+
+	openParenNode, err := p.parseOpenParenCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	overClauseNode.AddChild(openParenNode)
+
+	if p.peekContextualKeyword("PARTITION") {
+		partitionByNode := narytree.Node{ Data: "<partition_by>", Children: []narytree.Node{} }
+		p.incrementPosition()
+		partitionByNode.AddChild(p.contextualKeywordNode())
+
+		byNode, err := p.expect("BY")
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		partitionByNode.AddChild(byNode)
+
+		for {
+			expression, err := p.parseExpressionCST()
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			partitionByNode.AddChild(expression)
+
+			if !p.peek().Is(",") {
+				break
+			}
+			p.incrementPosition()
+			partitionByNode.AddChild(p.terminalNode())
+		}
+		overClauseNode.AddChild(partitionByNode)
+	}
+
+	optionalOrderByNode, err := p.parseOptionalOrderByCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	overClauseNode.AddChild(optionalOrderByNode)
+
+	if p.peekContextualKeyword("ROWS") {
+		frameClauseNode := narytree.Node{ Data: "<frame_clause>", Children: []narytree.Node{} }
+		p.incrementPosition()
+		frameClauseNode.AddChild(p.contextualKeywordNode())
+
+		between := p.peek().Is("BETWEEN")
+		if between {
+			p.incrementPosition()
+			frameClauseNode.AddChild(p.terminalNode())
+		}
+
+		startNode, err := p.parseFrameBoundCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		frameClauseNode.AddChild(startNode)
+
+		if between {
+			andNode, err := p.expect("AND")
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			frameClauseNode.AddChild(andNode)
+
+			endNode, err := p.parseFrameBoundCST()
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			frameClauseNode.AddChild(endNode)
+		}
+		overClauseNode.AddChild(frameClauseNode)
+	}
+
+	closeParenNode, err := p.parseCloseParenCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	overClauseNode.AddChild(closeParenNode)
+
+	return overClauseNode, nil
+}
+
+func (p *Parser) parseFrameBoundCST() (narytree.Node, error) {
+	frameBoundNode := narytree.Node{ Data: "<frame_bound>", Children: []narytree.Node{} }
+
+	switch {
+		case p.peekContextualKeyword("UNBOUNDED"):
+			p.incrementPosition()
+			frameBoundNode.AddChild(p.contextualKeywordNode())
+
+		case p.peekContextualKeyword("CURRENT"):
+			p.incrementPosition()
+			frameBoundNode.AddChild(p.contextualKeywordNode())
+
+			if !p.peekContextualKeyword("ROW") {
+				return narytree.Node{}, p.errorAtNext("'ROW'")
+			}
+			p.incrementPosition()
+			frameBoundNode.AddChild(p.contextualKeywordNode())
+			return frameBoundNode, nil
+
+		default:
+			offset, err := p.parseExpressionCST()
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			frameBoundNode.AddChild(offset)
+	}
+
+	if !p.peekContextualKeyword("PRECEDING") && !p.peekContextualKeyword("FOLLOWING") {
+		return narytree.Node{}, p.errorAtNext("'PRECEDING'", "'FOLLOWING'")
+	}
+	p.incrementPosition()
+	frameBoundNode.AddChild(p.contextualKeywordNode())
+
+	return frameBoundNode, nil
+}
+
+// parseCaseExpressionCST parses both forms of CASE. The simple form compares an operand against each WHEN
+// value, the searched form has a condition in each WHEN.
+// <case_expression> := CASE [expression] <when_clause> { <when_clause> } [ELSE expression] END
+// <when_clause>     := WHEN expression THEN expression
+func (p *Parser) parseCaseExpressionCST() (narytree.Node, error) {
+	caseNode := narytree.Node{ Data: "<case_expression>", Children: []narytree.Node{} }
+
+	caseKeywordNode, err := p.expect("CASE")
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	caseNode.AddChild(caseKeywordNode)
+
+	if !p.peek().Is("WHEN") {
+		operand, err := p.parseExpressionCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		caseNode.AddChild(operand)
+	}
+
+	for {
+		whenClauseNode := narytree.Node{ Data: "<when_clause>", Children: []narytree.Node{} }
+
+		whenNode, err := p.expect("WHEN")
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		whenClauseNode.AddChild(whenNode)
+
+		condition, err := p.parseExpressionCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		whenClauseNode.AddChild(condition)
+
+		thenNode, err := p.expect("THEN")
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		whenClauseNode.AddChild(thenNode)
+
+		result, err := p.parseExpressionCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		whenClauseNode.AddChild(result)
+
+		caseNode.AddChild(whenClauseNode)
+
+		if !p.peek().Is("WHEN") {
+			break
+		}
+	}
+
+	if p.peek().Is("ELSE") {
+		p.incrementPosition()
+		caseNode.AddChild(p.terminalNode())
+
+		elseResult, err := p.parseExpressionCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		caseNode.AddChild(elseResult)
+	}
+
+	if !p.peek().Is("END") {
+		return narytree.Node{}, p.errorAtNext("'WHEN'", "'ELSE'", "'END'")
+	}
+	endNode, err := p.expect("END")
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	caseNode.AddChild(endNode)
+
+	return caseNode, nil
+}
+
+// peekPredicate reports whether a predicate like IN, BETWEEN, LIKE or IS NULL follows. They can be negated
+// with NOT, and apart from IS the NOT comes before the keyword: 'a NOT IN (1, 2)'.
+func (p *Parser) peekPredicate() bool {
+	nextToken := p.peek()
+	if nextToken.Is("NOT") {
+		nextToken = p.peekAt(2)
+	}
+	return nextToken.Is("IN") || nextToken.Is("BETWEEN") || nextToken.Is("LIKE") || p.peek().Is("IS")
+}
+
+// parsePredicateCST parses the predicate that tests the already parsed left expression.
+// <in_predicate>      := expression [NOT] IN ( expression { , expression } ) | expression [NOT] IN <subquery>
+// <between_predicate> := expression [NOT] BETWEEN expression AND expression
+// <like_predicate>    := expression [NOT] LIKE expression [ESCAPE expression]
+// <is_null_predicate> := expression IS [NOT] NULL
+func (p *Parser) parsePredicateCST(left narytree.Node) (narytree.Node, error) {
+	predicateNode := narytree.Node{ Children: []narytree.Node{} }
+	predicateNode.AddChild(left)
+
+	if p.peek().Is("IS") {
+		predicateNode.Data = "<is_null_predicate>"
+		p.incrementPosition()
+		predicateNode.AddChild(p.terminalNode())
+
+		if p.peek().Is("NOT") {
+			p.incrementPosition()
+			predicateNode.AddChild(p.terminalNode())
+		}
+
+		nullNode, err := p.expect("NULL")
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		predicateNode.AddChild(nullNode)
+		return predicateNode, nil
+	}
+
+	if p.peek().Is("NOT") {
+		p.incrementPosition()
+		predicateNode.AddChild(p.terminalNode())
+	}
+
+	p.incrementPosition()
+	keywordNode := p.terminalNode()
+	predicateNode.AddChild(keywordNode)
+
+	switch keywordNode.Data {
+		case "IN":
+			predicateNode.Data = "<in_predicate>"
+
+			if p.atSubquery() {
+				subqueryNode, err := p.parseSubqueryCST()
+				if err != nil {
+					return narytree.Node{}, err
+				}
+				predicateNode.AddChild(subqueryNode)
+				break
+			}
+
+			openParenNode, err := p.expect("(")
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			predicateNode.AddChild(openParenNode)
+
+			for {
+				item, err := p.parseExpressionCST()
+				if err != nil {
+					return narytree.Node{}, err
+				}
+				predicateNode.AddChild(item)
+
+				if !p.peek().Is(",") {
+					break
+				}
+				p.incrementPosition()
+				predicateNode.AddChild(p.terminalNode())
+			}
+
+			closeParenNode, err := p.parseCloseParenCST()
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			predicateNode.AddChild(closeParenNode)
+
+		case "BETWEEN":
+			predicateNode.Data = "<between_predicate>"
+
+			// the bounds can't contain AND themselves, otherwise the AND between them would be ambiguous
+			low, err := p.parseBinaryExpressionCST(comparisonPrecedence + 1)
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			predicateNode.AddChild(low)
+
+			andNode, err := p.expect("AND")
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			predicateNode.AddChild(andNode)
+
+			high, err := p.parseBinaryExpressionCST(comparisonPrecedence + 1)
 			if err != nil {
-				fmt.Println(err.Error())
+				return narytree.Node{}, err
 			}
+			predicateNode.AddChild(high)
 
-		case "INSERT":
-			err := parser.parseInsertCST() // parsing insert statements
+		case "LIKE":
+			predicateNode.Data = "<like_predicate>"
 
+			pattern, err := p.parseBinaryExpressionCST(comparisonPrecedence + 1)
 			if err != nil {
-				fmt.Println(err.Error())
+				return narytree.Node{}, err
+			}
+			predicateNode.AddChild(pattern)
+
+			if p.peekContextualKeyword("ESCAPE") {
+				p.incrementPosition()
+				predicateNode.AddChild(p.contextualKeywordNode())
+
+				escape, err := p.parseBinaryExpressionCST(comparisonPrecedence + 1)
+				if err != nil {
+					return narytree.Node{}, err
+				}
+				predicateNode.AddChild(escape)
 			}
-		case "CREATE":
-			err := parser.parseCreateCST() // parsing create statements
+	}
+
+	return predicateNode, nil
+}
+
+// parsePrefixExpressionCST parses NOT, unary '-' and '+', or a primary expression.
+func (p *Parser) parsePrefixExpressionCST() (narytree.Node, error) {
+	nextToken := p.peek()
 
-			if err != nil {
-				fmt.Println(err.Error())
-			}
+	precedence := 0
+	switch {
+		case nextToken.Is("NOT"):
+			precedence = notPrecedence
+		case nextToken.Is("-"), nextToken.Is("+"):
+			precedence = unaryPrecedence
 		default:
-			fmt.Println("could not determine the query type! must be one of: SELECT, INSERT, CREATE")
+			return p.parsePrimaryExpressionCST()
 	}
 
-	return rootNode
-}
+	unaryNode := narytree.Node{ Data: "<unary_expression>", Children: []narytree.Node{} }
+	p.incrementPosition()
+	unaryNode.AddChild(p.terminalNode())
 
-// parseSelect is responsible for parsing the SELECT query type
-// SELECT (col1, col2, ...) FROM table_name WHERE column_name (operator) (value);
-func (p *Parser) parseSelectCST() error {
-	selectNode := narytree.Node{ Data: "SELECT", Children: []narytree.Node{} }
-	colListNode, err := p.parseColumnListCST() // should return a whole branch
-	fromNode := p.parseFromNodeCST()
-	tableNameNode := p.parseTableNameCST()
-	optionalWhereNode := p.parseOptionalWhereCST()
-	semicolonNode := p.parseSemicolonCST()
-	
+	operand, err := p.parseBinaryExpressionCST(precedence)
 	if err != nil {
-		return err
+		return narytree.Node{}, err
 	}
+	unaryNode.AddChild(operand)
 
-	p.rootNode.AddChild(selectNode)
-	p.rootNode.AddChild(colListNode)
-	p.rootNode.AddChild(fromNode)
-	p.rootNode.AddChild(tableNameNode)
-	p.rootNode.AddChild(optionalWhereNode)
-	p.rootNode.AddChild(semicolonNode)
-	return nil
+	return unaryNode, nil
 }
 
-func (p *Parser) parseColumnListCST() (narytree.Node, error) {
+// parsePrimaryExpressionCST parses a literal, a column, a parameter, an expression in parentheses or a
+// subquery. A subquery used as a value has to return a single column and at most one row.
+// <exists_predicate> := EXISTS <subquery>
+func (p *Parser) parsePrimaryExpressionCST() (narytree.Node, error) {
 	nextToken := p.peek()
 
-	if nextToken == "FROM" {
-		return narytree.Node{}, errors.New("missing at lenarytree one column name after SELECT!")
-	}
+	switch {
+		case p.atSubquery():
+			return p.parseSubqueryCST()
 
-	columnListNode := narytree.Node { Data: "<column_list>", Children: []narytree.Node{} }
-	p.incrementPosition()
+		case nextToken.Is("EXISTS"):
+			existsNode := narytree.Node{ Data: "<exists_predicate>", Children: []narytree.Node{} }
+			p.incrementPosition()
+			existsNode.AddChild(p.terminalNode())
 
-	columnName := p.parseColumnNameCST()
-	columnListNode.AddChild(columnName)
-	p.parseColumnListTailCST(&columnListNode)
+			subqueryNode, err := p.parseSubqueryCST()
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			existsNode.AddChild(subqueryNode)
+			return existsNode, nil
 
-	return columnListNode, nil
-}
+		case nextToken.Is("("):
+			parenthesizedNode := narytree.Node{ Data: "<parenthesized_expression>", Children: []narytree.Node{} }
+			p.incrementPosition()
+			parenthesizedNode.AddChild(p.terminalNode())
 
-func (p *Parser) parseColumnNameCST() narytree.Node {
-	columnNameNonTerminal := narytree.Node{ Data: "<column_name>", Children: []narytree.Node{} }
-	columnName := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-	columnNameNonTerminal.Children = append(columnNameNonTerminal.Children, columnName)
-	return columnNameNonTerminal
-}
+			expression, err := p.parseExpressionCST()
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			parenthesizedNode.AddChild(expression)
 
-func (p *Parser) parseColumnListTailCST(parentNode *narytree.Node) narytree.Node {
-	columnListTailNode := narytree.Node{ Data: "<column_list_tail>", Children: []narytree.Node{} }
-	nextToken := p.peek()
-	
-	if nextToken == "," {
-		p.incrementPosition()
-		commaNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-		columnListTailNode.AddChild(commaNode)
-		p.incrementPosition()
-		columnName := p.parseColumnNameCST()
-		columnListTailNode.AddChild(columnName)
-		p.parseColumnListTailCST(&columnListTailNode)
+			closeParenNode, err := p.expect(")")
+			if err != nil {
+				return narytree.Node{}, err
+			}
+			parenthesizedNode.AddChild(closeParenNode)
+			return parenthesizedNode, nil
+
+		case nextToken.Is("NULL"), nextToken.Is("TRUE"), nextToken.Is("FALSE"):
+			p.incrementPosition()
+			return p.terminalNode(), nil
+
+		case nextToken.Is("CASE"):
+			return p.parseCaseExpressionCST()
+
+		case nextToken.Kind == tokens.IDENTIFIER && p.peekAt(2).Is("("):
+			return p.parseFunctionCallCST()
+
+		case nextToken.Kind == tokens.IDENTIFIER && p.peekAt(2).Is("."):
+			return p.parseQualifiedNameCST()
+
+		case nextToken.Kind == tokens.IDENTIFIER, nextToken.Kind == tokens.STRING, nextToken.Kind == tokens.NUMBER, nextToken.Kind == tokens.PARAMETER:
+			p.incrementPosition()
+			return p.terminalNode(), nil
+
+		default:
+			return narytree.Node{}, p.errorAtNext("expression")
 	}
-	
-	parentNode.AddChild(columnListTailNode)
-	return columnListTailNode
 }
 
-func (p *Parser) parseFromNodeCST() narytree.Node {
-	p.incrementPosition()
-	fromNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-	return fromNode
-}
+// parseQualifiedNameCST parses a column name that says which table it belongs to, like users.name.
+// <qualified_name> := identifier . identifier
+func (p *Parser) parseQualifiedNameCST() (narytree.Node, error) {
+	qualifiedNameNode := narytree.Node{ Data: "<qualified_name>", Children: []narytree.Node{} }
 
-func (p *Parser) parseTableNameCST() narytree.Node {
-	tableNameNoneTerminal := narytree.Node{ Data: "<table_name>", Children: []narytree.Node{} }
-	p.incrementPosition()
-	tableNameNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-	tableNameNoneTerminal.AddChild(tableNameNode)
-	return tableNameNoneTerminal
-}
+	tableName, err := p.expectIdentifier()
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	qualifiedNameNode.AddChild(tableName)
 
-func (p *Parser) parseOptionalWhereCST() narytree.Node {
-	optionalWhereNode := narytree.Node{ Data: "<optional_where>", Children: []narytree.Node{} }
-	
-	nextToken := p.peek()
-	if nextToken != "WHERE" {
-		return optionalWhereNode
+	dotNode, err := p.expect(".")
+	if err != nil {
+		return narytree.Node{}, err
 	}
-	
-	p.incrementPosition()
-	whereNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-	optionalWhereNode.AddChild(whereNode)
-	
-	conditionNode := p.parseConditionCST()
-	optionalWhereNode.AddChild(conditionNode)
-	
-	return optionalWhereNode
-}
+	qualifiedNameNode.AddChild(dotNode)
 
-func (p *Parser) parseConditionCST() narytree.Node {
-	conditionNode := narytree.Node{ Data: "<condition>", Children: []narytree.Node{} }
-	
-	p.incrementPosition()
-	leftOperand := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-	conditionNode.AddChild(leftOperand)
-	
-	p.incrementPosition()
-	operator := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-	conditionNode.AddChild(operator)
-	
-	p.incrementPosition()
-	rightOperand := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-	conditionNode.AddChild(rightOperand)
-	
-	return conditionNode
+	columnName, err := p.expectKindNamed("column name", tokens.IDENTIFIER)
+	if err != nil {
+		return narytree.Node{}, err
+	}
+	qualifiedNameNode.AddChild(columnName)
+
+	return qualifiedNameNode, nil
 }
 
-func (p *Parser) parseSemicolonCST() narytree.Node {
-	p.incrementPosition()
-	semicolonNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-	return semicolonNode
+// parseSemicolonCST parses the ';' that ends a statement. It can be left out at the very end of the input, in
+// which case an empty node is returned.
+func (p *Parser) parseSemicolonCST() (narytree.Node, error) {
+	if p.peek().Kind == tokens.EOF {
+		return narytree.Node{}, nil
+	}
+	return p.expect(";")
 }
 
-// parseInsert is responsible for parsing the INSERT query type
-// INSERT INTO table_name (col1, col2, ...) VALUES (val1, val2, ...);
+// parseInsert is responsible for parsing the INSERT query type. Without a column list the values go into
+// the columns of the table in order, and the rows can come from a list of values or from a query.
+// [WITH ...] INSERT INTO table_name [(col1, col2, ...)] VALUES (val1, val2, ...) {, (val1, val2, ...)};
+// [WITH ...] INSERT INTO table_name [(col1, col2, ...)] <select_statement>;
 func (p *Parser) parseInsertCST() error {
-	insertNode := narytree.Node{ Data: "INSERT", Children: []narytree.Node{} }
-	
-	intoNode, err := p.parseIntoNodeCST()
+	optionalWithNode, err := p.parseOptionalWithCST()
 	if err != nil {
 		return err
 	}
-	
-	tableNameNode := p.parseTableNameCST()
-	
-	openParenNode1, err := p.parseOpenParenCST()
+
+	insertNode, err := p.expect("INSERT")
 	if err != nil {
 		return err
 	}
 	
-	insertColListNode, err := p.parseInsertColumnListCST()
+	intoNode, err := p.parseIntoNodeCST()
 	if err != nil {
 		return err
 	}
 	
-	closeParenNode1, err := p.parseCloseParenCST()
+	tableNameNode, err := p.parseTableNameCST()
 	if err != nil {
 		return err
 	}
-	
-	valuesNode, err := p.parseValuesNodeCST()
-	if err != nil {
-		return err
+
+	p.rootNode.AddChild(optionalWithNode)
+	p.rootNode.AddChild(insertNode)
+	p.rootNode.AddChild(intoNode)
+	p.rootNode.AddChild(tableNameNode)
+
+	if p.peek().Is("(") {
+		openParenNode, err := p.parseOpenParenCST()
+		if err != nil {
+			return err
+		}
+
+		insertColListNode, err := p.parseInsertColumnListCST()
+		if err != nil {
+			return err
+		}
+
+		closeParenNode, err := p.parseCloseParenCST()
+		if err != nil {
+			return err
+		}
+
+		p.rootNode.AddChild(openParenNode)
+		p.rootNode.AddChild(insertColListNode)
+		p.rootNode.AddChild(closeParenNode)
 	}
-	
-	openParenNode2, err := p.parseOpenParenCST()
-	if err != nil {
-		return err
+
+	nextToken := p.peek()
+	switch {
+		case nextToken.Is("VALUES"):
+			if err := p.parseValuesRowsCST(); err != nil {
+				return err
+			}
+		case nextToken.Is("SELECT") || nextToken.Is("WITH"):
+			selectStatementNode, err := p.parseSelectStatementCST()
+			if err != nil {
+				return err
+			}
+			p.rootNode.AddChild(selectStatementNode)
+		default:
+			return p.errorAtNext("'VALUES'", "'SELECT'")
 	}
 	
-	valueListNode, err := p.parseValueListCST()
+	semicolonNode, err := p.parseSemicolonCST()
 	if err != nil {
 		return err
 	}
-	
-	closeParenNode2, err := p.parseCloseParenCST()
+	if semicolonNode.Data != "" { // the last statement of a script may leave out the ';'
+		p.rootNode.AddChild(semicolonNode)
+	}
+	return nil
+}
+
+// parseValuesRowsCST parses the rows of an INSERT, each one a list of values in parentheses.
+// VALUES ( <value_list> ) { , ( <value_list> ) }
+func (p *Parser) parseValuesRowsCST() error {
+	valuesNode, err := p.parseValuesNodeCST()
 	if err != nil {
 		return err
 	}
-	
-	semicolonNode := p.parseSemicolonCST()
-	
-	p.rootNode.AddChild(insertNode)
-	p.rootNode.AddChild(intoNode)
-	p.rootNode.AddChild(tableNameNode)
-	p.rootNode.AddChild(openParenNode1)
-	p.rootNode.AddChild(insertColListNode)
-	p.rootNode.AddChild(closeParenNode1)
 	p.rootNode.AddChild(valuesNode)
-	p.rootNode.AddChild(openParenNode2)
-	p.rootNode.AddChild(valueListNode)
-	p.rootNode.AddChild(closeParenNode2)
-	p.rootNode.AddChild(semicolonNode)
-	return nil
+
+	for {
+		openParenNode, err := p.parseOpenParenCST()
+		if err != nil {
+			return err
+		}
+
+		valueListNode, err := p.parseValueListCST()
+		if err != nil {
+			return err
+		}
+
+		closeParenNode, err := p.parseCloseParenCST()
+		if err != nil {
+			return err
+		}
+
+		p.rootNode.AddChild(openParenNode)
+		p.rootNode.AddChild(valueListNode)
+		p.rootNode.AddChild(closeParenNode)
+
+		if !p.peek().Is(",") {
+			return nil
+		}
+		p.incrementPosition()
+		p.rootNode.AddChild(p.terminalNode())
+	}
 }
 
 func (p *Parser) parseIntoNodeCST() (narytree.Node, error) {
-	nextToken := p.peek()
-	if nextToken != "INTO" {
-		return narytree.Node{}, fmt.Errorf("expected 'INTO' but got '%s'", nextToken)
-	}
-	p.incrementPosition()
-	intoNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-	return intoNode, nil
+	return p.expect("INTO")
 }
 
 func (p *Parser) parseOpenParenCST() (narytree.Node, error) {
-	nextToken := p.peek()
-	if nextToken != "(" {
-		return narytree.Node{}, fmt.Errorf("expected '(' but got '%s'", nextToken)
-	}
-	p.incrementPosition()
-	openParenNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-	return openParenNode, nil
+	return p.expect("(")
 }
 
 func (p *Parser) parseCloseParenCST() (narytree.Node, error) {
 	nextToken := p.peek()
-	if nextToken != ")" {
-		return narytree.Node{}, fmt.Errorf("expected ')' but got '%s'", nextToken)
+	if !nextToken.Is(")") {
+		return narytree.Node{}, p.errorAtNext("','", "')'")
 	}
-	p.incrementPosition()
-	closeParenNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-	return closeParenNode, nil
+	return p.expect(")")
 }
 
 func (p *Parser) parseInsertColumnListCST() (narytree.Node, error) {
 	nextToken := p.peek()
 	
-	if nextToken == ")" {
-		return narytree.Node{}, errors.New("missing at lenarytree one column name in INSERT!")
+	if nextToken.Is(")") {
+		return narytree.Node{}, p.syntaxError(nextToken, "missing at least one column name in INSERT")
 	}
 	
 	columnListNode := narytree.Node{ Data: "<column_list>", Children: []narytree.Node{} }
-	p.incrementPosition()
 	
-	columnName := p.parseColumnNameCST()
+	columnName, err := p.parseColumnNameCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
 	columnListNode.AddChild(columnName)
-	p.parseInsertColumnListTailCST(&columnListNode)
+
+	if err := p.parseInsertColumnListTailCST(&columnListNode); err != nil {
+		return narytree.Node{}, err
+	}
 	
 	return columnListNode, nil
 }
 
-func (p *Parser) parseInsertColumnListTailCST(parentNode *narytree.Node) {
+func (p *Parser) parseInsertColumnListTailCST(parentNode *narytree.Node) error {
 	columnListTailNode := narytree.Node{ Data: "<column_list_tail>", Children: []narytree.Node{} }
 	nextToken := p.peek()
 	
-	if nextToken == "," {
+	if nextToken.Is(",") {
 		p.incrementPosition()
-		commaNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
+		commaNode := p.terminalNode()
 		columnListTailNode.AddChild(commaNode)
-		p.incrementPosition()
-		columnName := p.parseColumnNameCST()
+
+		columnName, err := p.parseColumnNameCST()
+		if err != nil {
+			return err
+		}
 		columnListTailNode.AddChild(columnName)
-		p.parseInsertColumnListTailCST(&columnListTailNode)
+
+		if err := p.parseInsertColumnListTailCST(&columnListTailNode); err != nil {
+			return err
+		}
 	}
 	
 	parentNode.AddChild(columnListTailNode)
+	return nil
 }
 
 func (p *Parser) parseValuesNodeCST() (narytree.Node, error) {
-	nextToken := p.peek()
-	if nextToken != "VALUES" {
-		return narytree.Node{}, fmt.Errorf("expected 'VALUES' but got '%s'", nextToken)
-	}
-	p.incrementPosition()
-	valuesNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-	return valuesNode, nil
+	return p.expect("VALUES")
 }
 
+// parseValueListCST parses the values of one row of an INSERT.
+// <value_list> := <value> { , <value> }
 func (p *Parser) parseValueListCST() (narytree.Node, error) {
 	nextToken := p.peek()
 	
-	if nextToken == ")" {
-		return narytree.Node{}, errors.New("missing at lenarytree one value in VALUES!")
+	if nextToken.Is(")") {
+		return narytree.Node{}, p.syntaxError(nextToken, "missing at least one value in VALUES")
 	}
 	
 	valueListNode := narytree.Node{ Data: "<value_list>", Children: []narytree.Node{} }
-	p.incrementPosition()
-	
-	value := p.parseValueCST()
-	valueListNode.AddChild(value)
-	p.parseValueListTailCST(&valueListNode)
+
+	for {
+		value, err := p.parseValueCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		valueListNode.AddChild(value)
+
+		if !p.peek().Is(",") {
+			break
+		}
+		p.incrementPosition()
+		valueListNode.AddChild(p.terminalNode())
+	}
 	
 	return valueListNode, nil
 }
 
-func (p *Parser) parseValueCST() narytree.Node {
+// parseValueCST parses a single value of an INSERT or UPDATE, which is either an expression or DEFAULT for the
+// column's default value.
+// <value> := DEFAULT | expression
+func (p *Parser) parseValueCST() (narytree.Node, error) {
 	valueNonTerminal := narytree.Node{ Data: "<value>", Children: []narytree.Node{} }
-	value := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
+
+	if p.peek().Is("DEFAULT") {
+		p.incrementPosition()
+		valueNonTerminal.AddChild(p.terminalNode())
+		return valueNonTerminal, nil
+	}
+
+	value, err := p.parseExpressionCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
 	valueNonTerminal.AddChild(value)
-	return valueNonTerminal
+	return valueNonTerminal, nil
 }
 
-func (p *Parser) parseValueListTailCST(parentNode *narytree.Node) {
-	valueListTailNode := narytree.Node{ Data: "<value_list_tail>", Children: []narytree.Node{} }
-	nextToken := p.peek()
-	
-	if nextToken == "," {
-		p.incrementPosition()
-		commaNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-		valueListTailNode.AddChild(commaNode)
+// parseUpdate is responsible for parsing the UPDATE query type. Without WHERE every row of the table is
+// changed.
+// [WITH ...] UPDATE table_name SET col1 = val1, col2 = val2, ... [WHERE expression];
+func (p *Parser) parseUpdateCST() error {
+	optionalWithNode, err := p.parseOptionalWithCST()
+	if err != nil {
+		return err
+	}
+
+	updateNode, err := p.expect("UPDATE")
+	if err != nil {
+		return err
+	}
+
+	tableNameNode, err := p.parseTableNameCST()
+	if err != nil {
+		return err
+	}
+
+	setNode, err := p.expect("SET")
+	if err != nil {
+		return err
+	}
+
+	setListNode, err := p.parseSetListCST()
+	if err != nil {
+		return err
+	}
+
+	optionalWhereNode, err := p.parseOptionalWhereCST()
+	if err != nil {
+		return err
+	}
+
+	semicolonNode, err := p.parseSemicolonCST()
+	if err != nil {
+		return err
+	}
+
+	p.rootNode.AddChild(optionalWithNode)
+	p.rootNode.AddChild(updateNode)
+	p.rootNode.AddChild(tableNameNode)
+	p.rootNode.AddChild(setNode)
+	p.rootNode.AddChild(setListNode)
+	p.rootNode.AddChild(optionalWhereNode)
+	if semicolonNode.Data != "" { // the last statement of a script may leave out the ';'
+		p.rootNode.AddChild(semicolonNode)
+	}
+	return nil
+}
+
+// parseSetListCST parses the columns an UPDATE changes and their new values.
+// <set_list>   := <set_clause> { , <set_clause> }
+// <set_clause> := column_name = <value>
+func (p *Parser) parseSetListCST() (narytree.Node, error) {
+	setListNode := narytree.Node{ Data: "<set_list>", Children: []narytree.Node{} }
+
+	for {
+		setClauseNode := narytree.Node{ Data: "<set_clause>", Children: []narytree.Node{} }
+
+		columnName, err := p.expectKindNamed("column name", tokens.IDENTIFIER)
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		setClauseNode.AddChild(columnName)
+
+		equalsNode, err := p.expect("=")
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		setClauseNode.AddChild(equalsNode)
+
+		value, err := p.parseValueCST()
+		if err != nil {
+			return narytree.Node{}, err
+		}
+		setClauseNode.AddChild(value)
+		setListNode.AddChild(setClauseNode)
+
+		if !p.peek().Is(",") {
+			break
+		}
 		p.incrementPosition()
-		value := p.parseValueCST()
-		valueListTailNode.AddChild(value)
-		p.parseValueListTailCST(&valueListTailNode)
+		setListNode.AddChild(p.terminalNode())
 	}
-	
-	parentNode.AddChild(valueListTailNode)
+
+	return setListNode, nil
 }
 
 // parseCreate is responsible for parsing the CREATE query type
 // CREATE TABLE table_name (col1 datatype1, col2 datatype2, ...);
 func (p *Parser) parseCreateCST() error {
-	createNode := narytree.Node{ Data: "CREATE", Children: []narytree.Node{} }
+	createNode, err := p.expect("CREATE")
+	if err != nil {
+		return err
+	}
 	
 	tableKeywordNode, err := p.parseTableKeywordCST()
 	if err != nil {
 		return err
 	}
 
-	tableNameNode := p.parseTableNameCST()
+	tableNameNode, err := p.parseTableNameCST()
+	if err != nil {
+		return err
+	}
 
 	openParenNode, err := p.parseOpenParenCST()
 	if err != nil {
@@ -371,7 +1993,10 @@ func (p *Parser) parseCreateCST() error {
 		return err
 	}
 
-	semicolonNode := p.parseSemicolonCST()
+	semicolonNode, err := p.parseSemicolonCST()
+	if err != nil {
+		return err
+	}
 	
 	p.rootNode.AddChild(createNode)
 	p.rootNode.AddChild(tableKeywordNode)
@@ -379,94 +2004,209 @@ func (p *Parser) parseCreateCST() error {
 	p.rootNode.AddChild(openParenNode)
 	p.rootNode.AddChild(columnDefsNode)
 	p.rootNode.AddChild(closeParenNode)
-	p.rootNode.AddChild(semicolonNode)
+	if semicolonNode.Data != "" { // the last statement of a script may leave out the ';'
+		p.rootNode.AddChild(semicolonNode)
+	}
 	return nil
 }
 
 func (p *Parser) parseTableKeywordCST() (narytree.Node, error) {
-	nextToken := p.peek()
-	if nextToken != "TABLE" {
-		return narytree.Node{}, fmt.Errorf("expected 'TABLE' but got '%s'", nextToken)
-	}
-	p.incrementPosition()
-	tableKeywordNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
-	return tableKeywordNode, nil
+	return p.expect("TABLE")
 }
 
 func (p *Parser) parseColumnDefsListCST() (narytree.Node, error) {
 	nextToken := p.peek()
 	
-	if nextToken == ")" {
-		return narytree.Node{}, errors.New("missing at lenarytree one column definition in CREATE TABLE!")
+	if nextToken.Is(")") {
+		return narytree.Node{}, p.syntaxError(nextToken, "missing at least one column definition in CREATE TABLE")
 	}
 	
 	columnDefsNode := narytree.Node{ Data: "<column_defs_list>", Children: []narytree.Node{} }
 	
-	columnDef := p.parseColumnDefCST()
+	columnDef, err := p.parseColumnDefCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
 	columnDefsNode.AddChild(columnDef)
-	p.parseColumnDefsListTailCST(&columnDefsNode)
+
+	if err := p.parseColumnDefsListTailCST(&columnDefsNode); err != nil {
+		return narytree.Node{}, err
+	}
 	
 	return columnDefsNode, nil
 }
 
-func (p *Parser) parseColumnDefCST() narytree.Node {
+func (p *Parser) parseColumnDefCST() (narytree.Node, error) {
 	columnDefNode := narytree.Node{ Data: "<column_def>", Children: []narytree.Node{} }
 	
-	p.incrementPosition()
-	columnNameNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
+	columnNameNode, err := p.expectIdentifier()
+	if err != nil {
+		return narytree.Node{}, err
+	}
 	columnDefNode.AddChild(columnNameNode)
 	
-	p.incrementPosition()
-	dataTypeNode := p.parseDataTypeCST()
+	dataTypeNode, err := p.parseDataTypeCST()
+	if err != nil {
+		return narytree.Node{}, err
+	}
 	columnDefNode.AddChild(dataTypeNode)
 	
-	return columnDefNode
+	return columnDefNode, nil
 }
 
-func (p *Parser) parseDataTypeCST() narytree.Node {
+func (p *Parser) parseDataTypeCST() (narytree.Node, error) {
 	dataTypeNonTerminal := narytree.Node{ Data: "<data_type>", Children: []narytree.Node{} }
-	dataType := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
+
+	// the names of data types are checked once the table is created, so any word is accepted here
+	dataType, err := p.expectKindNamed("data type", tokens.KEYWORD, tokens.IDENTIFIER)
+	if err != nil {
+		return narytree.Node{}, err
+	}
 	dataTypeNonTerminal.AddChild(dataType)
 	
 	nextToken := p.peek()
-	if nextToken == "(" {
+	if nextToken.Is("(") {
 		p.incrementPosition()
-		openParenNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
+		openParenNode := p.terminalNode()
 		dataTypeNonTerminal.AddChild(openParenNode)
 		
-		p.incrementPosition()
-		sizeNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
+		sizeNode, err := p.expectKind(tokens.NUMBER)
+		if err != nil {
+			return narytree.Node{}, err
+		}
 		dataTypeNonTerminal.AddChild(sizeNode)
 		
-		p.incrementPosition()
-		closeParenNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
+		closeParenNode, err := p.expect(")")
+		if err != nil {
+			return narytree.Node{}, err
+		}
 		dataTypeNonTerminal.AddChild(closeParenNode)
 	}
 	
-	return dataTypeNonTerminal
+	return dataTypeNonTerminal, nil
 }
 
-func (p *Parser) parseColumnDefsListTailCST(parentNode *narytree.Node) {
+func (p *Parser) parseColumnDefsListTailCST(parentNode *narytree.Node) error {
 	columnDefsListTailNode := narytree.Node{ Data: "<column_defs_list_tail>", Children: []narytree.Node{} }
 	nextToken := p.peek()
 	
-	if nextToken == "," {
+	if nextToken.Is(",") {
 		p.incrementPosition()
-		commaNode := narytree.Node{ Data: p.tokens[p.pos], Children: []narytree.Node{} }
+		commaNode := p.terminalNode()
 		columnDefsListTailNode.AddChild(commaNode)
 		
-		columnDef := p.parseColumnDefCST()
+		columnDef, err := p.parseColumnDefCST()
+		if err != nil {
+			return err
+		}
 		columnDefsListTailNode.AddChild(columnDef)
-		p.parseColumnDefsListTailCST(&columnDefsListTailNode)
+
+		if err := p.parseColumnDefsListTailCST(&columnDefsListTailNode); err != nil {
+			return err
+		}
 	}
 	
 	parentNode.AddChild(columnDefsListTailNode)
+	return nil
 }
 
 func (p *Parser) incrementPosition() {
 	p.pos += 1
 }
 
-func (p *Parser) peek() string {
-	return p.tokens[p.pos + 1]
-}
\ No newline at end of file
+func (p *Parser) peek() tokens.Token {
+	return p.peekAt(1)
+}
+
+// peekAt looks ahead without consuming anything, peekAt(1) being the next token. Past the end of the
+// tokens it returns an EOF token so that callers never have to check the bounds themselves.
+func (p *Parser) peekAt(offset int) tokens.Token {
+	index := p.pos + offset
+	if index >= 0 && index < len(p.tokens) {
+		return p.tokens[index]
+	}
+	return p.endOfInput()
+}
+
+// endOfInput builds the EOF token, placed right after the last token.
+func (p *Parser) endOfInput() tokens.Token {
+	eof := tokens.Token{ Kind: tokens.EOF, Line: 1, Column: 1 }
+	if len(p.tokens) > 0 {
+		last := p.tokens[len(p.tokens) - 1]
+		eof.Offset = last.Offset + len(last.Text)
+		eof.CharOffset = last.CharOffset + len([]rune(last.Text))
+		eof.Line = last.Line
+		eof.Column = last.Column + len([]rune(last.Text))
+	}
+	return eof
+}
+
+// terminalNode turns the token at the current position into a leaf of the parse tree. The leaf keeps the
+// token's kind so that later stages can tell identifiers, keywords and literals apart, and the value the
+// lexer parsed for a number.
+func (p *Parser) terminalNode() narytree.Node {
+	token := p.tokens[p.pos]
+	return narytree.Node{ Type: string(token.Kind), Data: token.Value, Value: token.Number, Children: []narytree.Node{} }
+}
+
+// expect consumes the next token if it is one of the given keywords or symbols and returns it as a leaf.
+func (p *Parser) expect(values ...string) (narytree.Node, error) {
+	nextToken := p.peek()
+	for _, value := range values {
+		if nextToken.Is(value) {
+			p.incrementPosition()
+			return p.terminalNode(), nil
+		}
+	}
+
+	expected := make([]string, len(values))
+	for i, value := range values {
+		expected[i] = "'" + value + "'"
+	}
+	return narytree.Node{}, p.errorAtNext(expected...)
+}
+
+// expectKind consumes the next token if it is of one of the given kinds and returns it as a leaf.
+func (p *Parser) expectKind(kinds ...tokens.Kind) (narytree.Node, error) {
+	return p.expectKindNamed("", kinds...)
+}
+
+// expectKindNamed is expectKind with a custom description of what was expected for error messages.
+func (p *Parser) expectKindNamed(description string, kinds ...tokens.Kind) (narytree.Node, error) {
+	nextToken := p.peek()
+	for _, kind := range kinds {
+		if nextToken.Kind == kind {
+			p.incrementPosition()
+			return p.terminalNode(), nil
+		}
+	}
+
+	if description != "" {
+		return narytree.Node{}, p.errorAtNext(description)
+	}
+
+	expected := make([]string, len(kinds))
+	for i, kind := range kinds {
+		expected[i] = kindDescriptions[kind]
+	}
+	return narytree.Node{}, p.errorAtNext(expected...)
+}
+
+// peekContextualKeyword reports whether the next token is a word that is only a keyword in certain places,
+// like ESCAPE after LIKE. Those words aren't reserved so that they can still be used as names everywhere
+// else; they are lexed as identifiers and only recognized when written without quotes.
+func (p *Parser) peekContextualKeyword(keyword string) bool {
+	nextToken := p.peek()
+	return nextToken.Kind == tokens.IDENTIFIER && !nextToken.Quoted && nextToken.Value == tokens.FoldIdentifier(keyword)
+}
+
+// contextualKeywordNode turns the contextual keyword at the current position into a keyword leaf, so that
+// it looks the same in the parse tree as a reserved one.
+func (p *Parser) contextualKeywordNode() narytree.Node {
+	token := p.tokens[p.pos]
+	return narytree.Node{ Type: string(tokens.KEYWORD), Data: strings.ToUpper(token.Value), Children: []narytree.Node{} }
+}
+
+func (p *Parser) expectIdentifier() (narytree.Node, error) {
+	return p.expectKind(tokens.IDENTIFIER)
+}
@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jasutiin/deebeejeebees/internal/lexer"
+	"github.com/jasutiin/deebeejeebees/internal/tokens"
+)
+
+// tokenize runs the lexer on a query that is known to be lexically valid.
+func tokenize(t *testing.T, query string) []tokens.Token {
+	t.Helper()
+	list, err := lexer.AnalyzeString(query)
+	if err != nil {
+		t.Fatalf("AnalyzeString(%q) failed: %v", query, err)
+	}
+	return list
+}
+
+func TestParseTokensToCSTSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{ "SELECT a", "syntax error at line 1, column 9: expected ',' or 'FROM' but got end of input" },
+		{ "SELECT", "syntax error at line 1, column 7: expected expression but got end of input" },
+		{ "SELECT a FROM", "syntax error at line 1, column 14: expected identifier but got end of input" },
+		{ "SELECT a FROM t WHERE", "syntax error at line 1, column 22: expected expression but got end of input" },
+		{ "SELECT a, FROM t", "syntax error at line 1, column 11: expected expression but got 'FROM'" },
+		{ "SELECT a FROM t 1", "syntax error at line 1, column 17: expected ';' but got '1'" },
+		{ "SELECT a FROM t; SELECT b FROM u", "syntax error at line 1, column 18: expected end of input but got 'SELECT'" },
+		{ "SELECT (a FROM t", "syntax error at line 1, column 11: expected ')' but got 'FROM'" },
+		{ "SELECT a FROM t ORDER a", "syntax error at line 1, column 23: expected 'BY' but got 'a'" },
+		{ "SELECT a FROM t LIMIT", "syntax error at line 1, column 22: expected expression but got end of input" },
+		{ "DELETE FROM t", "syntax error at line 1, column 1: expected 'SELECT', 'INSERT', 'UPDATE', 'CREATE' or 'WITH' but got 'DELETE'" },
+		{ "INSERT INTO t VALUES (1", "syntax error at line 1, column 24: expected ',' or ')' but got end of input" },
+		{ "INSERT INTO t () VALUES (1)", "syntax error at line 1, column 16: missing at least one column name in INSERT" },
+		{ "INSERT INTO t VALUES ()", "syntax error at line 1, column 23: missing at least one value in VALUES" },
+		{ "INSERT INTO t (a) ;", "syntax error at line 1, column 19: expected 'VALUES' or 'SELECT' but got ';'" },
+		{ "CREATE TABLE t (a)", "syntax error at line 1, column 18: expected data type but got ')'" },
+		{ "UPDATE t SET a", "syntax error at line 1, column 15: expected '=' but got end of input" },
+		{ "UPDATE t a = 1", "syntax error at line 1, column 10: expected 'SET' but got 'a'" },
+		{ "SELECT CASE WHEN a THEN 1 FROM t", "syntax error at line 1, column 27: expected 'WHEN', 'ELSE' or 'END' but got 'FROM'" },
+		{ "SELECT a FROM t JOIN u", "syntax error at line 1, column 23: expected 'ON' or 'USING' but got end of input" },
+		{ "WITH x AS SELECT 1 FROM t SELECT * FROM x", "syntax error at line 1, column 11: expected '(' but got 'SELECT'" },
+		{ "SELECT SUM(a) OVER (ROWS BETWEEN 1 PRECEDING) FROM t", "syntax error at line 1, column 45: expected 'AND' but got ')'" },
+	}
+
+	for _, test := range tests {
+		tree, err := ParseTokensToCST(tokenize(t, test.query))
+		if tree.Data != "" || len(tree.Children) > 0 {
+			t.Errorf("ParseTokensToCST(%q) should not return a partial tree, got %v", test.query, tree)
+		}
+		var syntaxError *SyntaxError
+		if !errors.As(err, &syntaxError) {
+			t.Errorf("ParseTokensToCST(%q) should fail with a *SyntaxError, got %v", test.query, err)
+			continue
+		}
+		if err.Error() != test.want {
+			t.Errorf("ParseTokensToCST(%q) error =\n  %s\nwant\n  %s", test.query, err.Error(), test.want)
+		}
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		script     string
+		statements int
+	}{
+		{ "SELECT a FROM t", 1 },
+		{ "SELECT a FROM t;", 1 },
+		{ "SELECT a FROM t;; SELECT b FROM u", 2 },
+		{ "CREATE TABLE t (a INT); INSERT INTO t (a) VALUES (1); SELECT a FROM t", 3 },
+		{ ";;", 0 },
+		{ "", 0 },
+	}
+
+	for _, test := range tests {
+		statements, err := ParseScript(tokenize(t, test.script))
+		if err != nil {
+			t.Errorf("ParseScript(%q) failed: %v", test.script, err)
+			continue
+		}
+		if len(statements) != test.statements {
+			t.Errorf("ParseScript(%q) returned %d statements, want %d", test.script, len(statements), test.statements)
+		}
+	}
+}
+
+func TestCheckSyntaxReportsEveryError(t *testing.T) {
+	script := "SELECT a FROM t; SELEC b; INSERT INTO t (a) VALUES (; SELECT c FROM u;"
+	want := []string{
+		"syntax error at line 1, column 18: expected 'SELECT', 'INSERT', 'UPDATE', 'CREATE' or 'WITH' but got 'SELEC'",
+		"syntax error at line 1, column 53: expected expression but got ';'",
+	}
+
+	errs := CheckSyntax(tokenize(t, script))
+	if len(errs) != len(want) {
+		t.Fatalf("CheckSyntax(%q) found %d errors, want %d: %v", script, len(errs), len(want), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Errorf("error %d = %q, want %q", i, err.Error(), want[i])
+		}
+	}
+
+	if _, err := ParseScript(tokenize(t, script)); err == nil {
+		t.Errorf("ParseScript(%q) should fail", script)
+	}
+}
+
+func TestCheckSyntaxReportsEachProblemOnce(t *testing.T) {
+	tests := []struct {
+		script string
+		want   []string
+	}{
+		{
+			"WITH x AS (SELECT 1 FROM t) DELETE FROM t",
+			[]string{ "syntax error at line 1, column 29: expected 'SELECT' or '(' but got 'DELETE'" },
+		},
+		{
+			"SELECT a FROM t WHERE a IN (SELEC b FROM u) AND c IN (SELECT d FROM v); SELECT 1 FROM t",
+			[]string{ "syntax error at line 1, column 35: expected ',' or ')' but got 'b'" },
+		},
+		{
+			"DROP TABLE t; SELECT a FROM",
+			[]string{
+				"syntax error at line 1, column 1: expected 'SELECT', 'INSERT', 'UPDATE', 'CREATE' or 'WITH' but got 'DROP'",
+				"syntax error at line 1, column 28: expected identifier but got end of input",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		errs := CheckSyntax(tokenize(t, test.script))
+		got := make([]string, len(errs))
+		for i, err := range errs {
+			got[i] = err.Error()
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("CheckSyntax(%q) =\n  %s\nwant\n  %s", test.script, strings.Join(got, "\n  "), strings.Join(test.want, "\n  "))
+		}
+	}
+}
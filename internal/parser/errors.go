@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jasutiin/deebeejeebees/internal/tokens"
+)
+
+// SyntaxError is returned when the tokens don't form a valid statement. It always means the query is
+// wrong; the parser doesn't return errors for any other reason.
+type SyntaxError struct {
+	Token    tokens.Token // the token the parser could not make sense of
+	Expected []string     // what would have been valid instead, e.g. 'FROM' or identifier
+	Message  string       // set instead of Expected when a plain description fits better
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("syntax error at %s: %s", e.Token.Position(), e.Message)
+	}
+	return fmt.Sprintf("syntax error at %s: expected %s but got %s", e.Token.Position(), joinAlternatives(e.Expected), describeToken(e.Token))
+}
+
+// ErrorList holds every syntax error found in a script, in the order they appear.
+type ErrorList []*SyntaxError
+
+func (l ErrorList) Error() string {
+	messages := make([]string, len(l))
+	for i, err := range l {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Unwrap lets errors.As find the individual syntax errors.
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, err := range l {
+		errs[i] = err
+	}
+	return errs
+}
+
+// kindDescriptions describe the kinds of tokens in error messages.
+var kindDescriptions = map[tokens.Kind]string{
+	tokens.IDENTIFIER: "identifier",
+	tokens.STRING:     "string",
+	tokens.NUMBER:     "number",
+	tokens.PARAMETER:  "parameter",
+	tokens.KEYWORD:    "keyword",
+	tokens.EOF:        "end of input",
+}
+
+// errorAtNext reports that the next token is not one of the expected alternatives.
+func (p *Parser) errorAtNext(expected ...string) *SyntaxError {
+	return &SyntaxError{ Token: p.peek(), Expected: expected }
+}
+
+// syntaxError reports a problem with a token that is better described in words.
+func (p *Parser) syntaxError(token tokens.Token, message string) *SyntaxError {
+	return &SyntaxError{ Token: token, Message: message }
+}
+
+func describeToken(token tokens.Token) string {
+	if token.Kind == tokens.EOF {
+		return "end of input"
+	}
+	return "'" + token.Text + "'"
+}
+
+// joinAlternatives joins expected alternatives into "a", "a or b" or "a, b or c".
+func joinAlternatives(alternatives []string) string {
+	if len(alternatives) <= 1 {
+		return strings.Join(alternatives, "")
+	}
+	return strings.Join(alternatives[:len(alternatives) - 1], ", ") + " or " + alternatives[len(alternatives) - 1]
+}
@@ -3,6 +3,7 @@ package narytree
 type Node struct {
 	Type     string
 	Data     string
+	Value    any // the parsed value of a number literal, an int64 or a float64
 	Children []Node
 }
 
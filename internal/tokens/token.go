@@ -0,0 +1,101 @@
+package tokens
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kind describes what sort of token the lexer produced. Symbols use the name they are given in
+// ReservedSymbols, so a ';' has the kind "SEMICOLON" and both '!=' and '<>' have the kind "NEQ".
+type Kind string
+
+const (
+	KEYWORD    Kind = "KEYWORD"
+	IDENTIFIER Kind = "IDENTIFIER"
+	STRING     Kind = "STRING"
+	NUMBER     Kind = "NUMBER"
+	PARAMETER  Kind = "PARAMETER"
+	EOF        Kind = "EOF"
+
+	// the kinds of the symbols the parser most often has to look for
+	COMMA  Kind = "COMMA"
+	LPAREN Kind = "LPAREN"
+	RPAREN Kind = "RPAREN"
+)
+
+// Token is a single lexical unit of a query along with where it came from.
+type Token struct {
+	Kind Kind
+
+	// Text is the token exactly as it appears in the query.
+	Text string
+
+	// Value is the normalized form of the token: keywords are upper-cased, unquoted identifiers are
+	// folded with FoldIdentifier, and string literals and quoted identifiers have their surrounding
+	// quotes removed and escapes decoded. Parameters are written as $n or :name, with positional '?'
+	// parameters numbered from left to right. For everything else it is the same as Text.
+	Value string
+
+	// Quoted is set for identifiers written as "name" or `name`.
+	Quoted bool
+
+	// Number holds the parsed value of a NUMBER token, either an int64 or a float64.
+	Number any
+
+	Offset     int // byte offset of the first character of the token
+	CharOffset int // offset of the first character of the token counted in characters, not bytes
+	Line       int // 1-based line number
+	Column     int // 1-based column number, counted in characters
+}
+
+// FoldIdentifier returns the name an unquoted identifier refers to. Unquoted identifiers are case
+// insensitive and are folded to lower case, so Users, USERS and users all name the same table. Quoted
+// identifiers ("Users") are taken exactly as written and never folded, which is also how a keyword like
+// "order" can be used as a name. Anything that looks names up, like the catalog, can compare the Value of
+// identifier tokens directly.
+func FoldIdentifier(name string) string {
+	return strings.ToLower(name)
+}
+
+// Is reports whether the token is the given keyword or symbol, e.g. tok.Is("FROM") or tok.Is(",").
+// String literals and identifiers never match, so the identifier SELECT_x is not the keyword SELECT.
+func (t Token) Is(value string) bool {
+	if t.Kind == IDENTIFIER || t.Kind == STRING || t.Kind == NUMBER || t.Kind == PARAMETER || t.Kind == EOF {
+		return false
+	}
+	return t.Value == value
+}
+
+// Position returns the location of the token in a human readable form.
+func (t Token) Position() string {
+	return fmt.Sprintf("line %d, column %d", t.Line, t.Column)
+}
+
+func (t Token) String() string {
+	return fmt.Sprintf("%s %q (%s)", t.Kind, t.Text, t.Position())
+}
+
+// ParseNumber converts the text of a numeric literal into an int64 or a float64. Decimal integers that do
+// not fit into an int64 become a float64. It accepts an optional leading sign so that it can also be used
+// on negated literals.
+func ParseNumber(text string) (any, error) {
+	sign := ""
+	digits := text
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		sign = digits[:1]
+		digits = digits[1:]
+	}
+
+	if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+		return strconv.ParseInt(sign+digits[2:], 16, 64)
+	}
+
+	if !strings.ContainsAny(digits, ".eE") {
+		if n, err := strconv.ParseInt(sign+digits, 10, 64); err == nil {
+			return n, nil
+		}
+	}
+
+	return strconv.ParseFloat(sign+digits, 64)
+}
@@ -0,0 +1,71 @@
+package tokens
+
+import "testing"
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		text string
+		want any
+	}{
+		{ "42", int64(42) },
+		{ "-7", int64(-7) },
+		{ "+7", int64(7) },
+		{ "3.14", 3.14 },
+		{ ".5", 0.5 },
+		{ "1.", 1.0 },
+		{ "1e3", 1000.0 },
+		{ "2.5E-3", 0.0025 },
+		{ "0x1F", int64(31) },
+		{ "-0xff", int64(-255) },
+		{ "9223372036854775807", int64(9223372036854775807) },
+		{ "9223372036854775808", 9223372036854775808.0 },
+	}
+
+	for _, test := range tests {
+		got, err := ParseNumber(test.text)
+		if err != nil {
+			t.Errorf("ParseNumber(%q) failed: %v", test.text, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseNumber(%q) = %#v, want %#v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestParseNumberRejectsGarbage(t *testing.T) {
+	for _, text := range []string{ "", "abc", "0xZZ", "1.2.3" } {
+		if _, err := ParseNumber(text); err == nil {
+			t.Errorf("ParseNumber(%q) should fail", text)
+		}
+	}
+}
+
+func TestTokenIs(t *testing.T) {
+	tests := []struct {
+		token Token
+		value string
+		want  bool
+	}{
+		{ Token{ Kind: KEYWORD, Value: "SELECT" }, "SELECT", true },
+		{ Token{ Kind: COMMA, Value: "," }, ",", true },
+		{ Token{ Kind: IDENTIFIER, Value: "SELECT" }, "SELECT", false },
+		{ Token{ Kind: STRING, Value: "FROM" }, "FROM", false },
+		{ Token{ Kind: NUMBER, Value: "1" }, "1", false },
+		{ Token{ Kind: EOF }, "", false },
+	}
+
+	for _, test := range tests {
+		if got := test.token.Is(test.value); got != test.want {
+			t.Errorf("%v.Is(%q) = %v, want %v", test.token, test.value, got, test.want)
+		}
+	}
+}
+
+func TestFoldIdentifier(t *testing.T) {
+	for _, name := range []string{ "Users", "USERS", "users" } {
+		if got := FoldIdentifier(name); got != "users" {
+			t.Errorf("FoldIdentifier(%q) = %q, want %q", name, got, "users")
+		}
+	}
+}
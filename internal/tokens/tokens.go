@@ -11,6 +11,7 @@ var ReservedKeywords = map[string]bool{
 	"SCHEMA":   true,
 	"SELECT": true,
 	"INSERT": true,
+	"INTO":   true,
 	"UPDATE": true,
 	"DELETE": true,
 	"FROM":   true,
@@ -20,7 +21,11 @@ var ReservedKeywords = map[string]bool{
 	"LEFT":   true,
 	"RIGHT":  true,
 	"FULL":   true,
+	"OUTER":  true,
+	"CROSS":  true,
 	"ON":     true,
+	"WITH":   true,
+	"USING":  true,
 	"VALUES": true,
 	"SET":    true,
 	"GRANT":  true,
@@ -36,12 +41,19 @@ var ReservedKeywords = map[string]bool{
 	"HAVING":   true,
 	"LIMIT":    true,
 	"OFFSET":   true,
+	"ASC":      true,
+	"DESC":     true,
+	"UNION":     true,
+	"INTERSECT": true,
+	"EXCEPT":    true,
 	"AND":      true,
 	"OR":       true,
 	"NOT":      true,
 	"IN":       true,
 	"IS":       true,
 	"NULL":     true,
+	"TRUE":     true,
+	"FALSE":    true,
 	"LIKE":     true,
 	"BETWEEN":  true,
 	"CASE":     true,